@@ -0,0 +1,370 @@
+// Package analysis inspects parsed templates without rendering them.
+//
+// It finds the variables a template reads from its context, the templates
+// it references and the filters and tests it uses, like Jinja's meta module.
+package analysis
+
+import (
+	"sort"
+
+	"github.com/MarioJim/gonja/nodes"
+)
+
+// Result holds what a template needs to be rendered
+type Result struct {
+	// Variables are the names read from the context, i.e. neither declared
+	// by the template itself nor provided by the renderer
+	Variables []string
+	// Templates are the static filenames of extended, included and imported templates
+	Templates []string
+	// DynamicTemplates are the expressions computing filenames at render time
+	DynamicTemplates []nodes.Expression
+	// Filters are the names of the filters in use
+	Filters []string
+	// Tests are the names of the tests in use
+	Tests []string
+}
+
+// Statement is implemented by statements describing their structure to the analysis
+type Statement interface {
+	Analyze(a *Analyzer)
+}
+
+// Hooks are called while walking a template, to build checks such as
+// linters on top of the analysis. Every hook is optional.
+type Hooks struct {
+	// Declare is called for a name bound by a statement along with the
+	// declaring node, e.g. the *nodes.Macro of a macro
+	Declare func(name string, node nodes.Node)
+	// Assign is called for a name assigned by a set statement. Shadows is
+	// true for an assignment in a loop body to a name declared outside of
+	// the loop, which is left unchanged once the loop is done.
+	Assign func(target *nodes.Name, shadows bool)
+	// Read is called for a name being read, along with the node declaring
+	// it, or nil if it comes from the context or the renderer
+	Read func(name *nodes.Name, declaration nodes.Node)
+	// Filter is called for each filter call
+	Filter func(call *nodes.FilterCall)
+	// Test is called for each test call
+	Test func(call *nodes.TestCall)
+	// Unreachable is called for a branch following a condition which is always true
+	Unreachable func(branch *nodes.Wrapper)
+}
+
+// Analyze walks the whole AST of a template
+func Analyze(tpl *nodes.Template) *Result {
+	return AnalyzeWith(tpl, nil)
+}
+
+// AnalyzeWith walks the whole AST of a template, calling hooks along the way
+func AnalyzeWith(tpl *nodes.Template, hooks *Hooks) *Result {
+	if hooks == nil {
+		hooks = &Hooks{}
+	}
+	a := &Analyzer{
+		template:  tpl,
+		hooks:     hooks,
+		scope:     &scope{names: map[string]nodes.Node{"self": nil}},
+		variables: map[string]bool{},
+		templates: map[string]bool{},
+		filters:   map[string]bool{},
+		tests:     map[string]bool{},
+	}
+	for _, node := range tpl.Nodes {
+		a.Node(node)
+	}
+	return &Result{
+		Variables:        sortedKeys(a.variables),
+		Templates:        sortedKeys(a.templates),
+		DynamicTemplates: a.dynamicTemplates,
+		Filters:          sortedKeys(a.filters),
+		Tests:            sortedKeys(a.tests),
+	}
+}
+
+// UndeclaredVariables returns the names a template reads from its context
+func UndeclaredVariables(tpl *nodes.Template) []string {
+	return Analyze(tpl).Variables
+}
+
+// ReferencedTemplates returns the static filenames referenced by a template
+func ReferencedTemplates(tpl *nodes.Template) []string {
+	return Analyze(tpl).Templates
+}
+
+// scope maps declared names to their declaring node, if known
+type scope struct {
+	names  map[string]nodes.Node
+	loop   bool // Body of a loop
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (nodes.Node, bool) {
+	for ; s != nil; s = s.parent {
+		if node, ok := s.names[name]; ok {
+			return node, true
+		}
+	}
+	return nil, false
+}
+
+// shadows returns true if assigning name in this scope hides a name
+// declared outside of the innermost enclosing loop
+func (s *scope) shadows(name string) bool {
+	for ; s != nil; s = s.parent {
+		if _, ok := s.names[name]; ok {
+			return false
+		}
+		if s.loop {
+			_, ok := s.parent.lookup(name)
+			return ok
+		}
+	}
+	return false
+}
+
+// Analyzer accumulates the analysis of a template while walking its nodes
+type Analyzer struct {
+	template *nodes.Template
+	hooks    *Hooks
+	scope    *scope
+
+	variables        map[string]bool
+	templates        map[string]bool
+	dynamicTemplates []nodes.Expression
+	filters          map[string]bool
+	tests            map[string]bool
+}
+
+// Declare binds names in the current scope, reading them afterwards
+// does not access the context
+func (a *Analyzer) Declare(names ...string) {
+	for _, name := range names {
+		a.scope.names[name] = nil
+	}
+}
+
+// DeclareNode binds name in the current scope to its declaring node
+func (a *Analyzer) DeclareNode(name string, node nodes.Node) {
+	if a.hooks.Declare != nil {
+		a.hooks.Declare(name, node)
+	}
+	a.scope.names[name] = node
+}
+
+// Assign binds the name assigned by a set statement in the current scope
+func (a *Analyzer) Assign(target *nodes.Name) {
+	name := target.Name.Val
+	if a.hooks.Assign != nil {
+		a.hooks.Assign(target, a.scope.shadows(name))
+	}
+	a.scope.names[name] = target
+}
+
+// Scope analyzes fn in a new scope, names declared by fn do not leak
+func (a *Analyzer) Scope(fn func()) {
+	a.scope = &scope{names: map[string]nodes.Node{}, parent: a.scope}
+	defer func() { a.scope = a.scope.parent }()
+	fn()
+}
+
+// Loop analyzes fn in a new scope holding the body of a loop
+func (a *Analyzer) Loop(fn func()) {
+	a.Scope(func() {
+		a.scope.loop = true
+		fn()
+	})
+}
+
+// Branches analyzes the conditions and branches of a conditional
+// statement, a trailing branch without condition being the else branch
+func (a *Analyzer) Branches(conditions []nodes.Expression, branches []*nodes.Wrapper) {
+	a.Expressions(conditions...)
+	reachable := true
+	for idx, branch := range branches {
+		if !reachable && branch != nil && a.hooks.Unreachable != nil {
+			a.hooks.Unreachable(branch)
+		}
+		if idx < len(conditions) && isTrue(conditions[idx]) {
+			reachable = false
+		}
+		a.Wrapper(branch)
+	}
+}
+
+// Template records a static reference to another template
+func (a *Analyzer) Template(filename string) {
+	a.templates[filename] = true
+}
+
+// DynamicTemplate records a template reference computed at render time
+func (a *Analyzer) DynamicTemplate(expr nodes.Expression) {
+	a.dynamicTemplates = append(a.dynamicTemplates, expr)
+	a.Expression(expr)
+}
+
+// Filters records a filter chain along with its arguments
+func (a *Analyzer) Filters(calls []*nodes.FilterCall) {
+	for _, call := range calls {
+		if a.hooks.Filter != nil {
+			a.hooks.Filter(call)
+		}
+		a.filters[call.Name] = true
+		a.Expressions(call.Args...)
+		a.kwargs(call.Kwargs)
+	}
+}
+
+// Block analyzes the body of the named block of the template
+func (a *Analyzer) Block(name string) {
+	if block, ok := a.template.Blocks[name]; ok {
+		a.Wrapper(block)
+	}
+}
+
+// Wrapper analyzes a statement body in a new scope, like the renderer does
+func (a *Analyzer) Wrapper(wrapper *nodes.Wrapper) {
+	if wrapper != nil {
+		a.Scope(func() {
+			a.Node(wrapper)
+		})
+	}
+}
+
+// Node analyzes a template node
+func (a *Analyzer) Node(node nodes.Node) {
+	switch n := node.(type) {
+	case *nodes.Wrapper:
+		for _, child := range n.Nodes {
+			a.Node(child)
+		}
+	case *nodes.Output:
+		a.Expression(n.Expression)
+	case *nodes.StatementBlock:
+		if stmt, ok := n.Stmt.(Statement); ok {
+			stmt.Analyze(a)
+		}
+	}
+}
+
+// Expressions analyzes expressions in the current scope
+func (a *Analyzer) Expressions(exprs ...nodes.Expression) {
+	for _, expr := range exprs {
+		a.Expression(expr)
+	}
+}
+
+// Expression analyzes an expression in the current scope
+func (a *Analyzer) Expression(expr nodes.Expression) {
+	switch n := expr.(type) {
+	case nil:
+	case *nodes.Name:
+		declaration, ok := a.scope.lookup(n.Name.Val)
+		if !ok {
+			a.variables[n.Name.Val] = true
+		}
+		if a.hooks.Read != nil {
+			a.hooks.Read(n, declaration)
+		}
+	case *nodes.FilteredExpression:
+		a.Expression(n.Expression)
+		a.Filters(n.Filters)
+	case *nodes.TestExpression:
+		a.Expression(n.Expression)
+		if a.hooks.Test != nil {
+			a.hooks.Test(n.Test)
+		}
+		a.tests[n.Test.Name] = true
+		a.Expressions(n.Test.Args...)
+		a.kwargs(n.Test.Kwargs)
+	case *nodes.List:
+		a.Expressions(n.Val...)
+	case *nodes.Tuple:
+		a.Expressions(n.Val...)
+	case *nodes.Dict:
+		for _, pair := range n.Pairs {
+			a.Expression(pair)
+		}
+	case *nodes.Pair:
+		a.Expressions(n.Key, n.Value)
+	case *nodes.Call:
+		a.Expression(n.Func)
+		a.Expressions(n.Args...)
+		a.kwargs(n.Kwargs)
+	case *nodes.Getitem:
+		a.Expressions(n.Node, n.Arg)
+	case *nodes.Slice:
+		a.Expressions(n.Start, n.Stop, n.Step)
+	case *nodes.Getattr:
+		a.Expression(n.Node)
+	case *nodes.Negation:
+		a.Expression(n.Term)
+	case *nodes.UnaryExpression:
+		a.Expression(n.Term)
+	case *nodes.BinaryExpression:
+		a.Expressions(n.Left, n.Right)
+	case *nodes.Conditional:
+		a.Expressions(n.Expression, n.Condition, n.Alternative)
+	}
+}
+
+func (a *Analyzer) kwargs(kwargs map[string]nodes.Expression) {
+	for _, expr := range kwargs {
+		a.Expression(expr)
+	}
+}
+
+// isTrue returns true for a literal condition which is always true
+func isTrue(expr nodes.Expression) bool {
+	switch n := expr.(type) {
+	case *nodes.Bool:
+		return n.Val
+	case *nodes.Integer:
+		return n.Val != 0
+	case *nodes.Float:
+		return n.Val != 0
+	case *nodes.String:
+		return n.Val != ""
+	case *nodes.List:
+		return len(n.Val) > 0
+	case *nodes.Tuple:
+		return len(n.Val) > 0
+	case *nodes.Dict:
+		return len(n.Pairs) > 0
+	case *nodes.Negation:
+		return isFalse(n.Term)
+	}
+	return false
+}
+
+// isFalse returns true for a literal condition which is always false
+func isFalse(expr nodes.Expression) bool {
+	switch n := expr.(type) {
+	case *nodes.Bool:
+		return !n.Val
+	case *nodes.Integer:
+		return n.Val == 0
+	case *nodes.Float:
+		return n.Val == 0
+	case *nodes.String:
+		return n.Val == ""
+	case *nodes.List:
+		return len(n.Val) == 0
+	case *nodes.Tuple:
+		return len(n.Val) == 0
+	case *nodes.Dict:
+		return len(n.Pairs) == 0
+	case *nodes.Negation:
+		return isTrue(n.Term)
+	}
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
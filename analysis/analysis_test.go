@@ -0,0 +1,70 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja"
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/loaders"
+)
+
+var analysisCases = []struct {
+	name      string
+	source    string
+	variables []string
+	templates []string
+	dynamic   []string
+	filters   []string
+	tests     []string
+}{
+	{"names", `{{ a }}{{ b.c }}{{ d['e'] }}{{ f(g, key=h) }}`, []string{"a", "b", "d", "f", "g", "h"}, nil, nil, nil, nil},
+	{"expressions", `{{ -a + b * c ~ "x" if not d else [e, (f, g), {h: i}][j:k] }}`, []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}, nil, nil, nil, nil},
+	{"filters and tests", `{{ a | default(b) | upper }}{{ c is divisibleby(d) }}`, []string{"a", "b", "c", "d"}, nil, nil, []string{"default", "upper"}, []string{"divisibleby"}},
+	{"set before use", `{% set a = b %}{{ a }}`, []string{"b"}, nil, nil, nil, nil},
+	{"use before set", `{{ a }}{% set a = 1 %}`, []string{"a"}, nil, nil, nil, nil},
+	{"set does not leak from bodies", `{% if a %}{% set b = 1 %}{{ b }}{% endif %}{{ b }}`, []string{"a", "b"}, nil, nil, nil, nil},
+	{"for loop", `{% for k, v in items if k != skip %}{{ k }}{{ v }}{{ loop.index }}{{ other }}{% else %}{{ k }}{% endfor %}`, []string{"items", "k", "other", "skip"}, nil, nil, nil, nil},
+	{"with", `{% with a = b %}{{ a }}{{ c }}{% endwith %}{{ a }}`, []string{"a", "b", "c"}, nil, nil, nil, nil},
+	{"macro", `{% macro m(x, y=z) %}{{ x }}{{ y }}{{ w }}{% endmacro %}{{ m(1) }}`, []string{"w", "z"}, nil, nil, nil, nil},
+	{"filter statement", `{% filter upper | replace(a, "b") %}{{ c }}{% endfilter %}`, []string{"a", "c"}, nil, nil, []string{"replace", "upper"}, nil},
+	{"self is provided", `{{ self }}`, []string{}, nil, nil, nil, nil},
+	{"include", `{% include "missing.tpl" ignore missing %}{% include name %}`, []string{"name"}, []string{"missing.tpl"}, []string{"name"}, nil, nil},
+	{"import", `{% import "macro.helper" as helper %}{% from "macro.helper" import imported_macro as im %}{{ helper.imported_macro_void() }}{{ im(a) }}`, []string{"a"}, []string{"macro.helper"}, nil, nil, nil},
+	{"extends and blocks", `{% extends "inheritance/inheritance2/skeleton.tpl" %}{% block body %}{{ a }}{% endblock %}`, []string{"a"}, []string{"inheritance/inheritance2/skeleton.tpl"}, nil, nil, nil},
+	{"block super", `{% block b %}{{ super() }}{{ a }}{% endblock %}`, []string{"a"}, nil, nil, nil, nil},
+}
+
+func TestAnalyze(t *testing.T) {
+	loader := loaders.MustNewFileSystemLoader("../integration/testdata")
+	env := gonja.NewEnvironment(config.NewConfig(), loader)
+	for _, tc := range analysisCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			tpl, err := env.FromString(test.source)
+			if !assert.NoError(err) {
+				return
+			}
+			result := analysis.Analyze(tpl.Root)
+			assert.Equal(test.variables, result.Variables, "variables")
+			assert.Equal(orEmpty(test.templates), result.Templates, "templates")
+			dynamic := []string{}
+			for _, expr := range result.DynamicTemplates {
+				dynamic = append(dynamic, expr.String())
+			}
+			assert.Equal(orEmpty(test.dynamic), dynamic, "dynamic templates")
+			assert.Equal(orEmpty(test.filters), result.Filters, "filters")
+			assert.Equal(orEmpty(test.tests), result.Tests, "tests")
+		})
+	}
+}
+
+func orEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
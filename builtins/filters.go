@@ -26,31 +26,32 @@ import (
 	"github.com/MarioJim/gonja/utils"
 )
 
-// Filters export all builtin filters
+// Filters export all builtin filters, the ones declared with exec.Pure are
+// applied to literals when optimizing templates
 var Filters = exec.FilterSet{
-	"abs":            filterAbs,
+	"abs":            exec.Pure(filterAbs),
 	"add":            filterAdd,
 	"append":         filterAppend,
 	"attr":           filterAttr,
 	"basename":       filterBasename,
 	"batch":          filterBatch,
-	"bool":           filterBool,
-	"capitalize":     filterCapitalize,
-	"center":         filterCenter,
+	"bool":           exec.Pure(filterBool),
+	"capitalize":     exec.Pure(filterCapitalize),
+	"center":         exec.Pure(filterCenter),
 	"concat":         filterConcat,
-	"default":        filterDefault,
-	"d":              filterDefault,
+	"default":        exec.Pure(filterDefault),
+	"d":              exec.Pure(filterDefault),
 	"dictsort":       filterDictSort,
 	"dir":            filterDir,
-	"e":              filterEscape,
-	"escape":         filterEscape,
+	"e":              exec.Pure(filterEscape),
+	"escape":         exec.Pure(filterEscape),
 	"fail":           filterFail,
 	"file":           filterFile,
-	"filesizeformat": filterFileSize,
-	"first":          filterFirst,
+	"filesizeformat": exec.Pure(filterFileSize),
+	"first":          exec.Pure(filterFirst),
 	"flatten":        filterFlatten,
-	"float":          filterFloat,
-	"forceescape":    filterForceEscape,
+	"float":          exec.Pure(filterFloat),
+	"forceescape":    exec.Pure(filterForceEscape),
 	"format":         filterFormat,
 	"fromjson":       filterFromJSON,
 	"fromyaml":       filterFromYAML,
@@ -58,15 +59,15 @@ var Filters = exec.FilterSet{
 	"get":            filterGet,
 	"groupby":        filterGroupBy,
 	"ifelse":         filterIfElse,
-	"indent":         filterIndent,
+	"indent":         exec.Pure(filterIndent),
 	"insert":         filterInsert,
-	"int":            filterInteger,
+	"int":            exec.Pure(filterInteger),
 	"join":           filterJoin,
 	"keys":           filterKeys,
-	"last":           filterLast,
-	"length":         filterLength,
-	"list":           filterList,
-	"lower":          filterLower,
+	"last":           exec.Pure(filterLast),
+	"length":         exec.Pure(filterLength),
+	"list":           exec.Pure(filterList),
+	"lower":          exec.Pure(filterLower),
 	"map":            filterMap,
 	"match":          filterMatch,
 	"max":            filterMax,
@@ -77,32 +78,32 @@ var Filters = exec.FilterSet{
 	"rejectattr":     filterRejectAttr,
 	"reject":         filterReject,
 	"replace":        filterReplace,
-	"reverse":        filterReverse,
-	"round":          filterRound,
-	"safe":           filterSafe,
+	"reverse":        exec.Pure(filterReverse),
+	"round":          exec.Pure(filterRound),
+	"safe":           exec.Pure(filterSafe),
 	"selectattr":     filterSelectAttr,
 	"select":         filterSelect,
 	"slice":          filterSlice,
 	"sort":           filterSort,
-	"split":          filterSplit,
-	"string":         filterString,
-	"striptags":      filterStriptags,
-	"sum":            filterSum,
-	"title":          filterTitle,
+	"split":          exec.Pure(filterSplit),
+	"string":         exec.Pure(filterString),
+	"striptags":      exec.Pure(filterStriptags),
+	"sum":            exec.Pure(filterSum),
+	"title":          exec.Pure(filterTitle),
 	"tojson":         filterToJSON,
 	"totoml":         filterToToml,
 	"toyaml":         filterToYAML,
-	"trim":           filterTrim,
+	"trim":           exec.Pure(filterTrim),
 	"truncate":       filterTruncate,
 	"try":            filterTry,
-	"unique":         filterUnique,
+	"unique":         exec.Pure(filterUnique),
 	"unset":          filterUnset,
-	"upper":          filterUpper,
-	"urlencode":      filterUrlencode,
+	"upper":          exec.Pure(filterUpper),
+	"urlencode":      exec.Pure(filterUrlencode),
 	"urlize":         filterUrlize,
 	"values":         filterValues,
-	"wordcount":      filterWordcount,
-	"wordwrap":       filterWordwrap,
+	"wordcount":      exec.Pure(filterWordcount),
+	"wordwrap":       exec.Pure(filterWordwrap),
 	"xmlattr":        filterXMLAttr,
 }
 
@@ -183,7 +184,7 @@ func filterCapitalize(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *
 	}
 	t := in.String()
 	r, size := utf8.DecodeRuneInString(t)
-	return exec.AsValue(strings.ToUpper(string(r)) + strings.ToLower(t[size:]))
+	return exec.AsValueLike(in, strings.ToUpper(string(r))+strings.ToLower(t[size:]))
 }
 
 func filterCenter(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -204,7 +205,7 @@ func filterCenter(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec
 	left := spaces/2 + spaces%2
 	right := spaces / 2
 
-	return exec.AsValue(fmt.Sprintf("%s%s%s", strings.Repeat(" ", left),
+	return exec.AsValueLike(in, fmt.Sprintf("%s%s%s", strings.Repeat(" ", left),
 		in.String(), strings.Repeat(" ", right)))
 }
 
@@ -335,6 +336,13 @@ func filterFirst(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.
 	if p := params.ExpectNothing(); p.IsError() {
 		return exec.AsValue(errors.Wrap(p, "Wrong signature for 'first'"))
 	}
+	if in.IsLazy() {
+		// Only the first item is pulled
+		for item := range in.All() {
+			return item
+		}
+		return exec.AsValue("")
+	}
 	if in.CanSlice() && in.Len() > 0 {
 		return in.Index(0)
 	}
@@ -365,11 +373,17 @@ func filterFormat(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec
 	if in.IsError() {
 		return in
 	}
+	// A safe format string escapes its unsafe string arguments
+	markup := e.Autoescape && in.Safe
 	args := []any{}
 	for _, arg := range params.Args {
-		args = append(args, arg.Interface())
+		if markup && arg.IsString() {
+			args = append(args, arg.Markup())
+		} else {
+			args = append(args, arg.Interface())
+		}
 	}
-	return exec.AsValue(fmt.Sprintf(in.String(), args...))
+	return exec.AsValueLike(in, fmt.Sprintf(in.String(), args...))
 }
 
 func filterGroupBy(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -440,7 +454,7 @@ func filterIndent(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec
 		out.WriteString(line)
 		out.WriteByte('\n')
 	}
-	return exec.AsValue(out.String())
+	return exec.AsValueLike(in, out.String())
 }
 
 func filterInteger(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -508,15 +522,21 @@ func filterJoin(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.V
 	if p.IsError() {
 		return exec.AsValue(errors.Wrap(p, "Wrong signature for 'join'"))
 	}
+	if in.IsLazy() {
+		items := []*exec.Value{}
+		for item := range in.All() {
+			items = append(items, item)
+		}
+		return e.MarkupJoin(p.KwArgs["d"], items...)
+	}
 	if !in.CanSlice() {
 		return in
 	}
-	sep := p.KwArgs["d"].String()
-	sl := make([]string, 0, in.Len())
+	items := make([]*exec.Value, 0, in.Len())
 	for i := 0; i < in.Len(); i++ {
-		sl = append(sl, in.Index(i).String())
+		items = append(items, exec.ToValue(in.Index(i).Val))
 	}
-	return exec.AsValue(strings.Join(sl, sep))
+	return e.MarkupJoin(p.KwArgs["d"], items...)
 }
 
 func filterLast(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -526,6 +546,13 @@ func filterLast(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.V
 	if p := params.ExpectNothing(); p.IsError() {
 		return exec.AsValue(errors.Wrap(p, "Wrong signature for 'last'"))
 	}
+	if in.IsLazy() {
+		last := exec.AsValue("")
+		for item := range in.All() {
+			last = item
+		}
+		return last
+	}
 	if in.CanSlice() && in.Len() > 0 {
 		return in.Index(in.Len() - 1)
 	}
@@ -571,7 +598,7 @@ func filterLower(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.
 	if p := params.ExpectNothing(); p.IsError() {
 		return exec.AsValue(errors.Wrap(p, "Wrong signature for 'lower'"))
 	}
-	return exec.AsValue(strings.ToLower(in.String()))
+	return exec.AsValueLike(in, strings.ToLower(in.String()))
 }
 
 func filterMap(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -743,6 +770,16 @@ func filterRandom(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec
 	if p := params.ExpectNothing(); p.IsError() {
 		return exec.AsValue(errors.Wrap(p, "Wrong signature for 'random'"))
 	}
+	if in.IsLazy() {
+		items := []*exec.Value{}
+		for item := range in.All() {
+			items = append(items, item)
+		}
+		if len(items) == 0 {
+			return exec.AsValue("")
+		}
+		return items[rand.Intn(len(items))]
+	}
 	if !in.CanSlice() || in.Len() <= 0 {
 		return in
 	}
@@ -849,11 +886,22 @@ func filterReplace(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exe
 	}
 	old := p.Args[0].String()
 	new := p.Args[1].String()
+	if e.Autoescape {
+		// Replacing with safe values escapes the input first, and
+		// replacements in a safe input are escaped
+		if !in.Safe && (p.Args[0].Safe || p.Args[1].Safe) {
+			in = exec.AsSafeValue(in.Escaped())
+		}
+		if in.Safe {
+			old = p.Args[0].Markup()
+			new = p.Args[1].Markup()
+		}
+	}
 	count := p.KwArgs["count"]
 	if count.IsNil() {
-		return exec.AsValue(strings.ReplaceAll(in.String(), old, new))
+		return exec.AsValueLike(in, strings.ReplaceAll(in.String(), old, new))
 	}
-	return exec.AsValue(strings.Replace(in.String(), old, new, count.Integer()))
+	return exec.AsValueLike(in, strings.Replace(in.String(), old, new, count.Integer()))
 }
 
 func filterReverse(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -1086,7 +1134,7 @@ func filterTitle(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.
 		return exec.AsValue("")
 	}
 	titleCaser := cases.Title(language.English)
-	return exec.AsValue(titleCaser.String(in.String()))
+	return exec.AsValueLike(in, titleCaser.String(in.String()))
 }
 
 func filterTrim(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -1099,7 +1147,7 @@ func filterTrim(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.V
 		return exec.AsValue(errors.Wrap(p, "Wrong signature for 'trim'"))
 	}
 	chars := p.GetKwarg(charsParam.Name, charsParam.Default).String()
-	return exec.AsValue(strings.Trim(in.String(), chars))
+	return exec.AsValueLike(in, strings.Trim(in.String(), chars))
 }
 
 func filterToJSON(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -1167,6 +1215,9 @@ func filterTruncate(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *ex
 	leeway := p.KwArgs["leeway"].Integer()
 	killwords := p.KwArgs["killwords"].Bool()
 	end := p.KwArgs["end"].String()
+	if e.Autoescape && in.Safe {
+		end = p.KwArgs["end"].Markup()
+	}
 	rEnd := []rune(end)
 	fullLength := length + leeway
 	runes := []rune(source)
@@ -1176,7 +1227,7 @@ func filterTruncate(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *ex
 	}
 
 	if len(runes) <= fullLength {
-		return exec.AsValue(source)
+		return exec.AsValueLike(in, source)
 	}
 
 	atLength := string(runes[:length-len(rEnd)])
@@ -1186,7 +1237,7 @@ func filterTruncate(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *ex
 		})
 		atLength = strings.TrimRight(atLength, " \n\t")
 	}
-	return exec.AsValue(fmt.Sprintf("%s%s", atLength, end))
+	return exec.AsValueLike(in, fmt.Sprintf("%s%s", atLength, end))
 }
 
 func filterUnique(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -1240,7 +1291,7 @@ func filterUpper(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.
 	if p := params.ExpectNothing(); p.IsError() {
 		return exec.AsValue(errors.Wrap(p, "Wrong signature for 'upper'"))
 	}
-	return exec.AsValue(strings.ToUpper(in.String()))
+	return exec.AsValueLike(in, strings.ToUpper(in.String()))
 }
 
 func filterUrlencode(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
@@ -1484,7 +1535,11 @@ func filterTry(e *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Va
 		return exec.AsValue(errors.Wrap(p, "Wrong signature for 'try'"))
 	}
 	if in == nil || in.IsError() || !in.IsTrue() {
-		return exec.AsValue(nil)
+		hint := "value is empty"
+		if in != nil && in.IsError() {
+			hint = in.Error()
+		}
+		return e.UndefinedValue(hint)
 	}
 	return in
 }
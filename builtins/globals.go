@@ -1,6 +1,8 @@
 package builtins
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 
 	"github.com/MarioJim/gonja/exec"
@@ -16,35 +18,49 @@ var Globals = exec.NewContext(map[string]any{
 	"range":     Range,
 })
 
-func Range(va *exec.VarArgs) <-chan int {
-	var (
-		start = 0
-		stop  = -1
-		step  = 1
-	)
+func Range(va *exec.VarArgs) *Sequence {
+	seq := &Sequence{Stop: -1, Step: 1}
 	switch len(va.Args) {
 	case 1:
-		stop = va.Args[0].Integer()
+		seq.Stop = va.Args[0].Integer()
 	case 2:
-		start = va.Args[0].Integer()
-		stop = va.Args[1].Integer()
+		seq.Start = va.Args[0].Integer()
+		seq.Stop = va.Args[1].Integer()
 	case 3:
-		start = va.Args[0].Integer()
-		stop = va.Args[1].Integer()
-		step = va.Args[2].Integer()
+		seq.Start = va.Args[0].Integer()
+		seq.Stop = va.Args[1].Integer()
+		seq.Step = va.Args[2].Integer()
 		// default:
 		// 	return nil, errors.New("range expect signature range([start, ]stop[, step])")
 	}
-	chnl := make(chan int)
-	go func() {
-		for i := start; i < stop; i += step {
-			chnl <- i
+	return seq
+}
+
+// Sequence is the sequence of integers returned by range, computed lazily
+type Sequence struct {
+	Start, Stop, Step int
+}
+
+func (seq *Sequence) Iterate(yield func(key, value any) bool) {
+	for i := 0; i < seq.Len(); i++ {
+		if !yield(seq.Start+i*seq.Step, nil) {
+			return
 		}
+	}
+}
+
+func (seq *Sequence) Len() int {
+	switch {
+	case seq.Step > 0 && seq.Start < seq.Stop:
+		return (seq.Stop - seq.Start + seq.Step - 1) / seq.Step
+	case seq.Step < 0 && seq.Start > seq.Stop:
+		return (seq.Start - seq.Stop - seq.Step - 1) / -seq.Step
+	}
+	return 0
+}
 
-		// Ensure that at the end of the loop we close the channel!
-		close(chnl)
-	}()
-	return chnl
+func (seq *Sequence) String() string {
+	return fmt.Sprintf("range(%d, %d, %d)", seq.Start, seq.Stop, seq.Step)
 }
 
 func Dict(va *exec.VarArgs) *exec.Value {
@@ -3,6 +3,8 @@ package statements
 import (
 	"fmt"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -32,6 +34,27 @@ func (stmt *AutoescapeStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock)
 	return nil
 }
 
+func (stmt *AutoescapeStmt) Analyze(a *analysis.Analyzer) {
+	a.Wrapper(stmt.Wrapper)
+}
+
+func (stmt *AutoescapeStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nil, stmt.Wrapper)
+}
+
+func (stmt *AutoescapeStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	stmt.Wrapper = nodes.ReplaceWrapper(stmt.Wrapper, fn)
+}
+
+func (stmt *AutoescapeStmt) Encode(e *bundle.Encoder) {
+	e.Wrapper(stmt.Wrapper)
+	e.Bool(stmt.Autoescape)
+}
+
+func decodeAutoescape(d *bundle.Decoder) nodes.Statement {
+	return &AutoescapeStmt{Wrapper: d.Wrapper(), Autoescape: d.Bool()}
+}
+
 func autoescapeParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &AutoescapeStmt{}
 
@@ -62,4 +85,5 @@ func autoescapeParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, e
 
 func init() {
 	All.Register("autoescape", autoescapeParser)
+	bundle.RegisterStatement("autoescape", decodeAutoescape)
 }
@@ -6,6 +6,8 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -15,6 +17,7 @@ import (
 type BlockStmt struct {
 	Location *tokens.Token
 	Name     string
+	Wrapper  *nodes.Wrapper
 }
 
 func (stmt *BlockStmt) Position() *tokens.Token { return stmt.Location }
@@ -32,6 +35,7 @@ func (stmt *BlockStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) erro
 	}
 
 	sub := r.Inherit()
+	sub.Current = blockTemplate(r.Root, stmt.Name, block)
 	infos := &BlockInfos{Block: stmt, Renderer: sub, Blocks: blocks}
 
 	sub.Ctx.Set("super", infos.super)
@@ -59,6 +63,7 @@ func (bi *BlockInfos) super() string {
 	r := bi.Renderer
 	block, blocks := bi.Blocks[0], bi.Blocks[1:]
 	sub := r.Inherit()
+	sub.Current = blockTemplate(r.Root, bi.Block.Name, block)
 	var out strings.Builder
 	sub.Out = &out
 	infos := &BlockInfos{
@@ -72,6 +77,45 @@ func (bi *BlockInfos) super() string {
 	return out.String()
 }
 
+// blockTemplate returns the template defining the block, from root or its parents
+func blockTemplate(root *nodes.Template, name string, block *nodes.Wrapper) *nodes.Template {
+	for tpl := root; tpl != nil; tpl = tpl.Parent {
+		if tpl.Blocks[name] == block {
+			return tpl
+		}
+	}
+	return root
+}
+
+func (stmt *BlockStmt) Analyze(a *analysis.Analyzer) {
+	a.Scope(func() {
+		a.Declare("super")
+		a.Block(stmt.Name)
+	})
+}
+
+func (stmt *BlockStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nil, stmt.Wrapper)
+}
+
+// ReplaceChildren updates the block body in place, as it is shared
+// with the template blocks
+func (stmt *BlockStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	if wrapper := nodes.ReplaceWrapper(stmt.Wrapper, fn); wrapper != stmt.Wrapper {
+		*stmt.Wrapper = *wrapper
+	}
+}
+
+func (stmt *BlockStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.Location)
+	e.String(stmt.Name)
+	e.Wrapper(stmt.Wrapper)
+}
+
+func decodeBlock(d *bundle.Decoder) nodes.Statement {
+	return &BlockStmt{Location: d.Token(), Name: d.String(), Wrapper: d.Wrapper()}
+}
+
 func blockParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	block := &BlockStmt{
 		Location: p.Current(),
@@ -114,9 +158,11 @@ func blockParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error)
 	}
 
 	block.Name = name.Val
+	block.Wrapper = wrapper
 	return block, nil
 }
 
 func init() {
 	All.Register("block", blockParser)
+	bundle.RegisterStatement("block", decodeBlock)
 }
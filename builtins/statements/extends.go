@@ -3,8 +3,8 @@ package statements
 import (
 	"fmt"
 
-	"github.com/pkg/errors"
-
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -27,6 +27,23 @@ func (node *ExtendsStmt) Execute(r *exec.Renderer) error {
 	return nil
 }
 
+func (stmt *ExtendsStmt) Analyze(a *analysis.Analyzer) {
+	a.Template(stmt.Filename)
+}
+
+func (stmt *ExtendsStmt) Children() []nodes.Node                         { return nil }
+func (stmt *ExtendsStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {}
+
+func (stmt *ExtendsStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.Location)
+	e.String(stmt.Filename)
+	e.Bool(stmt.WithContext)
+}
+
+func decodeExtends(d *bundle.Decoder) nodes.Statement {
+	return &ExtendsStmt{Location: d.Token(), Filename: d.String(), WithContext: d.Bool()}
+}
+
 func extendsParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &ExtendsStmt{
 		Location: p.Current(),
@@ -44,7 +61,7 @@ func extendsParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, erro
 		stmt.Filename = filename.Val
 		tpl, err := p.TemplateParser(stmt.Filename)
 		if err != nil {
-			return nil, errors.Wrapf(err, `Unable to parse parent template '%s'`, stmt.Filename)
+			return nil, args.LoadError(err, "extends", stmt.Filename, nil)
 		}
 		p.Template.Parent = tpl
 	} else {
@@ -68,4 +85,5 @@ func extendsParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, erro
 
 func init() {
 	All.Register("extends", extendsParser)
+	bundle.RegisterStatement("extends", decodeExtends)
 }
@@ -6,6 +6,8 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -49,6 +51,37 @@ func (node *FilterStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) err
 	return err
 }
 
+func (node *FilterStmt) Analyze(a *analysis.Analyzer) {
+	a.Filters(node.filterChain)
+	a.Wrapper(node.bodyWrapper)
+}
+
+func (node *FilterStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nodes.AppendFilters(nil, node.filterChain), node.bodyWrapper)
+}
+
+func (node *FilterStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	nodes.ReplaceFilters(node.filterChain, fn)
+	node.bodyWrapper = nodes.ReplaceWrapper(node.bodyWrapper, fn)
+}
+
+func (stmt *FilterStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.position)
+	e.Wrapper(stmt.bodyWrapper)
+	e.Len(len(stmt.filterChain))
+	for _, call := range stmt.filterChain {
+		e.FilterCall(call)
+	}
+}
+
+func decodeFilter(d *bundle.Decoder) nodes.Statement {
+	stmt := &FilterStmt{position: d.Token(), bodyWrapper: d.Wrapper()}
+	for i, n := 0, d.Len(); i < n; i++ {
+		stmt.filterChain = append(stmt.filterChain, d.FilterCall())
+	}
+	return stmt
+}
+
 func filterParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &FilterStmt{
 		position: p.Current(),
@@ -82,4 +115,5 @@ func filterParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error
 
 func init() {
 	All.Register("filter", filterParser)
+	bundle.RegisterStatement("filter", decodeFilter)
 }
@@ -2,8 +2,11 @@ package statements
 
 import (
 	"fmt"
+	"iter"
 	"math"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -27,19 +30,62 @@ func (stmt *ForStmt) String() string {
 }
 
 type LoopInfos struct {
-	index      int
-	index0     int
-	revindex   int
-	revindex0  int
-	first      bool
-	last       bool
+	Index      int  `gonja:"index"`
+	Index0     int  `gonja:"index0"`
+	First      bool `gonja:"first"`
 	PrevItem   *exec.Value
-	NextItem   *exec.Value
+	items      *loopItems
 	_lastValue *exec.Value
 }
 
+// Getattr computes the loop variables looking ahead, pulling the next items
+// only when they are used
+func (li *LoopInfos) Getattr(name string) (any, bool) {
+	switch name {
+	case "last":
+		return li.Last(), true
+	case "length":
+		return li.Length(), true
+	case "revindex":
+		return li.Revindex(), true
+	case "revindex0":
+		return li.Revindex0(), true
+	case "NextItem":
+		return li.NextItem(), true
+	}
+	return nil, false
+}
+
+// Last checks whether the current item is the last one, pulling the next one
+func (li *LoopInfos) Last() bool {
+	_, ok := li.items.peek()
+	return !ok
+}
+
+// Length returns the number of items, pulling all of them
+func (li *LoopInfos) Length() int {
+	return li.Index + li.items.remaining()
+}
+
+func (li *LoopInfos) Revindex() int {
+	return li.Length() - li.Index0
+}
+
+func (li *LoopInfos) Revindex0() int {
+	return li.Length() - li.Index
+}
+
+// NextItem returns the next item, pulling it
+func (li *LoopInfos) NextItem() *exec.Value {
+	pair, ok := li.items.peek()
+	if !ok {
+		return exec.AsValue(nil)
+	}
+	return pairItem(pair)
+}
+
 func (li *LoopInfos) Cycle(va *exec.VarArgs) *exec.Value {
-	return va.Args[int(math.Mod(float64(li.index0), float64(len(va.Args))))]
+	return va.Args[int(math.Mod(float64(li.Index0), float64(len(va.Args))))]
 }
 
 func (li *LoopInfos) Changed(value *exec.Value) bool {
@@ -48,65 +94,96 @@ func (li *LoopInfos) Changed(value *exec.Value) bool {
 	return !same
 }
 
-func (node *ForStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) (forError error) {
+// loopItems pulls the items of a loop, buffering the ones looked ahead
+type loopItems struct {
+	pull   func() (*exec.Pair, bool)
+	buffer []*exec.Pair
+}
+
+// next returns the next item
+func (items *loopItems) next() (*exec.Pair, bool) {
+	if len(items.buffer) > 0 {
+		pair := items.buffer[0]
+		items.buffer = items.buffer[1:]
+		return pair, true
+	}
+	return items.pull()
+}
+
+// peek returns the next item, leaving it to be returned by next
+func (items *loopItems) peek() (*exec.Pair, bool) {
+	if len(items.buffer) == 0 {
+		pair, ok := items.pull()
+		if !ok {
+			return nil, false
+		}
+		items.buffer = append(items.buffer, pair)
+	}
+	return items.buffer[0], true
+}
+
+// remaining returns the number of items left, pulling all of them
+func (items *loopItems) remaining() int {
+	for {
+		pair, ok := items.pull()
+		if !ok {
+			return len(items.buffer)
+		}
+		items.buffer = append(items.buffer, pair)
+	}
+}
+
+// pairItem returns the item of a pair, as a 2-tuple for mappings
+func pairItem(pair *exec.Pair) *exec.Value {
+	if pair.Value != nil {
+		return exec.AsValue([2]*exec.Value{pair.Key, pair.Value})
+	}
+	return pair.Key
+}
+
+func (node *ForStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) error {
 	obj := r.Eval(node.objectEvaluator)
 	if obj.IsError() {
 		return obj
 	}
 
-	// Create loop struct
-	items := exec.NewDict()
-
-	// First iteration: filter values to ensure proper LoopInfos
-	obj.Iterate(func(idx, count int, key, value *exec.Value) bool {
-		sub := r.Inherit()
-		ctx := sub.Ctx
-		pair := &exec.Pair{}
-
-		// There's something to iterate over (correct type and at least 1 item)
-		// Update loop infos and public context
-		if node.value != "" && !key.IsString() && key.Len() == 2 {
-			key.Iterate(func(idx, count int, key, value *exec.Value) bool {
-				switch idx {
-				case 0:
-					ctx.Set(node.key, key)
-					pair.Key = key
-				case 1:
-					ctx.Set(node.value, key)
-					pair.Value = key
-				}
-				return true
-			}, func() {})
-		} else {
-			ctx.Set(node.key, key)
-			pair.Key = key
-			if value != nil {
-				ctx.Set(node.value, value)
-				pair.Value = value
+	// Items are pulled one at a time, so that lazy values are never
+	// materialized unless the loop looks ahead
+	next, stop := iter.Pull2(obj.All())
+	defer stop()
+	items := &loopItems{pull: func() (*exec.Pair, bool) {
+		for {
+			key, value, ok := next()
+			if !ok {
+				return nil, false
 			}
-		}
-
-		if node.ifCondition != nil {
-			if !sub.Eval(node.ifCondition).IsTrue() {
-				return true
+			pair := node.pair(key, value)
+			if node.ifCondition != nil {
+				sub := r.Inherit()
+				sub.Ctx.Set(node.key, pair.Key)
+				if pair.Value != nil {
+					sub.Ctx.Set(node.value, pair.Value)
+				}
+				if !sub.Eval(node.ifCondition).IsTrue() {
+					continue
+				}
 			}
+			return pair, true
 		}
-		items.Pairs = append(items.Pairs, pair)
-		return true
-	}, func() {})
+	}}
 
-	// 2nd pass: all values are defined, render
-	length := len(items.Pairs)
 	loop := &LoopInfos{
-		first:  true,
-		index0: -1,
+		First:    true,
+		Index0:   -1,
+		PrevItem: exec.AsValue(nil),
+		items:    items,
 	}
-	if len(items.Pairs) == 0 && node.emptyWrapper != nil {
-		if err := r.Inherit().ExecuteWrapper(node.emptyWrapper); err != nil {
-			return err
+	var previous *exec.Pair
+	for {
+		pair, ok := items.next()
+		if !ok {
+			break
 		}
-	}
-	for idx, pair := range items.Pairs {
 		sub := r.Inherit()
 		ctx := sub.Ctx
 
@@ -116,38 +193,13 @@ func (node *ForStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) (forEr
 		}
 
 		ctx.Set("loop", loop)
-		loop.index0 = idx
-		loop.index = loop.index0 + 1
-		if idx == 1 {
-			loop.first = false
-		}
-		if idx+1 == length {
-			loop.last = true
-		}
-		loop.revindex = length - idx
-		loop.revindex0 = length - (idx + 1)
-
-		if idx == 0 {
-			loop.PrevItem = exec.AsValue(nil)
-		} else {
-			pp := items.Pairs[idx-1]
-			if pp.Value != nil {
-				loop.PrevItem = exec.AsValue([2]*exec.Value{pp.Key, pp.Value})
-			} else {
-				loop.PrevItem = pp.Key
-			}
-		}
-
-		if idx == length-1 {
-			loop.NextItem = exec.AsValue(nil)
-		} else {
-			np := items.Pairs[idx+1]
-			if np.Value != nil {
-				loop.NextItem = exec.AsValue([2]*exec.Value{np.Key, np.Value})
-			} else {
-				loop.NextItem = np.Key
-			}
+		loop.Index0++
+		loop.Index = loop.Index0 + 1
+		loop.First = loop.Index0 == 0
+		if previous != nil {
+			loop.PrevItem = pairItem(previous)
 		}
+		previous = pair
 
 		// Render elements with updated context
 		err := sub.ExecuteWrapper(node.bodyWrapper)
@@ -156,7 +208,74 @@ func (node *ForStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) (forEr
 		}
 	}
 
-	return forError
+	if previous == nil && node.emptyWrapper != nil {
+		if err := r.Inherit().ExecuteWrapper(node.emptyWrapper); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pair returns the loop variables of an item, unpacking 2-item sequences
+// when the loop has two of them
+func (node *ForStmt) pair(key, value *exec.Value) *exec.Pair {
+	pair := &exec.Pair{Key: key, Value: value}
+	if node.value != "" && value == nil && !key.IsString() && key.Len() == 2 {
+		key.Iterate(func(idx, count int, item, _ *exec.Value) bool {
+			switch idx {
+			case 0:
+				pair.Key = item
+			case 1:
+				pair.Value = item
+			}
+			return true
+		}, func() {})
+	}
+	return pair
+}
+
+func (node *ForStmt) Analyze(a *analysis.Analyzer) {
+	a.Expression(node.objectEvaluator)
+	a.Loop(func() {
+		a.Declare(node.key, "loop")
+		if node.value != "" {
+			a.Declare(node.value)
+		}
+		a.Expression(node.ifCondition)
+		a.Wrapper(node.bodyWrapper)
+	})
+	a.Wrapper(node.emptyWrapper)
+}
+
+func (node *ForStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nil, node.objectEvaluator, node.ifCondition, node.bodyWrapper, node.emptyWrapper)
+}
+
+func (node *ForStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	node.objectEvaluator = nodes.ReplaceExpression(node.objectEvaluator, fn)
+	node.ifCondition = nodes.ReplaceExpression(node.ifCondition, fn)
+	node.bodyWrapper = nodes.ReplaceWrapper(node.bodyWrapper, fn)
+	node.emptyWrapper = nodes.ReplaceWrapper(node.emptyWrapper, fn)
+}
+
+func (stmt *ForStmt) Encode(e *bundle.Encoder) {
+	e.String(stmt.key)
+	e.String(stmt.value)
+	e.Expression(stmt.objectEvaluator)
+	e.Expression(stmt.ifCondition)
+	e.Wrapper(stmt.bodyWrapper)
+	e.Wrapper(stmt.emptyWrapper)
+}
+
+func decodeFor(d *bundle.Decoder) nodes.Statement {
+	return &ForStmt{
+		key:             d.String(),
+		value:           d.String(),
+		objectEvaluator: d.Expression(),
+		ifCondition:     d.Expression(),
+		bodyWrapper:     d.Wrapper(),
+		emptyWrapper:    d.Wrapper(),
+	}
 }
 
 func forParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
@@ -181,7 +300,7 @@ func forParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 		return nil, args.Error("Expected keyword 'in'.", nil)
 	}
 
-	objectEvaluator, err := args.ParseExpression()
+	objectEvaluator, err := args.ParseSimpleExpression()
 	if err != nil {
 		return nil, err
 	}
@@ -232,4 +351,5 @@ func forParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 
 func init() {
 	All.Register("for", forParser)
+	bundle.RegisterStatement("for", decodeFor)
 }
@@ -5,6 +5,8 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -41,6 +43,89 @@ func (node *IfStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) error {
 	return nil
 }
 
+func (node *IfStmt) Analyze(a *analysis.Analyzer) {
+	a.Branches(node.conditions, node.wrappers)
+}
+
+// Prune drops the branches whose condition is a falsy literal, and the ones
+// following a truthy literal. Without any condition left, the taken branch
+// is inlined unless its blocks need the scope of the wrapper.
+func (node *IfStmt) Prune() ([]nodes.Node, bool) {
+	conditions := []nodes.Expression{}
+	wrappers := []*nodes.Wrapper{}
+	var taken *nodes.Wrapper
+	for idx, condition := range node.conditions {
+		if value, ok := exec.Literal(condition); ok {
+			if value.IsTrue() {
+				taken = node.wrappers[idx]
+				break
+			}
+			continue
+		}
+		conditions = append(conditions, condition)
+		wrappers = append(wrappers, node.wrappers[idx])
+	}
+	if taken == nil && len(node.wrappers) > len(node.conditions) {
+		taken = node.wrappers[len(node.wrappers)-1]
+	}
+	if taken != nil {
+		wrappers = append(wrappers, taken)
+	}
+
+	if len(conditions) > 0 {
+		node.conditions, node.wrappers = conditions, wrappers
+		return nil, false
+	}
+	if taken == nil {
+		return []nodes.Node{}, true
+	}
+	for _, child := range taken.Nodes {
+		if _, ok := child.(*nodes.StatementBlock); ok {
+			node.conditions = []nodes.Expression{&nodes.Bool{Location: node.Location, Val: true}}
+			node.wrappers = []*nodes.Wrapper{taken}
+			return nil, false
+		}
+	}
+	return taken.Nodes, true
+}
+
+func (node *IfStmt) Children() []nodes.Node {
+	children := []nodes.Node{}
+	for idx, wrapper := range node.wrappers {
+		if idx < len(node.conditions) {
+			children = nodes.AppendChildren(children, node.conditions[idx])
+		}
+		children = nodes.AppendChildren(children, wrapper)
+	}
+	return children
+}
+
+func (node *IfStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	for idx, wrapper := range node.wrappers {
+		if idx < len(node.conditions) {
+			node.conditions[idx] = nodes.ReplaceExpression(node.conditions[idx], fn)
+		}
+		node.wrappers[idx] = nodes.ReplaceWrapper(wrapper, fn)
+	}
+}
+
+func (stmt *IfStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.Location)
+	e.Expressions(stmt.conditions)
+	e.Len(len(stmt.wrappers))
+	for _, wrapper := range stmt.wrappers {
+		e.Wrapper(wrapper)
+	}
+}
+
+func decodeIf(d *bundle.Decoder) nodes.Statement {
+	stmt := &IfStmt{Location: d.Token(), conditions: d.Expressions()}
+	for i, n := 0, d.Len(); i < n; i++ {
+		stmt.wrappers = append(stmt.wrappers, d.Wrapper())
+	}
+	return stmt
+}
+
 func ifParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	log.WithFields(log.Fields{
 		"arg":     args.Current(),
@@ -97,4 +182,5 @@ func ifParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 
 func init() {
 	All.Register("if", ifParser)
+	bundle.RegisterStatement("if", decodeIf)
 }
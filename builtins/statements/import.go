@@ -5,6 +5,8 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -28,6 +30,7 @@ func (stmt *ImportStmt) String() string {
 func (stmt *ImportStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) error {
 	var imported map[string]*nodes.Macro
 	macros := map[string]exec.Macro{}
+	sub := r.Inherit()
 
 	if stmt.FilenameExpr != nil {
 		filenameValue := r.Eval(stmt.FilenameExpr)
@@ -41,13 +44,15 @@ func (stmt *ImportStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) err
 			return errors.Wrapf(err, `Unable to load template '%s'`, filename)
 		}
 		imported = tpl.Root.Macros
+		sub.Current = tpl.Root
 
 	} else {
 		imported = stmt.Template.Macros
+		sub.Current = stmt.Template
 	}
 
 	for name, macro := range imported {
-		fn, err := exec.MacroNodeToFunc(macro, r)
+		fn, err := exec.MacroNodeToFunc(macro, sub)
 		if err != nil {
 			return errors.Wrapf(err, `Unable to import macro '%s'`, name)
 		}
@@ -58,6 +63,23 @@ func (stmt *ImportStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) err
 	return nil
 }
 
+func (stmt *ImportStmt) Analyze(a *analysis.Analyzer) {
+	if stmt.FilenameExpr != nil {
+		a.DynamicTemplate(stmt.FilenameExpr)
+	} else {
+		a.Template(stmt.Filename)
+	}
+	a.Declare(stmt.As)
+}
+
+func (stmt *ImportStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nil, stmt.FilenameExpr)
+}
+
+func (stmt *ImportStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	stmt.FilenameExpr = nodes.ReplaceExpression(stmt.FilenameExpr, fn)
+}
+
 type FromImportStmt struct {
 	Location     *tokens.Token
 	Filename     string
@@ -75,6 +97,7 @@ func (stmt *FromImportStmt) String() string {
 }
 func (stmt *FromImportStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) error {
 	var imported map[string]*nodes.Macro
+	sub := r.Inherit()
 
 	if stmt.FilenameExpr != nil {
 		filenameValue := r.Eval(stmt.FilenameExpr)
@@ -88,14 +111,16 @@ func (stmt *FromImportStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock)
 			return errors.Wrapf(err, `Unable to load template '%s'`, filename)
 		}
 		imported = tpl.Root.Macros
+		sub.Current = tpl.Root
 
 	} else {
 		imported = stmt.Template.Macros
+		sub.Current = stmt.Template
 	}
 
 	for alias, name := range stmt.As {
 		node := imported[name]
-		fn, err := exec.MacroNodeToFunc(node, r)
+		fn, err := exec.MacroNodeToFunc(node, sub)
 		if err != nil {
 			return errors.Wrapf(err, `Unable to import macro '%s'`, name)
 		}
@@ -104,6 +129,71 @@ func (stmt *FromImportStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock)
 	return nil
 }
 
+func (stmt *FromImportStmt) Analyze(a *analysis.Analyzer) {
+	if stmt.FilenameExpr != nil {
+		a.DynamicTemplate(stmt.FilenameExpr)
+	} else {
+		a.Template(stmt.Filename)
+	}
+	for alias, name := range stmt.As {
+		if stmt.Template != nil && stmt.Template.Macros[name] != nil {
+			a.DeclareNode(alias, stmt.Template.Macros[name])
+		} else {
+			a.Declare(alias)
+		}
+	}
+}
+
+func (stmt *FromImportStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nil, stmt.FilenameExpr)
+}
+
+func (stmt *FromImportStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	stmt.FilenameExpr = nodes.ReplaceExpression(stmt.FilenameExpr, fn)
+}
+
+func (stmt *ImportStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.Location)
+	e.String(stmt.Filename)
+	e.Expression(stmt.FilenameExpr)
+	e.String(stmt.As)
+	e.Bool(stmt.WithContext)
+	e.Template(stmt.Template)
+}
+
+func decodeImport(d *bundle.Decoder) nodes.Statement {
+	return &ImportStmt{
+		Location:     d.Token(),
+		Filename:     d.String(),
+		FilenameExpr: d.Expression(),
+		As:           d.String(),
+		WithContext:  d.Bool(),
+		Template:     d.Template(),
+	}
+}
+
+func (stmt *FromImportStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.Location)
+	e.String(stmt.Filename)
+	e.Expression(stmt.FilenameExpr)
+	e.Bool(stmt.WithContext)
+	e.Template(stmt.Template)
+	e.StringMap(stmt.As)
+	e.MacroMap(stmt.Macros)
+}
+
+func decodeFromImport(d *bundle.Decoder) nodes.Statement {
+	return &FromImportStmt{
+		Location:     d.Token(),
+		Filename:     d.String(),
+		FilenameExpr: d.Expression(),
+		WithContext:  d.Bool(),
+		Template:     d.Template(),
+		As:           d.StringMap(),
+		Macros:       d.MacroMap(),
+	}
+}
+
 func importParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &ImportStmt{
 		Location: p.Current(),
@@ -144,7 +234,7 @@ func importParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error
 	if stmt.Filename != "" {
 		tpl, err := p.TemplateParser(stmt.Filename)
 		if err != nil {
-			return nil, errors.Wrapf(err, `Unable to parse imported template '%s'`, stmt.Filename)
+			return nil, args.LoadError(err, "import", stmt.Filename, nil)
 		} else {
 			stmt.Template = tpl
 		}
@@ -215,7 +305,7 @@ func fromParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error)
 	if stmt.Filename != "" {
 		tpl, err := p.TemplateParser(stmt.Filename)
 		if err != nil {
-			return nil, errors.Wrapf(err, `Unable to parse imported template '%s'`, stmt.Filename)
+			return nil, args.LoadError(err, "import", stmt.Filename, nil)
 		} else {
 			stmt.Template = tpl
 		}
@@ -226,5 +316,7 @@ func fromParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error)
 
 func init() {
 	All.Register("import", importParser)
+	bundle.RegisterStatement("import", decodeImport)
 	All.Register("from", fromParser)
+	bundle.RegisterStatement("from", decodeFromImport)
 }
@@ -5,6 +5,8 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -55,11 +57,49 @@ func (stmt *IncludeStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) er
 		sub.Root = stmt.Template
 	}
 
-	return sub.Execute()
+	return exec.AddFrame(sub.Execute(), "include", sub.Root.Name)
 }
 
 type IncludeEmptyStmt struct{}
 
+func (stmt *IncludeStmt) Analyze(a *analysis.Analyzer) {
+	if stmt.FilenameExpr != nil {
+		a.DynamicTemplate(stmt.FilenameExpr)
+	} else {
+		a.Template(stmt.Filename)
+	}
+}
+
+func (stmt *IncludeStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nil, stmt.FilenameExpr)
+}
+
+func (stmt *IncludeStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	stmt.FilenameExpr = nodes.ReplaceExpression(stmt.FilenameExpr, fn)
+}
+
+func (stmt *IncludeStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.Location)
+	e.String(stmt.Filename)
+	e.Expression(stmt.FilenameExpr)
+	e.Template(stmt.Template)
+	e.Bool(stmt.IgnoreMissing)
+	e.Bool(stmt.WithContext)
+	e.Bool(stmt.IsEmpty)
+}
+
+func decodeInclude(d *bundle.Decoder) nodes.Statement {
+	return &IncludeStmt{
+		Location:      d.Token(),
+		Filename:      d.String(),
+		FilenameExpr:  d.Expression(),
+		Template:      d.Template(),
+		IgnoreMissing: d.Bool(),
+		WithContext:   d.Bool(),
+		IsEmpty:       d.Bool(),
+	}
+}
+
 func includeParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &IncludeStmt{
 		Location: p.Current(),
@@ -98,7 +138,7 @@ func includeParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, erro
 			if stmt.IgnoreMissing {
 				stmt.IsEmpty = true
 			} else {
-				return nil, errors.Wrapf(err, `Unable to parse included template '%s'`, stmt.Filename)
+				return nil, args.LoadError(err, "include", stmt.Filename, nil)
 			}
 		} else {
 			stmt.Template = tpl
@@ -114,4 +154,5 @@ func includeParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, erro
 
 func init() {
 	All.Register("include", includeParser)
+	bundle.RegisterStatement("include", decodeInclude)
 }
@@ -3,6 +3,8 @@ package statements
 import (
 	"fmt"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -28,9 +30,32 @@ func (stmt *MacroStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) erro
 	return nil
 }
 
+func (stmt *MacroStmt) Analyze(a *analysis.Analyzer) {
+	a.DeclareNode(stmt.Name, stmt.Macro)
+	for _, kwarg := range stmt.Kwargs {
+		a.Expression(kwarg.Value)
+	}
+	a.Scope(func() {
+		for _, kwarg := range stmt.Kwargs {
+			if name, ok := kwarg.Key.(*nodes.String); ok {
+				a.Declare(name.Val)
+			}
+		}
+		a.Wrapper(stmt.Wrapper)
+	})
+}
+
+func (stmt *MacroStmt) Encode(e *bundle.Encoder) {
+	e.Macro(stmt.Macro)
+}
+
+func decodeMacro(d *bundle.Decoder) nodes.Statement {
+	return &MacroStmt{d.Macro()}
+}
+
 func macroParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &nodes.Macro{
-		Location: p.Current(),
+		Location: args.Current(),
 		Kwargs:   []*nodes.Pair{},
 	}
 
@@ -111,4 +136,5 @@ func macroParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error)
 
 func init() {
 	All.Register("macro", macroParser)
+	bundle.RegisterStatement("macro", decodeMacro)
 }
@@ -3,6 +3,7 @@ package statements
 import (
 	"fmt"
 
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -24,6 +25,31 @@ func (stmt *RawStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) error
 	return err
 }
 
+func (stmt *RawStmt) Children() []nodes.Node {
+	if stmt.Data == nil {
+		return nil
+	}
+	return []nodes.Node{stmt.Data}
+}
+
+func (stmt *RawStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	if stmt.Data != nil {
+		stmt.Data = fn(stmt.Data).(*nodes.Data)
+	}
+}
+
+func (stmt *RawStmt) Encode(e *bundle.Encoder) {
+	e.Node(stmt.Data)
+}
+
+func decodeRaw(d *bundle.Decoder) nodes.Statement {
+	data, ok := d.Node().(*nodes.Data)
+	if !ok {
+		d.Fail("Expected the data of a raw statement")
+	}
+	return &RawStmt{Data: data}
+}
+
 func rawParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &RawStmt{}
 
@@ -48,4 +74,5 @@ func rawParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 
 func init() {
 	All.Register("raw", rawParser)
+	bundle.RegisterStatement("raw", decodeRaw)
 }
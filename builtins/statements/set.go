@@ -3,6 +3,8 @@ package statements
 import (
 	"fmt"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -59,6 +61,37 @@ func (stmt *SetStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) error
 	return nil
 }
 
+func (stmt *SetStmt) Analyze(a *analysis.Analyzer) {
+	a.Expression(stmt.Expression)
+	switch n := stmt.Target.(type) {
+	case *nodes.Name:
+		a.Assign(n)
+	case *nodes.Getitem:
+		a.Expressions(n.Node, n.Arg)
+	default:
+		a.Expression(n)
+	}
+}
+
+func (stmt *SetStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nil, stmt.Target, stmt.Expression)
+}
+
+func (stmt *SetStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	stmt.Target = nodes.ReplaceExpression(stmt.Target, fn)
+	stmt.Expression = nodes.ReplaceExpression(stmt.Expression, fn)
+}
+
+func (stmt *SetStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.Location)
+	e.Expression(stmt.Target)
+	e.Expression(stmt.Expression)
+}
+
+func decodeSet(d *bundle.Decoder) nodes.Statement {
+	return &SetStmt{Location: d.Token(), Target: d.Expression(), Expression: d.Expression()}
+}
+
 func setParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &SetStmt{
 		Location: p.Current(),
@@ -97,4 +130,5 @@ func setParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 
 func init() {
 	All.Register("set", setParser)
+	bundle.RegisterStatement("set", decodeSet)
 }
@@ -5,6 +5,8 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
@@ -37,6 +39,37 @@ func (stmt *WithStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) error
 	return sub.ExecuteWrapper(stmt.Wrapper)
 }
 
+func (stmt *WithStmt) Analyze(a *analysis.Analyzer) {
+	for _, value := range stmt.Pairs {
+		a.Expression(value)
+	}
+	a.Scope(func() {
+		for key := range stmt.Pairs {
+			a.Declare(key)
+		}
+		a.Wrapper(stmt.Wrapper)
+	})
+}
+
+func (stmt *WithStmt) Children() []nodes.Node {
+	return nodes.AppendChildren(nodes.AppendKwargs(nil, stmt.Pairs), stmt.Wrapper)
+}
+
+func (stmt *WithStmt) ReplaceChildren(fn func(nodes.Node) nodes.Node) {
+	nodes.ReplaceKwargs(stmt.Pairs, fn)
+	stmt.Wrapper = nodes.ReplaceWrapper(stmt.Wrapper, fn)
+}
+
+func (stmt *WithStmt) Encode(e *bundle.Encoder) {
+	e.Token(stmt.Location)
+	e.Kwargs(stmt.Pairs)
+	e.Wrapper(stmt.Wrapper)
+}
+
+func decodeWith(d *bundle.Decoder) nodes.Statement {
+	return &WithStmt{Location: d.Token(), Pairs: d.Kwargs(), Wrapper: d.Wrapper()}
+}
+
 func withParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
 	stmt := &WithStmt{
 		Location: p.Current(),
@@ -81,4 +114,5 @@ func withParser(p *parser.Parser, args *parser.Parser) (nodes.Statement, error)
 
 func init() {
 	All.Register("with", withParser)
+	bundle.RegisterStatement("with", decodeWith)
 }
@@ -48,7 +48,7 @@ func testCallable(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool
 }
 
 func testDefined(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
-	return !(in.IsError() || in.IsNil()), nil
+	return !(in.IsError() || in.IsUndefined()), nil
 }
 
 func testDivisibleby(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
@@ -133,7 +133,7 @@ func testNotEqual(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool
 }
 
 func testNone(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
-	return in.IsNil(), nil
+	return in.IsNil() && !in.IsUndefined(), nil
 }
 
 func testNumber(ctx *exec.Context, in *exec.Value, params *exec.VarArgs) (bool, error) {
@@ -0,0 +1,152 @@
+// Package bundle writes parsed templates to a compact binary form, which
+// loads without lexing and parsing them again.
+//
+// Statements are written by their Encode method and read by the DecodeFunc
+// registered under their name, see RegisterStatement.
+package bundle
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/nodes"
+)
+
+// FormatVersion is the version of the binary form, bumped whenever it changes
+const FormatVersion = 1
+
+// magic starts every bundle
+const magic = "GONJA\x00"
+
+// ErrStale is returned when reading a bundle written by another version of
+// gonja or with another configuration. The templates must be precompiled again.
+var ErrStale = errors.New("Stale template bundle")
+
+type kind byte
+
+const (
+	kindNil kind = iota
+	kindData
+	kindComment
+	kindOutput
+	kindFiltered
+	kindTest
+	kindString
+	kindInteger
+	kindFloat
+	kindBool
+	kindName
+	kindNone
+	kindList
+	kindTuple
+	kindDict
+	kindCall
+	kindGetitem
+	kindSlice
+	kindGetattr
+	kindNegation
+	kindUnary
+	kindBinary
+	kindConditional
+	kindStatement
+	kindWrapper
+	kindMacro
+)
+
+// References to templates, wrappers and macros
+const (
+	refNil uint64 = iota
+	refNew
+	refFirst
+)
+
+// Statement is implemented by the statements which can be written to a bundle
+type Statement interface {
+	nodes.Statement
+	// Encode writes the fields of the statement
+	Encode(e *Encoder)
+}
+
+// DecodeFunc reads the fields of a statement written by its Encode method
+type DecodeFunc func(d *Decoder) nodes.Statement
+
+var decoders = map[string]DecodeFunc{}
+
+// RegisterStatement registers the function decoding the statements of a
+// given name. It is usually called from the init function registering the
+// statement parser.
+func RegisterStatement(name string, decode DecodeFunc) {
+	decoders[name] = decode
+}
+
+// Write writes a bundle of templates, tagged with the gonja version and the
+// configuration they were parsed with
+func Write(w io.Writer, templates []*nodes.Template, version string, cfg *config.Config) error {
+	e := newEncoder()
+	e.buf = append(e.buf, magic...)
+	e.Uint(FormatVersion)
+	e.String(version)
+	e.Uint(fingerprint(cfg))
+	e.Len(len(templates))
+	for _, tpl := range templates {
+		e.Template(tpl)
+	}
+	if err := e.Err(); err != nil {
+		return errors.Wrap(err, "Unable to write bundle")
+	}
+	_, err := w.Write(e.buf)
+	return err
+}
+
+// Read reads the templates of a bundle. A bundle written by another version
+// of gonja or with another configuration is rejected with ErrStale.
+func Read(data []byte, version string, cfg *config.Config) ([]*nodes.Template, error) {
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return nil, errors.New("Unable to read bundle: not a template bundle")
+	}
+	d := newDecoder(data)
+	d.pos = len(magic)
+	if format := d.Uint(); d.err == nil && format != FormatVersion {
+		return nil, errors.Wrapf(ErrStale, "bundle format %d, expected %d", format, FormatVersion)
+	}
+	if written := d.String(); d.err == nil && written != version {
+		return nil, errors.Wrapf(ErrStale, "bundle written by gonja %s, expected %s", written, version)
+	}
+	if d.Uint() != fingerprint(cfg) && d.err == nil {
+		return nil, errors.Wrap(ErrStale, "bundle written with another configuration")
+	}
+	templates := []*nodes.Template{}
+	for i, n := 0, d.Len(); i < n && d.err == nil; i++ {
+		tpl := d.Template()
+		if tpl == nil {
+			d.Fail("Expected a template at offset %d", d.pos)
+			break
+		}
+		templates = append(templates, tpl)
+	}
+	if d.err == nil && d.pos != len(data) {
+		d.Fail("Unexpected data at offset %d", d.pos)
+	}
+	if err := d.Err(); err != nil {
+		return nil, errors.Wrap(err, "Unable to read bundle")
+	}
+	return templates, nil
+}
+
+// fingerprint hashes the configuration options changing how templates are parsed
+func fingerprint(cfg *config.Config) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%q %q %q %q %q %q %q %q %t %t %t %q %t %t %t",
+		cfg.BlockStartString, cfg.BlockEndString,
+		cfg.VariableStartString, cfg.VariableEndString,
+		cfg.CommentStartString, cfg.CommentEndString,
+		cfg.LineStatementPrefix, cfg.LineCommentPrefix,
+		cfg.TrimBlocks, cfg.LstripBlocks, cfg.KeepTrailingNewline,
+		cfg.NewlineSequence, cfg.StrictNames, cfg.Optimize, cfg.Autoescape,
+	)
+	return h.Sum64()
+}
@@ -0,0 +1,372 @@
+package bundle
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// Decoder reads the nodes written by an Encoder. Once an error is met, it is
+// kept and zero values are read, so that decoding functions only need to
+// check Err once they are done.
+type Decoder struct {
+	data    []byte
+	pos     int
+	strings []string
+	refs    []any
+	err     error
+}
+
+func newDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Err returns the first error met while decoding
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Fail records an error, only the first one is kept
+func (d *Decoder) Fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = errors.Errorf(format, args...)
+	}
+}
+
+func (d *Decoder) truncated() {
+	d.Fail("Truncated bundle at offset %d", d.pos)
+}
+
+func (d *Decoder) Uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.truncated()
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *Decoder) Int() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.truncated()
+		return 0
+	}
+	d.pos += n
+	return int(v)
+}
+
+// Len reads the length of a slice or a map, which can't be longer than the
+// bytes left as each item takes at least one
+func (d *Decoder) Len() int {
+	n := d.Uint()
+	if n > uint64(len(d.data)-d.pos) {
+		d.truncated()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *Decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.truncated()
+		return 0
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *Decoder) Bool() bool {
+	return d.byte() != 0
+}
+
+func (d *Decoder) Float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos+8 > len(d.data) {
+		d.truncated()
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.data[d.pos:]))
+	d.pos += 8
+	return v
+}
+
+func (d *Decoder) String() string {
+	idx := d.Uint()
+	if d.err != nil {
+		return ""
+	}
+	if idx > 0 {
+		if idx > uint64(len(d.strings)) {
+			d.Fail("Unknown string %d at offset %d", idx-1, d.pos)
+			return ""
+		}
+		return d.strings[idx-1]
+	}
+	n := d.Len()
+	s := string(d.data[d.pos : d.pos+n])
+	d.pos += n
+	d.strings = append(d.strings, s)
+	return s
+}
+
+// StringMap reads a map of strings written by Encoder.StringMap
+func (d *Decoder) StringMap() map[string]string {
+	m := map[string]string{}
+	for i, n := 0, d.Len(); i < n; i++ {
+		key := d.String()
+		m[key] = d.String()
+	}
+	return m
+}
+
+func (d *Decoder) Token() *tokens.Token {
+	typ := d.Uint()
+	if typ == 0 {
+		return nil
+	}
+	return &tokens.Token{
+		Type: tokens.Type(typ - 1),
+		Val:  d.String(),
+		Pos:  d.Int(),
+		Line: d.Int(),
+		Col:  d.Int(),
+		Trim: d.Bool(),
+	}
+}
+
+// ref returns an object already read, or nil and false if its fields follow
+func (d *Decoder) ref() (any, bool) {
+	switch ref := d.Uint(); {
+	case ref == refNil:
+		return nil, true
+	case ref == refNew:
+		return nil, false
+	case ref-refFirst < uint64(len(d.refs)):
+		return d.refs[ref-refFirst], true
+	default:
+		d.Fail("Unknown reference %d at offset %d", ref-refFirst, d.pos)
+		return nil, true
+	}
+}
+
+func (d *Decoder) Template() *nodes.Template {
+	if obj, ok := d.ref(); ok {
+		tpl, ok := obj.(*nodes.Template)
+		if !ok && obj != nil {
+			d.Fail("Expected a template reference at offset %d", d.pos)
+		}
+		return tpl
+	}
+	tpl := &nodes.Template{Blocks: nodes.BlockSet{}}
+	d.refs = append(d.refs, tpl)
+	tpl.Name = d.String()
+	tpl.Source = d.String()
+	tpl.Nodes = d.Nodes()
+	for i, n := 0, d.Len(); i < n; i++ {
+		name := d.String()
+		tpl.Blocks[name] = d.Wrapper()
+	}
+	tpl.Macros = d.MacroMap()
+	tpl.Parent = d.Template()
+	return tpl
+}
+
+func (d *Decoder) Wrapper() *nodes.Wrapper {
+	if obj, ok := d.ref(); ok {
+		wrapper, ok := obj.(*nodes.Wrapper)
+		if !ok && obj != nil {
+			d.Fail("Expected a wrapper reference at offset %d", d.pos)
+		}
+		return wrapper
+	}
+	wrapper := &nodes.Wrapper{}
+	d.refs = append(d.refs, wrapper)
+	wrapper.Location = d.Token()
+	wrapper.Nodes = d.Nodes()
+	wrapper.EndTag = d.String()
+	if d.Bool() {
+		wrapper.Trim = &nodes.Trim{Left: d.Bool(), Right: d.Bool()}
+	}
+	wrapper.LStrip = d.Bool()
+	return wrapper
+}
+
+func (d *Decoder) Macro() *nodes.Macro {
+	if obj, ok := d.ref(); ok {
+		macro, ok := obj.(*nodes.Macro)
+		if !ok && obj != nil {
+			d.Fail("Expected a macro reference at offset %d", d.pos)
+		}
+		return macro
+	}
+	macro := &nodes.Macro{}
+	d.refs = append(d.refs, macro)
+	macro.Location = d.Token()
+	macro.Name = d.String()
+	for i, n := 0, d.Len(); i < n; i++ {
+		macro.Kwargs = append(macro.Kwargs, &nodes.Pair{Key: d.Expression(), Value: d.Expression()})
+	}
+	macro.Wrapper = d.Wrapper()
+	return macro
+}
+
+// MacroMap reads a map of macros written by Encoder.MacroMap
+func (d *Decoder) MacroMap() map[string]*nodes.Macro {
+	m := map[string]*nodes.Macro{}
+	for i, n := 0, d.Len(); i < n; i++ {
+		name := d.String()
+		m[name] = d.Macro()
+	}
+	return m
+}
+
+func (d *Decoder) Nodes() []nodes.Node {
+	list := []nodes.Node{}
+	for i, n := 0, d.Len(); i < n; i++ {
+		list = append(list, d.Node())
+	}
+	return list
+}
+
+func (d *Decoder) Expression() nodes.Expression {
+	return d.Node()
+}
+
+func (d *Decoder) Expressions() []nodes.Expression {
+	list := []nodes.Expression{}
+	for i, n := 0, d.Len(); i < n; i++ {
+		list = append(list, d.Expression())
+	}
+	return list
+}
+
+// Kwargs reads keyword arguments written by Encoder.Kwargs
+func (d *Decoder) Kwargs() map[string]nodes.Expression {
+	kwargs := map[string]nodes.Expression{}
+	for i, n := 0, d.Len(); i < n; i++ {
+		name := d.String()
+		kwargs[name] = d.Expression()
+	}
+	return kwargs
+}
+
+func (d *Decoder) FilterCall() *nodes.FilterCall {
+	return &nodes.FilterCall{
+		Token:  d.Token(),
+		Name:   d.String(),
+		Args:   d.Expressions(),
+		Kwargs: d.Kwargs(),
+	}
+}
+
+func (d *Decoder) Node() nodes.Node {
+	switch k := kind(d.byte()); k {
+	case kindNil:
+		return nil
+	case kindData:
+		return &nodes.Data{Data: d.Token(), Trim: nodes.Trim{Left: d.Bool(), Right: d.Bool()}}
+	case kindComment:
+		return &nodes.Comment{Start: d.Token(), Text: d.String(), End: d.Token()}
+	case kindOutput:
+		return &nodes.Output{Start: d.Token(), Expression: d.Expression(), End: d.Token()}
+	case kindFiltered:
+		node := &nodes.FilteredExpression{Expression: d.Expression()}
+		for i, n := 0, d.Len(); i < n; i++ {
+			node.Filters = append(node.Filters, d.FilterCall())
+		}
+		return node
+	case kindTest:
+		return &nodes.TestExpression{
+			Expression: d.Expression(),
+			Test: &nodes.TestCall{
+				Token:  d.Token(),
+				Name:   d.String(),
+				Args:   d.Expressions(),
+				Kwargs: d.Kwargs(),
+			},
+		}
+	case kindString:
+		return &nodes.String{Location: d.Token(), Val: d.String()}
+	case kindInteger:
+		return &nodes.Integer{Location: d.Token(), Val: d.Int()}
+	case kindFloat:
+		return &nodes.Float{Location: d.Token(), Val: d.Float()}
+	case kindBool:
+		return &nodes.Bool{Location: d.Token(), Val: d.Bool()}
+	case kindName:
+		return &nodes.Name{Name: d.Token()}
+	case kindNone:
+		return &nodes.None{Location: d.Token()}
+	case kindList:
+		return &nodes.List{Location: d.Token(), Val: d.Expressions()}
+	case kindTuple:
+		return &nodes.Tuple{Location: d.Token(), Val: d.Expressions()}
+	case kindDict:
+		node := &nodes.Dict{Token: d.Token(), Pairs: []*nodes.Pair{}}
+		for i, n := 0, d.Len(); i < n; i++ {
+			node.Pairs = append(node.Pairs, &nodes.Pair{Key: d.Expression(), Value: d.Expression()})
+		}
+		return node
+	case kindCall:
+		node := &nodes.Call{
+			Location: d.Token(),
+			Func:     d.Node(),
+			Args:     d.Expressions(),
+			Kwargs:   d.Kwargs(),
+			Keywords: map[string]*tokens.Token{},
+		}
+		for i, n := 0, d.Len(); i < n; i++ {
+			name := d.String()
+			node.Keywords[name] = d.Token()
+		}
+		return node
+	case kindGetitem:
+		return &nodes.Getitem{Location: d.Token(), Node: d.Node(), Arg: d.Node()}
+	case kindSlice:
+		return &nodes.Slice{Location: d.Token(), Start: d.Expression(), Stop: d.Expression(), Step: d.Expression()}
+	case kindGetattr:
+		return &nodes.Getattr{Location: d.Token(), Node: d.Node(), Attr: d.String(), Index: d.Int()}
+	case kindNegation:
+		return &nodes.Negation{Term: d.Expression(), Operator: d.Token()}
+	case kindUnary:
+		return &nodes.UnaryExpression{Negative: d.Bool(), Term: d.Expression(), Operator: d.Token()}
+	case kindBinary:
+		return &nodes.BinaryExpression{Left: d.Expression(), Right: d.Expression(), Operator: &nodes.BinOperator{Token: d.Token()}}
+	case kindConditional:
+		return &nodes.Conditional{Location: d.Token(), Expression: d.Expression(), Condition: d.Expression(), Alternative: d.Expression()}
+	case kindStatement:
+		node := &nodes.StatementBlock{Location: d.Token(), Name: d.String()}
+		decode, ok := decoders[node.Name]
+		if !ok {
+			d.Fail(`Statement "%s" has no registered codec`, node.Name)
+			return nil
+		}
+		node.Stmt = decode(d)
+		return node
+	case kindWrapper:
+		return d.Wrapper()
+	case kindMacro:
+		return d.Macro()
+	default:
+		d.Fail("Unknown node kind %d at offset %d", k, d.pos-1)
+		return nil
+	}
+}
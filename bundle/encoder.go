@@ -0,0 +1,386 @@
+package bundle
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// Encoder writes nodes in a compact binary form. Strings are written once
+// and referenced afterwards. So are the templates, wrappers and macros, which
+// are shared by the decoded nodes as they are by the parsed ones.
+type Encoder struct {
+	buf       []byte
+	strings   map[string]uint64
+	refs      map[any]uint64
+	nrefs     uint64
+	templates map[[2]string]*nodes.Template
+	err       error
+}
+
+func newEncoder() *Encoder {
+	return &Encoder{
+		strings:   map[string]uint64{},
+		refs:      map[any]uint64{},
+		templates: map[[2]string]*nodes.Template{},
+	}
+}
+
+// Err returns the first error met while encoding
+func (e *Encoder) Err() error {
+	return e.err
+}
+
+// Fail records an error, only the first one is kept
+func (e *Encoder) Fail(format string, args ...any) {
+	if e.err == nil {
+		e.err = errors.Errorf(format, args...)
+	}
+}
+
+func (e *Encoder) Uint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *Encoder) Int(v int) {
+	e.buf = binary.AppendVarint(e.buf, int64(v))
+}
+
+// Len writes the length of a slice or a map
+func (e *Encoder) Len(n int) {
+	e.Uint(uint64(n))
+}
+
+func (e *Encoder) Bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *Encoder) Float(v float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+// String writes a string the first time, and its index afterwards
+func (e *Encoder) String(s string) {
+	if idx, ok := e.strings[s]; ok {
+		e.Uint(idx + 1)
+		return
+	}
+	e.strings[s] = uint64(len(e.strings))
+	e.Uint(0)
+	e.Len(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+// StringMap writes a map of strings, sorted by key
+func (e *Encoder) StringMap(m map[string]string) {
+	e.Len(len(m))
+	for _, key := range sortedKeys(m) {
+		e.String(key)
+		e.String(m[key])
+	}
+}
+
+func (e *Encoder) Token(t *tokens.Token) {
+	if t == nil {
+		e.Uint(0)
+		return
+	}
+	e.Uint(uint64(t.Type) + 1)
+	e.String(t.Val)
+	e.Int(t.Pos)
+	e.Int(t.Line)
+	e.Int(t.Col)
+	e.Bool(t.Trim)
+}
+
+// ref writes the reference of an object already written and returns true,
+// or registers it and returns false for its fields to be written
+func (e *Encoder) ref(obj any, isNil bool) bool {
+	if isNil {
+		e.Uint(refNil)
+		return true
+	}
+	if idx, ok := e.refs[obj]; ok {
+		e.Uint(idx + refFirst)
+		return true
+	}
+	e.refs[obj] = e.nrefs
+	e.nrefs++
+	e.Uint(refNew)
+	return false
+}
+
+// Template writes a template, along with the ones it extends, includes and
+// imports. Templates parsed several times from the same source are written once.
+func (e *Encoder) Template(tpl *nodes.Template) {
+	if tpl != nil {
+		key := [2]string{tpl.Name, tpl.Source}
+		if written, ok := e.templates[key]; ok && written != tpl {
+			e.alias(tpl, written)
+		} else {
+			e.templates[key] = tpl
+		}
+	}
+	if e.ref(tpl, tpl == nil) {
+		return
+	}
+	e.String(tpl.Name)
+	e.String(tpl.Source)
+	e.Nodes(tpl.Nodes)
+	e.Len(len(tpl.Blocks))
+	for _, name := range sortedKeys(tpl.Blocks) {
+		e.String(name)
+		e.Wrapper(tpl.Blocks[name])
+	}
+	e.MacroMap(tpl.Macros)
+	e.Template(tpl.Parent)
+}
+
+// alias references a template parsed again, and its macros, as the one written
+func (e *Encoder) alias(tpl *nodes.Template, written *nodes.Template) {
+	if idx, ok := e.refs[written]; ok {
+		e.refs[tpl] = idx
+	}
+	for name, macro := range tpl.Macros {
+		if idx, ok := e.refs[written.Macros[name]]; ok {
+			e.refs[macro] = idx
+		}
+	}
+}
+
+func (e *Encoder) Wrapper(w *nodes.Wrapper) {
+	if e.ref(w, w == nil) {
+		return
+	}
+	e.Token(w.Location)
+	e.Nodes(w.Nodes)
+	e.String(w.EndTag)
+	e.Bool(w.Trim != nil)
+	if w.Trim != nil {
+		e.Bool(w.Trim.Left)
+		e.Bool(w.Trim.Right)
+	}
+	e.Bool(w.LStrip)
+}
+
+func (e *Encoder) Macro(m *nodes.Macro) {
+	if e.ref(m, m == nil) {
+		return
+	}
+	e.Token(m.Location)
+	e.String(m.Name)
+	e.Len(len(m.Kwargs))
+	for _, pair := range m.Kwargs {
+		e.Expression(pair.Key)
+		e.Expression(pair.Value)
+	}
+	e.Wrapper(m.Wrapper)
+}
+
+// MacroMap writes a map of macros, sorted by name
+func (e *Encoder) MacroMap(m map[string]*nodes.Macro) {
+	e.Len(len(m))
+	for _, name := range sortedKeys(m) {
+		e.String(name)
+		e.Macro(m[name])
+	}
+}
+
+func (e *Encoder) Nodes(list []nodes.Node) {
+	e.Len(len(list))
+	for _, node := range list {
+		e.Node(node)
+	}
+}
+
+func (e *Encoder) Expression(expr nodes.Expression) {
+	e.Node(expr)
+}
+
+func (e *Encoder) Expressions(list []nodes.Expression) {
+	e.Len(len(list))
+	for _, expr := range list {
+		e.Node(expr)
+	}
+}
+
+// Kwargs writes keyword arguments, sorted by name
+func (e *Encoder) Kwargs(kwargs map[string]nodes.Expression) {
+	e.Len(len(kwargs))
+	for _, name := range sortedKeys(kwargs) {
+		e.String(name)
+		e.Expression(kwargs[name])
+	}
+}
+
+func (e *Encoder) FilterCall(call *nodes.FilterCall) {
+	e.Token(call.Token)
+	e.String(call.Name)
+	e.Expressions(call.Args)
+	e.Kwargs(call.Kwargs)
+}
+
+func (e *Encoder) Node(node nodes.Node) {
+	if e.err != nil {
+		return
+	}
+	switch n := node.(type) {
+	case nil:
+		e.kind(kindNil)
+	case *nodes.Data:
+		e.kind(kindData)
+		e.Token(n.Data)
+		e.Bool(n.Trim.Left)
+		e.Bool(n.Trim.Right)
+	case *nodes.Comment:
+		e.kind(kindComment)
+		e.Token(n.Start)
+		e.String(n.Text)
+		e.Token(n.End)
+	case *nodes.Output:
+		e.kind(kindOutput)
+		e.Token(n.Start)
+		e.Expression(n.Expression)
+		e.Token(n.End)
+	case *nodes.FilteredExpression:
+		e.kind(kindFiltered)
+		e.Expression(n.Expression)
+		e.Len(len(n.Filters))
+		for _, filter := range n.Filters {
+			e.FilterCall(filter)
+		}
+	case *nodes.TestExpression:
+		e.kind(kindTest)
+		e.Expression(n.Expression)
+		e.Token(n.Test.Token)
+		e.String(n.Test.Name)
+		e.Expressions(n.Test.Args)
+		e.Kwargs(n.Test.Kwargs)
+	case *nodes.String:
+		e.kind(kindString)
+		e.Token(n.Location)
+		e.String(n.Val)
+	case *nodes.Integer:
+		e.kind(kindInteger)
+		e.Token(n.Location)
+		e.Int(n.Val)
+	case *nodes.Float:
+		e.kind(kindFloat)
+		e.Token(n.Location)
+		e.Float(n.Val)
+	case *nodes.Bool:
+		e.kind(kindBool)
+		e.Token(n.Location)
+		e.Bool(n.Val)
+	case *nodes.Name:
+		e.kind(kindName)
+		e.Token(n.Name)
+	case *nodes.None:
+		e.kind(kindNone)
+		e.Token(n.Location)
+	case *nodes.List:
+		e.kind(kindList)
+		e.Token(n.Location)
+		e.Expressions(n.Val)
+	case *nodes.Tuple:
+		e.kind(kindTuple)
+		e.Token(n.Location)
+		e.Expressions(n.Val)
+	case *nodes.Dict:
+		e.kind(kindDict)
+		e.Token(n.Token)
+		e.Len(len(n.Pairs))
+		for _, pair := range n.Pairs {
+			e.Expression(pair.Key)
+			e.Expression(pair.Value)
+		}
+	case *nodes.Call:
+		e.kind(kindCall)
+		e.Token(n.Location)
+		e.Node(n.Func)
+		e.Expressions(n.Args)
+		e.Kwargs(n.Kwargs)
+		e.Len(len(n.Keywords))
+		for _, name := range sortedKeys(n.Keywords) {
+			e.String(name)
+			e.Token(n.Keywords[name])
+		}
+	case *nodes.Getitem:
+		e.kind(kindGetitem)
+		e.Token(n.Location)
+		e.Node(n.Node)
+		e.Node(n.Arg)
+	case *nodes.Slice:
+		e.kind(kindSlice)
+		e.Token(n.Location)
+		e.Expression(n.Start)
+		e.Expression(n.Stop)
+		e.Expression(n.Step)
+	case *nodes.Getattr:
+		e.kind(kindGetattr)
+		e.Token(n.Location)
+		e.Node(n.Node)
+		e.String(n.Attr)
+		e.Int(n.Index)
+	case *nodes.Negation:
+		e.kind(kindNegation)
+		e.Expression(n.Term)
+		e.Token(n.Operator)
+	case *nodes.UnaryExpression:
+		e.kind(kindUnary)
+		e.Bool(n.Negative)
+		e.Expression(n.Term)
+		e.Token(n.Operator)
+	case *nodes.BinaryExpression:
+		e.kind(kindBinary)
+		e.Expression(n.Left)
+		e.Expression(n.Right)
+		e.Token(n.Operator.Token)
+	case *nodes.Conditional:
+		e.kind(kindConditional)
+		e.Token(n.Location)
+		e.Expression(n.Expression)
+		e.Expression(n.Condition)
+		e.Expression(n.Alternative)
+	case *nodes.StatementBlock:
+		stmt, ok := n.Stmt.(Statement)
+		if !ok || decoders[n.Name] == nil {
+			e.Fail(`Statement "%s" can't be written to a bundle, it has no registered codec`, n.Name)
+			return
+		}
+		e.kind(kindStatement)
+		e.Token(n.Location)
+		e.String(n.Name)
+		stmt.Encode(e)
+	case *nodes.Wrapper:
+		e.kind(kindWrapper)
+		e.Wrapper(n)
+	case *nodes.Macro:
+		e.kind(kindMacro)
+		e.Macro(n)
+	default:
+		e.Fail(`Unable to write node %s of type %T to a bundle`, node, node)
+	}
+}
+
+func (e *Encoder) kind(k kind) {
+	e.buf = append(e.buf, byte(k))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
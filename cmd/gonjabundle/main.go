@@ -0,0 +1,209 @@
+// Command gonjabundle precompiles gonja templates into a bundle, which an
+// Environment loads with LoadBundle without parsing them again.
+//
+// Usage:
+//
+//	gonjabundle [flags] path ...
+//
+// Paths are template files or folders whose templates are all bundled,
+// templates being named by their path relative to the root. The bundle is
+// only loaded by the same version of gonja, with the same parsing options
+// as the ones given by the flags:
+//
+//	-root string
+//		Folder from which templates are loaded (default ".").
+//	-o string
+//		File the bundle is written to (default "templates.bundle").
+//	-ext string
+//		Comma separated extensions of the templates bundled from folders,
+//		all files being bundled if empty.
+//	-block-start, -block-end string
+//		Delimiters of blocks (default "{%" and "%}").
+//	-variable-start, -variable-end string
+//		Delimiters of print statements (default "{{" and "}}").
+//	-comment-start, -comment-end string
+//		Delimiters of comments (default "{#" and "#}").
+//	-line-statement-prefix, -line-comment-prefix string
+//		Prefixes of line statements and line comments, disabled if empty.
+//	-trim-blocks
+//		Templates are parsed with TrimBlocks.
+//	-lstrip-blocks
+//		Templates are parsed with LstripBlocks.
+//	-keep-trailing-newline
+//		Templates are parsed with KeepTrailingNewline (default true).
+//	-newline-sequence string
+//		Sequence newlines are normalized to, with Go escapes (default "\n"),
+//		newlines being kept as they are if empty.
+//	-strict-names
+//		Templates are parsed with StrictNames.
+//	-autoescape
+//		Templates are optimized with Autoescape.
+//	-optimize
+//		Templates are optimized once parsed.
+//
+// The bundle can then be embedded:
+//
+//	//go:embed templates.bundle
+//	var templates []byte
+//
+//	err := env.LoadBundle(templates)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/MarioJim/gonja"
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/loaders"
+)
+
+var (
+	root                = flag.String("root", ".", "folder from which templates are loaded")
+	output              = flag.String("o", "templates.bundle", "file the bundle is written to")
+	extensions          = flag.String("ext", "", "comma separated extensions of the templates bundled from folders, e.g. .tpl,.html")
+	blockStart          = flag.String("block-start", "{%", "string marking the beginning of a block")
+	blockEnd            = flag.String("block-end", "%}", "string marking the end of a block")
+	variableStart       = flag.String("variable-start", "{{", "string marking the beginning of a print statement")
+	variableEnd         = flag.String("variable-end", "}}", "string marking the end of a print statement")
+	commentStart        = flag.String("comment-start", "{#", "string marking the beginning of a comment")
+	commentEnd          = flag.String("comment-end", "#}", "string marking the end of a comment")
+	lineStatementPrefix = flag.String("line-statement-prefix", "", "prefix of line statements")
+	lineCommentPrefix   = flag.String("line-comment-prefix", "", "prefix of line comments")
+	trimBlocks          = flag.Bool("trim-blocks", false, "templates are parsed with TrimBlocks")
+	lstripBlocks        = flag.Bool("lstrip-blocks", false, "templates are parsed with LstripBlocks")
+	keepTrailingNewline = flag.Bool("keep-trailing-newline", true, "templates are parsed with KeepTrailingNewline")
+	newlineSequence     = flag.String("newline-sequence", `\n`, "sequence newlines are normalized to, with Go escapes, e.g. \\r\\n")
+	strictNames         = flag.Bool("strict-names", false, "templates are parsed with StrictNames")
+	autoescape          = flag.Bool("autoescape", false, "templates are optimized with Autoescape")
+	optimize            = flag.Bool("optimize", false, "templates are optimized once parsed")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gonjabundle [flags] path ...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	loader, err := loaders.NewFileSystemLoader(*root)
+	if err != nil {
+		fail(err)
+	}
+	newline, err := strconv.Unquote(`"` + *newlineSequence + `"`)
+	if err != nil {
+		fail(fmt.Errorf("invalid newline sequence %s", *newlineSequence))
+	}
+	cfg := config.NewConfig()
+	cfg.BlockStartString = *blockStart
+	cfg.BlockEndString = *blockEnd
+	cfg.VariableStartString = *variableStart
+	cfg.VariableEndString = *variableEnd
+	cfg.CommentStartString = *commentStart
+	cfg.CommentEndString = *commentEnd
+	cfg.LineStatementPrefix = *lineStatementPrefix
+	cfg.LineCommentPrefix = *lineCommentPrefix
+	cfg.TrimBlocks = *trimBlocks
+	cfg.LstripBlocks = *lstripBlocks
+	cfg.KeepTrailingNewline = *keepTrailingNewline
+	cfg.NewlineSequence = newline
+	cfg.StrictNames = *strictNames
+	cfg.Autoescape = *autoescape
+	cfg.Optimize = *optimize
+	env := gonja.NewEnvironment(cfg, loader)
+
+	names := []string{}
+	for _, path := range flag.Args() {
+		paths, err := templatePaths(path)
+		if err != nil {
+			fail(err)
+		}
+		for _, path := range paths {
+			name, err := templateName(path)
+			if err != nil {
+				fail(err)
+			}
+			names = append(names, name)
+		}
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		fail(err)
+	}
+	if err := env.WriteBundle(out, names...); err != nil {
+		out.Close()
+		os.Remove(*output)
+		fail(err)
+	}
+	if err := out.Close(); err != nil {
+		fail(err)
+	}
+	fmt.Printf("%d templates written to %s\n", len(names), *output)
+}
+
+// templatePaths returns the path of a template, or the templates of a folder
+func templatePaths(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	exts := []string{}
+	if *extensions != "" {
+		exts = strings.Split(*extensions, ",")
+	}
+	paths := []string{}
+	err = filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if len(exts) == 0 || hasExtension(path, exts) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func hasExtension(path string, exts []string) bool {
+	for _, ext := range exts {
+		if filepath.Ext(path) == strings.TrimSpace(ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateName returns the path relative to the root, as loaded by the environment
+func templateName(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	base, err := filepath.Abs(*root)
+	if err != nil {
+		return "", err
+	}
+	name, err := filepath.Rel(base, abs)
+	if err != nil || strings.HasPrefix(name, "..") {
+		return "", fmt.Errorf("%s is not in the root folder %s", path, *root)
+	}
+	return filepath.ToSlash(name), nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,116 @@
+// Command gonjafmt formats gonja templates.
+//
+// Usage:
+//
+//	gonjafmt [flags] [path ...]
+//
+// Without paths, it formats the standard input. The flags are:
+//
+//	-check
+//		Do not print formatted templates, list the files whose formatting
+//		differs and exit with status 1 if there is any.
+//	-w
+//		Write the result to the source files instead of the standard output.
+//	-indent string
+//		Indentation of one nesting level (default 4 spaces).
+//	-lstrip-blocks
+//		Templates are rendered with LstripBlocks, nested tags can be indented.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/formatter"
+)
+
+var (
+	check        = flag.Bool("check", false, "list files whose formatting differs and fail if any")
+	write        = flag.Bool("w", false, "write result to source files instead of stdout")
+	indent       = flag.String("indent", formatter.DefaultOptions.Indent, "indentation of one nesting level")
+	lstripBlocks = flag.Bool("lstrip-blocks", false, "templates are rendered with LstripBlocks")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gonjafmt [flags] [path ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg := config.NewConfig()
+	cfg.LstripBlocks = *lstripBlocks
+	opts := &formatter.Options{Config: cfg, Indent: *indent}
+
+	if flag.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fail(err)
+		}
+		formatted, err := formatter.Source(string(source), opts)
+		if err != nil {
+			fail(err)
+		}
+		if *check {
+			if formatted != string(source) {
+				fmt.Println("<standard input>")
+				os.Exit(1)
+			}
+			return
+		}
+		fmt.Print(formatted)
+		return
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		changed, err := formatFile(path, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			status = 2
+			continue
+		}
+		if *check && changed {
+			fmt.Println(path)
+			if status == 0 {
+				status = 1
+			}
+		}
+	}
+	os.Exit(status)
+}
+
+// formatFile formats a template file and returns whether its formatting changed
+func formatFile(path string, opts *formatter.Options) (bool, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	formatted, err := formatter.Source(string(source), opts)
+	if err != nil {
+		return false, err
+	}
+	changed := formatted != string(source)
+	switch {
+	case *check:
+	case *write:
+		if changed {
+			info, err := os.Stat(path)
+			if err != nil {
+				return false, err
+			}
+			return true, os.WriteFile(path, []byte(formatted), info.Mode())
+		}
+	default:
+		fmt.Print(formatted)
+	}
+	return changed, nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
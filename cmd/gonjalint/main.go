@@ -0,0 +1,167 @@
+// Command gonjalint reports common problems in gonja templates.
+//
+// Usage:
+//
+//	gonjalint [flags] path ...
+//
+// Diagnostics are printed as "template:line:col: severity: message (rule)",
+// templates being named by their path relative to the root. The flags are:
+//
+//	-root string
+//		Folder from which included, extended and imported templates are
+//		loaded (default ".").
+//	-rules string
+//		Comma separated rule=severity pairs overriding the default severity
+//		of rules, a severity of "off" disabling the rule.
+//	-deprecated-filters string
+//		Comma separated old=new pairs of deprecated filters and their
+//		replacement, e.g. "d=default,e=escape".
+//	-fail-on string
+//		Exit with status 1 if there is any diagnostic of this severity or
+//		above (default "error").
+//	-lstrip-blocks
+//		Templates are rendered with LstripBlocks.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MarioJim/gonja"
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/lint"
+	"github.com/MarioJim/gonja/loaders"
+	"github.com/MarioJim/gonja/nodes"
+)
+
+var (
+	root         = flag.String("root", ".", "folder from which referenced templates are loaded")
+	rules        = flag.String("rules", "", "comma separated rule=severity pairs, e.g. unused-variable=off")
+	deprecated   = flag.String("deprecated-filters", "", "comma separated old=new pairs of deprecated filters, e.g. d=default")
+	failOn       = flag.String("fail-on", "error", "fail if there is any diagnostic of this severity or above")
+	lstripBlocks = flag.Bool("lstrip-blocks", false, "templates are rendered with LstripBlocks")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gonjalint [flags] path ...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	threshold, err := lint.ParseSeverity(*failOn)
+	if err != nil {
+		fail(err)
+	}
+	loader, err := loaders.NewFileSystemLoader(*root)
+	if err != nil {
+		fail(err)
+	}
+	cfg := config.NewConfig()
+	cfg.LstripBlocks = *lstripBlocks
+	env := gonja.NewEnvironment(cfg, loader)
+
+	linter := lint.New(env.EvalConfig)
+	if err := configureRules(linter, *rules); err != nil {
+		fail(err)
+	}
+	if err := configureDeprecated(linter, *deprecated); err != nil {
+		fail(err)
+	}
+
+	status := 0
+	diagnostics := []*lint.Diagnostic{}
+	templates := []*nodes.Template{}
+	for _, path := range flag.Args() {
+		name, err := templateName(path)
+		if err != nil {
+			fail(err)
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			status = 2
+			continue
+		}
+		tpl, errs := env.ParseRecovering(name, string(source))
+		diagnostics = append(diagnostics, linter.SyntaxErrors(errs)...)
+		templates = append(templates, tpl)
+	}
+	diagnostics = append(diagnostics, linter.Lint(templates...)...)
+	lint.SortDiagnostics(diagnostics)
+
+	for _, diagnostic := range diagnostics {
+		fmt.Println(diagnostic)
+		if diagnostic.Severity >= threshold && status == 0 {
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+// configureRules applies the rule=severity pairs of spec
+func configureRules(linter *lint.Linter, spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid rule '%s', expected rule=severity", pair)
+		}
+		rule := strings.TrimSpace(parts[0])
+		if _, ok := lint.DefaultRules[rule]; !ok {
+			return fmt.Errorf("unknown rule '%s'", rule)
+		}
+		severity, err := lint.ParseSeverity(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return err
+		}
+		linter.Rules[rule] = severity
+	}
+	return nil
+}
+
+// configureDeprecated adds the old=new pairs of spec to the deprecated filters
+func configureDeprecated(linter *lint.Linter, spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid deprecated filter '%s', expected old=new", pair)
+		}
+		linter.DeprecatedFilters[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return nil
+}
+
+// templateName returns the path relative to the root, as referenced by other templates
+func templateName(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	base, err := filepath.Abs(*root)
+	if err != nil {
+		return "", err
+	}
+	name, err := filepath.Rel(base, abs)
+	if err != nil || strings.HasPrefix(name, "..") {
+		return path, nil
+	}
+	return filepath.ToSlash(name), nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
@@ -25,14 +25,35 @@ type Config struct {
 	// If given and a string, this will be used as prefix for line based comments.
 	// See also Line Statements.
 	LineCommentPrefix string
+	// If this is set to True the first newline after a block or a comment is
+	// removed. Adding a '+' before the closing delimiter keeps it.
+	TrimBlocks bool
+	// If this is set to True leading spaces and tabs are stripped from the start
+	// of a line to a block or a comment. Adding a '+' after the opening
+	// delimiter disables it for a single tag.
+	LstripBlocks bool
+	// If set to False, a single newline at the end of the template is removed.
+	// Defaults to True, unlike Jinja2, to keep the previous gonja behavior.
+	KeepTrailingNewline bool
+	// The sequence that starts a newline: '\r', '\n' or '\r\n'.
+	// Newlines in template data are normalized to it. Defaults to '\n',
+	// an empty string keeps them as they are.
+	NewlineSequence string
 	// If set to True the XML/HTML autoescaping feature is enabled by default.
 	// For more details about autoescaping see Markup.
 	// This can also be a callable that is passed the template name
 	// and has to return True or False depending on autoescape should be enabled by default.
 	Autoescape bool
 	// Whether to be strict about undefined attribute or item in an object and return error
-	// or return a nil value on missing data and ignore it entirely
+	// or return an undefined value on missing data and ignore it entirely.
+	// It only applies when no undefined policy is set on the evaluation config.
 	StrictUndefined bool
+	// If set to True, parsing a template fails on unknown filter and test
+	// names and on macro calls with invalid arguments, instead of rendering.
+	StrictNames bool
+	// If set to True, templates are optimized once parsed: constant
+	// expressions are folded, dead branches pruned and data merged.
+	Optimize bool
 
 	// Allow extensions to store some config
 	Ext map[string]Inheritable
@@ -47,8 +68,14 @@ func NewConfig() *Config {
 		VariableEndString:   "}}",
 		CommentStartString:  "{#",
 		CommentEndString:    "#}",
+		TrimBlocks:          false,
+		LstripBlocks:        false,
+		KeepTrailingNewline: true,
+		NewlineSequence:     "\n",
 		Autoescape:          false,
 		StrictUndefined:     false,
+		StrictNames:         false,
+		Optimize:            false,
 		Ext:                 map[string]Inheritable{},
 	}
 }
@@ -66,8 +93,16 @@ func (cfg *Config) Inherit() *Config {
 		VariableEndString:   cfg.VariableEndString,
 		CommentStartString:  cfg.CommentStartString,
 		CommentEndString:    cfg.CommentEndString,
+		LineStatementPrefix: cfg.LineStatementPrefix,
+		LineCommentPrefix:   cfg.LineCommentPrefix,
+		TrimBlocks:          cfg.TrimBlocks,
+		LstripBlocks:        cfg.LstripBlocks,
+		KeepTrailingNewline: cfg.KeepTrailingNewline,
+		NewlineSequence:     cfg.NewlineSequence,
 		Autoescape:          cfg.Autoescape,
 		StrictUndefined:     cfg.StrictUndefined,
+		StrictNames:         cfg.StrictNames,
+		Optimize:            cfg.Optimize,
 		Ext:                 ext,
 	}
 }
@@ -1,3 +1,11 @@
 package gonja
 
+import "github.com/MarioJim/gonja/exec"
+
 type Context map[string]any
+
+// Layers returns a context looking up its variables in several sources, the
+// first ones hiding the next ones, without copying them. See exec.Layers.
+func Layers(sources ...any) *exec.Context {
+	return exec.Layers(sources...)
+}
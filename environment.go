@@ -6,9 +6,11 @@ import (
 	"sync"
 
 	"github.com/MarioJim/gonja/builtins"
+	"github.com/MarioJim/gonja/bundle"
 	"github.com/MarioJim/gonja/config"
 	"github.com/MarioJim/gonja/exec"
 	"github.com/MarioJim/gonja/loaders"
+	"github.com/MarioJim/gonja/nodes"
 )
 
 type Environment struct {
@@ -17,6 +19,10 @@ type Environment struct {
 
 	Cache      map[string]*exec.Template
 	CacheMutex sync.Mutex
+
+	// bundled are the templates loaded from bundles
+	bundled      map[string]*exec.Template
+	bundledMutex sync.RWMutex
 }
 
 func NewEnvironment(cfg *config.Config, loader loaders.Loader) *Environment {
@@ -24,6 +30,7 @@ func NewEnvironment(cfg *config.Config, loader loaders.Loader) *Environment {
 		EvalConfig: exec.NewEvalConfig(cfg),
 		Loader:     loader,
 		Cache:      map[string]*exec.Template{},
+		bundled:    map[string]*exec.Template{},
 	}
 	env.EvalConfig.Loader = env
 	env.Filters.Update(builtins.Filters)
@@ -58,6 +65,9 @@ func (env *Environment) CleanCache(filenames ...string) {
 // FromCache() will not cache the template and instead recompile it on any
 // call (to make changes to a template live instantaneously).
 func (env *Environment) FromCache(filename string) (*exec.Template, error) {
+	if tpl, ok := env.bundledTemplate(filename); ok {
+		return tpl, nil
+	}
 	if env.Config.Debug {
 		// Recompile on any request
 		return env.FromFile(filename)
@@ -92,6 +102,14 @@ func (env *Environment) FromBytes(tpl []byte) (*exec.Template, error) {
 	return exec.NewTemplate("bytes", string(tpl), env.EvalConfig)
 }
 
+// CompileExpression parses and compiles a standalone expression, such as
+// `user.age >= 18 and "beta" in user.flags`. The returned expression uses the
+// filters, tests, globals and undefined policy of the environment, and can be
+// evaluated concurrently.
+func (env *Environment) CompileExpression(source string) (*exec.Expression, error) {
+	return exec.NewExpression(source, env.EvalConfig)
+}
+
 // FromFile loads a template from a filename and returns a Template instance.
 func (env *Environment) FromFile(filename string) (*exec.Template, error) {
 	fd, err := env.Loader.Get(filename)
@@ -107,9 +125,51 @@ func (env *Environment) FromFile(filename string) (*exec.Template, error) {
 }
 
 func (env *Environment) GetTemplate(filename string) (*exec.Template, error) {
+	if tpl, ok := env.bundledTemplate(filename); ok {
+		return tpl, nil
+	}
 	return env.FromFile(filename)
 }
 
+// WriteBundle parses templates from the loader and writes them to w, along
+// with the templates they extend, include and import, so that LoadBundle
+// loads them without parsing them again.
+func (env *Environment) WriteBundle(w io.Writer, filenames ...string) error {
+	roots := []*nodes.Template{}
+	for _, filename := range filenames {
+		tpl, err := env.FromFile(filename)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, tpl.Root)
+	}
+	return bundle.Write(w, roots, VERSION, env.Config)
+}
+
+// LoadBundle loads the templates of a bundle written by WriteBundle. They are
+// returned by FromCache and GetTemplate instead of being parsed from the loader.
+// A bundle written by another version of gonja or with another configuration
+// is rejected with bundle.ErrStale.
+func (env *Environment) LoadBundle(data []byte) error {
+	roots, err := bundle.Read(data, VERSION, env.Config)
+	if err != nil {
+		return err
+	}
+	env.bundledMutex.Lock()
+	defer env.bundledMutex.Unlock()
+	for _, root := range roots {
+		env.bundled[root.Name] = exec.NewTemplateFromRoot(root, env.EvalConfig)
+	}
+	return nil
+}
+
+func (env *Environment) bundledTemplate(filename string) (*exec.Template, bool) {
+	env.bundledMutex.RLock()
+	defer env.bundledMutex.RUnlock()
+	tpl, ok := env.bundled[filename]
+	return tpl, ok
+}
+
 func (env *Environment) Path(path string) (string, error) {
 	return env.Loader.Path(path)
 }
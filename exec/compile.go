@@ -0,0 +1,402 @@
+package exec
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/nodes"
+)
+
+// evalFunc evaluates a compiled expression
+type evalFunc func(e *Evaluator) *Value
+
+// renderFunc renders a compiled node
+type renderFunc func(r *Renderer) error
+
+// Program is the executable form of a template: its nodes and expressions
+// compiled into closures, with their literals, trimmed data and names bound
+// once and for all. Compiled expressions call the closures of their operands,
+// arguments and filters directly, statements look up the closures of their
+// expressions through Evaluator.Eval. Nodes it doesn't know are interpreted.
+//
+// The AST of the template must not be modified once compiled, see Template.Compile.
+type Program struct {
+	root        renderFunc
+	wrappers    map[*nodes.Wrapper]renderFunc
+	expressions map[nodes.Expression]evalFunc
+}
+
+// Compile compiles the nodes of a template, along with the bodies and the
+// expressions of its statements
+func Compile(tpl *nodes.Template) *Program {
+	p := &Program{
+		wrappers:    map[*nodes.Wrapper]renderFunc{},
+		expressions: map[nodes.Expression]evalFunc{},
+	}
+	p.root = p.nodes(tpl.Nodes)
+	nodes.Inspect(tpl, func(node nodes.Node) bool {
+		switch n := node.(type) {
+		case *nodes.Wrapper:
+			if _, ok := p.wrappers[n]; !ok {
+				p.wrappers[n] = p.nodes(n.Nodes)
+			}
+		case *nodes.None, *nodes.String, *nodes.Integer, *nodes.Float, *nodes.Bool,
+			*nodes.List, *nodes.Tuple, *nodes.Dict, *nodes.Name, *nodes.Call,
+			*nodes.Getitem, *nodes.Getattr, *nodes.Negation, *nodes.Conditional,
+			*nodes.BinaryExpression, *nodes.UnaryExpression,
+			*nodes.FilteredExpression, *nodes.TestExpression:
+			p.expression(n)
+			return false
+		}
+		return true
+	})
+	return p
+}
+
+// CompileExpression compiles a standalone expression
+func CompileExpression(expr nodes.Expression) *Program {
+	p := &Program{
+		wrappers:    map[*nodes.Wrapper]renderFunc{},
+		expressions: map[nodes.Expression]evalFunc{},
+	}
+	p.expression(expr)
+	return p
+}
+
+// nodes compiles a sequence of nodes rendered one after the other
+func (p *Program) nodes(list []nodes.Node) renderFunc {
+	fns := []renderFunc{}
+	for _, node := range list {
+		if fn := p.node(node); fn != nil {
+			fns = append(fns, fn)
+		}
+	}
+	return func(r *Renderer) error {
+		for _, fn := range fns {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// node compiles a node as Renderer.Visit renders it, nil if it renders nothing
+func (p *Program) node(node nodes.Node) renderFunc {
+	switch n := node.(type) {
+	case nil, *nodes.Comment:
+		return nil
+	case *nodes.Data:
+		output := dataOutput(n)
+		return func(r *Renderer) error {
+			_, err := r.Out.WriteString(output)
+			return err
+		}
+	case *nodes.Output:
+		expr := p.expression(n.Expression)
+		return func(r *Renderer) error {
+			value := expr(r.Evaluator())
+			if value.IsError() {
+				return r.Error(value, "Unable to render expression", n.Expression.Position())
+			}
+			return r.output(value)
+		}
+	case *nodes.StatementBlock:
+		stmt, ok := n.Stmt.(Statement)
+		if !ok {
+			return nil
+		}
+		msg := fmt.Sprintf(`Unable to execute statement "%s"`, n.Name)
+		return func(r *Renderer) error {
+			if err := stmt.Execute(r, n); err != nil {
+				return r.Error(err, msg, n.Location)
+			}
+			return nil
+		}
+	default:
+		return func(r *Renderer) error {
+			return nodes.Walk(r, node)
+		}
+	}
+}
+
+// expression compiles an expression as Evaluator.Eval evaluates it
+func (p *Program) expression(expr nodes.Expression) evalFunc {
+	if expr == nil {
+		return func(e *Evaluator) *Value { return e.eval(nil) }
+	}
+	if fn, ok := p.expressions[expr]; ok {
+		return fn
+	}
+	fn := p.compileExpression(expr)
+	p.expressions[expr] = fn
+	return fn
+}
+
+func (p *Program) compileExpression(expr nodes.Expression) evalFunc {
+	switch n := expr.(type) {
+	case *nodes.None:
+		return constant(AsValue(nil))
+	case *nodes.String:
+		return constant(AsValue(n.Val))
+	case *nodes.Integer:
+		return constant(AsValue(n.Val))
+	case *nodes.Float:
+		return constant(AsValue(n.Val))
+	case *nodes.Bool:
+		return constant(AsValue(n.Val))
+	case *nodes.List:
+		return p.values(n.Val)
+	case *nodes.Tuple:
+		return p.values(n.Val)
+	case *nodes.Dict:
+		return p.dict(n)
+	case *nodes.Name:
+		name := n.Name.Val
+		hint := fmt.Sprintf(`'%s' is undefined`, name)
+		return func(e *Evaluator) *Value {
+			val, ok := e.Ctx.Get(name)
+			if !ok {
+				return e.undefined(n, name, hint)
+			}
+			return ToValue(val)
+		}
+	case *nodes.Getitem:
+		return p.getitem(n)
+	case *nodes.Getattr:
+		target := p.expression(n.Node)
+		return func(e *Evaluator) *Value {
+			value := target(e)
+			if value.IsError() {
+				return AsValue(errors.Wrapf(value, `Unable to evaluate target %s`, n.Node))
+			}
+			return e.getattr(value, n)
+		}
+	case *nodes.Negation:
+		term := p.expression(n.Term)
+		return func(e *Evaluator) *Value {
+			result := term(e)
+			if result.IsError() {
+				return result
+			}
+			return result.Negate()
+		}
+	case *nodes.Conditional:
+		return p.conditional(n)
+	case *nodes.BinaryExpression:
+		left, right := p.expression(n.Left), p.expression(n.Right)
+		return func(e *Evaluator) *Value {
+			return e.binary(n, left(e), right)
+		}
+	case *nodes.UnaryExpression:
+		term := p.expression(n.Term)
+		return func(e *Evaluator) *Value {
+			return e.unary(n, term(e))
+		}
+	case *nodes.FilteredExpression:
+		return p.filtered(n)
+	case *nodes.TestExpression:
+		inner := p.expression(n.Expression)
+		args := p.varArgs(n.Test.Args, n.Test.Kwargs)
+		name := n.Test.Name
+		return func(e *Evaluator) *Value {
+			value := inner(e)
+			params, err := args(e)
+			if err != nil {
+				return AsValue(err)
+			}
+			return e.ExecuteTestByName(name, value, params)
+		}
+	case *nodes.Call:
+		return p.call(n)
+	default:
+		return func(e *Evaluator) *Value {
+			return e.eval(n)
+		}
+	}
+}
+
+// constant returns copies of a literal value
+func constant(value *Value) evalFunc {
+	return func(*Evaluator) *Value {
+		copied := *value
+		return &copied
+	}
+}
+
+// values compiles the items of a list or a tuple
+func (p *Program) values(exprs []nodes.Expression) evalFunc {
+	items := make([]evalFunc, len(exprs))
+	for idx, expr := range exprs {
+		items[idx] = p.expression(expr)
+	}
+	return func(e *Evaluator) *Value {
+		values := ValuesList{}
+		for _, item := range items {
+			values = append(values, item(e))
+		}
+		return AsValue(values)
+	}
+}
+
+func (p *Program) dict(node *nodes.Dict) evalFunc {
+	keys := make([]evalFunc, len(node.Pairs))
+	values := make([]evalFunc, len(node.Pairs))
+	for idx, pair := range node.Pairs {
+		keys[idx] = p.expression(pair.Key)
+		values[idx] = p.expression(pair.Value)
+	}
+	return func(e *Evaluator) *Value {
+		pairs := []*Pair{}
+		for idx, pair := range node.Pairs {
+			key := keys[idx](e)
+			if key.IsError() {
+				err := errors.Wrapf(key, `Unable to evaluate key "%s"`, pair.Key)
+				return AsValue(errors.Wrapf(err, `Unable to evaluate pair "%s"`, pair))
+			}
+			value := values[idx](e)
+			if value.IsError() {
+				err := errors.Wrapf(value, `Unable to evaluate value "%s"`, pair.Value)
+				return AsValue(errors.Wrapf(err, `Unable to evaluate pair "%s"`, pair))
+			}
+			pairs = append(pairs, &Pair{key, value})
+		}
+		return AsValue(&Dict{pairs})
+	}
+}
+
+func (p *Program) conditional(node *nodes.Conditional) evalFunc {
+	condition := p.expression(node.Condition)
+	expression := p.expression(node.Expression)
+	var alternative evalFunc
+	if node.Alternative != nil {
+		alternative = p.expression(node.Alternative)
+	}
+	return func(e *Evaluator) *Value {
+		value := condition(e)
+		if value.IsError() {
+			return AsValue(errors.Wrapf(value, `Unable to evaluate condition %s`, node.Condition))
+		}
+		if value.IsTrue() {
+			return expression(e)
+		}
+		if alternative != nil {
+			return alternative(e)
+		}
+		return e.missingElse(node)
+	}
+}
+
+func (p *Program) getitem(node *nodes.Getitem) evalFunc {
+	target := p.expression(node.Node)
+	if slice, ok := node.Arg.(*nodes.Slice); ok {
+		var bounds [3]evalFunc
+		for idx, expr := range []nodes.Expression{slice.Start, slice.Stop, slice.Step} {
+			if expr != nil {
+				bounds[idx] = p.expression(expr)
+			}
+		}
+		return func(e *Evaluator) *Value {
+			value := target(e)
+			if result, stop := e.subscript(node, value); stop {
+				return result
+			}
+			var values [3]*Value
+			for idx, bound := range bounds {
+				if bound != nil {
+					values[idx] = bound(e)
+				}
+			}
+			return e.slice(value, slice, values)
+		}
+	}
+	arg := p.expression(node.Arg)
+	return func(e *Evaluator) *Value {
+		value := target(e)
+		if result, stop := e.subscript(node, value); stop {
+			return result
+		}
+		return e.getitem(node, value, arg(e))
+	}
+}
+
+func (p *Program) filtered(node *nodes.FilteredExpression) evalFunc {
+	inner := p.expression(node.Expression)
+	args := make([]func(e *Evaluator) (*VarArgs, error), len(node.Filters))
+	for idx, filter := range node.Filters {
+		args[idx] = p.varArgs(filter.Args, filter.Kwargs)
+	}
+	return func(e *Evaluator) *Value {
+		value := inner(e)
+		for idx, filter := range node.Filters {
+			params, err := args[idx](e)
+			if err == nil {
+				value = e.ExecuteFilterByName(filter.Name, value, params)
+			} else {
+				value = AsValue(err)
+			}
+			if value.IsError() {
+				return AsValue(errors.Wrapf(value, `Unable to evaluate filter %s`, filter))
+			}
+		}
+		return value
+	}
+}
+
+// call compiles a call, the function being called through reflection
+func (p *Program) call(node *nodes.Call) evalFunc {
+	positional, all := p.varArgs(node.Args, nil), p.varArgs(node.Args, node.Kwargs)
+	args := func(e *Evaluator, kwargs bool) (*VarArgs, error) {
+		if kwargs {
+			return all(e)
+		}
+		return positional(e)
+	}
+	if getattr, ok := node.Func.(*nodes.Getattr); ok && getattr.Attr != "" {
+		target := p.expression(getattr.Node)
+		return func(e *Evaluator) *Value {
+			return e.callAttr(node, getattr, target(e), args)
+		}
+	}
+	fn := p.expression(node.Func)
+	return func(e *Evaluator) *Value {
+		return e.call(node, fn(e), args)
+	}
+}
+
+// varArgs compiles the arguments of a call, a filter or a test as
+// Evaluator.varArgs evaluates them
+func (p *Program) varArgs(args []nodes.Expression, kwargs map[string]nodes.Expression) func(e *Evaluator) (*VarArgs, error) {
+	type kwarg struct {
+		key  string
+		expr nodes.Expression
+		fn   evalFunc
+	}
+	fns := make([]evalFunc, len(args))
+	for idx, arg := range args {
+		fns[idx] = p.expression(arg)
+	}
+	kwfns := make([]kwarg, 0, len(kwargs))
+	for key, arg := range kwargs {
+		kwfns = append(kwfns, kwarg{key, arg, p.expression(arg)})
+	}
+	return func(e *Evaluator) (*VarArgs, error) {
+		params := &VarArgs{Args: make([]*Value, 0, len(fns)), KwArgs: make(map[string]*Value, len(kwfns))}
+		for idx, fn := range fns {
+			value := fn(e)
+			if value.IsError() {
+				return nil, errors.Wrapf(value, `Unable to evaluate parameter %s`, args[idx])
+			}
+			params.Args = append(params.Args, value)
+		}
+		for _, kw := range kwfns {
+			value := kw.fn(e)
+			if value.IsError() {
+				return nil, errors.Wrapf(value, `Unable to evaluate parameter %s=%s`, kw.key, kw.expr)
+			}
+			params.KwArgs[kw.key] = value
+		}
+		return params, nil
+	}
+}
@@ -14,6 +14,16 @@ type EvalConfig struct {
 	Statements *StatementSet
 	Tests      *TestSet
 	Loader     TemplateLoader
+	// Undefined builds the values of missing names, attributes and items.
+	// Defaults to ChainableUndefined, or StrictUndefined if Config.StrictUndefined
+	// is set. DefaultUndefined fails on attribute and item accesses like Jinja.
+	Undefined UndefinedFunc
+	// Interpreted renders templates by walking their AST instead of running
+	// their compiled Program
+	Interpreted bool
+
+	// undefinedAccesses collects missing names, attributes and items when set
+	undefinedAccesses *[]*UndefinedAccess
 }
 
 func NewEvalConfig(cfg *config.Config) *EvalConfig {
@@ -34,6 +44,11 @@ func (cfg *EvalConfig) Inherit() *EvalConfig {
 		Statements: cfg.Statements,
 		Tests:      cfg.Tests,
 		Loader:     cfg.Loader,
+		Undefined:  cfg.Undefined,
+
+		Interpreted: cfg.Interpreted,
+
+		undefinedAccesses: cfg.undefinedAccesses,
 	}
 }
 
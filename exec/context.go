@@ -1,10 +1,28 @@
 package exec
 
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
 type Context struct {
-	data   map[string]any
-	parent *Context
+	data map[string]any
+	// sources are read-only layers of variables, looked up after data
+	sources []lookup
+	parent  *Context
+	// err is the error of the first invalid source
+	err error
+	// root is set on the context of a render, Replace never writes past it
+	// into the shared globals
+	root bool
 }
 
+// lookup returns the variable name of a context source
+type lookup func(name string) (any, bool)
+
+var typeOfVariables = reflect.TypeOf(map[string]any{})
+
 func NewContext(data map[string]any) *Context {
 	return &Context{data: data}
 }
@@ -13,16 +31,97 @@ func EmptyContext() *Context {
 	return &Context{data: map[string]any{}}
 }
 
-func (ctx *Context) Has(name string) bool {
-	_, exists := ctx.data[name]
-	if !exists && ctx.parent != nil {
-		return ctx.parent.Has(name)
+// Layers returns a context looking up its variables in several sources, in
+// order: a variable defined by a source hides the ones of the next sources.
+// Sources are maps, contexts, structs or pointers to structs whose fields and
+// methods are variables, or values implementing Getattrer or Getitemer.
+// They are not copied, and are left unchanged by the templates setting
+// variables. Other sources are skipped and reported by Err, templates
+// failing to render with such a context.
+//
+// Example:
+//
+//	tpl.Execute(exec.Layers(request, user, site))
+func Layers(sources ...any) *Context {
+	ctx := EmptyContext()
+	for _, source := range sources {
+		ctx.Layer(source)
+	}
+	return ctx
+}
+
+// lookupOf returns the lookup of the variables of a source
+func lookupOf(source any) (lookup, error) {
+	switch s := source.(type) {
+	case map[string]any:
+		return mapLookup(s), nil
+	case *Context:
+		return s.Get, s.err
+	}
+	val := reflect.ValueOf(source)
+	if val.Kind() == reflect.Map && val.Type().ConvertibleTo(typeOfVariables) {
+		return mapLookup(val.Convert(typeOfVariables).Interface().(map[string]any)), nil
+	}
+	value := ToValue(source)
+	if !isSource(val) {
+		if _, ok := value.host(protoGetattrer | protoGetitemer); !ok {
+			return nil, errors.Errorf(`Unable to use %T as context, expected a map, a struct, a pointer to a struct or a *Context`, source)
+		}
+	}
+	return func(name string) (any, bool) {
+		if value.IsNil() {
+			return nil, false
+		}
+		variable, found := value.Get(name)
+		if !found {
+			return nil, false
+		}
+		return variable, true
+	}, nil
+}
+
+// isSource returns true if val is a struct, a pointer to a struct or a map
+// with string keys
+func isSource(val reflect.Value) bool {
+	if val.Kind() == reflect.Ptr {
+		val = reflect.Zero(val.Type().Elem())
+	}
+	switch val.Kind() {
+	case reflect.Struct:
+		return true
+	case reflect.Map:
+		return val.Type().Key().Kind() == reflect.String
+	}
+	return false
+}
+
+func mapLookup(data map[string]any) lookup {
+	return func(name string) (any, bool) {
+		value, exists := data[name]
+		return value, exists
+	}
+}
+
+// lookup returns a variable defined by this context, without its parents
+func (ctx *Context) lookup(name string) (any, bool) {
+	if value, exists := ctx.data[name]; exists {
+		return value, true
 	}
+	for _, source := range ctx.sources {
+		if value, exists := source(name); exists {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (ctx *Context) Has(name string) bool {
+	_, exists := ctx.Get(name)
 	return exists
 }
 
 func (ctx *Context) Get(name string) (any, bool) {
-	value, exists := ctx.data[name]
+	value, exists := ctx.lookup(name)
 	if exists {
 		return value, true
 	} else if ctx.parent != nil {
@@ -36,6 +135,33 @@ func (ctx *Context) Set(name string, value any) {
 	ctx.data[name] = value
 }
 
+// Replace sets the value of name in the context defining it, hiding the
+// value of a source. A name defined by the globals of a render is hidden
+// in its root context instead. It returns false if name is not defined.
+func (ctx *Context) Replace(name string, value any) bool {
+	if _, exists := ctx.lookup(name); exists {
+		ctx.data[name] = value
+		return true
+	} else if ctx.parent == nil {
+		return false
+	} else if ctx.root {
+		if !ctx.parent.Has(name) {
+			return false
+		}
+		ctx.data[name] = value
+		return true
+	}
+	return ctx.parent.Replace(name, value)
+}
+
+// renderContext returns the root context of a render, looking up its
+// variables in ctx then in the globals
+func renderContext(globals *Context, ctx any) *Context {
+	root := globals.Inherit().Layer(ctx)
+	root.root = true
+	return root
+}
+
 func (ctx *Context) Inherit() *Context {
 	return &Context{
 		data:   map[string]any{},
@@ -51,7 +177,31 @@ func (ctx *Context) Update(other map[string]any) *Context {
 	return ctx
 }
 
-// Merge updates this context with the key/value pairs from another context.
+// Merge updates this context with the key/value pairs and the sources of
+// another context.
 func (ctx *Context) Merge(other *Context) *Context {
+	ctx.sources = append(ctx.sources, other.sources...)
 	return ctx.Update(other.data)
 }
+
+// Layer adds a source to the variables of this context, looked up after the
+// ones set on it and the sources already added. See Layers for the sources.
+func (ctx *Context) Layer(source any) *Context {
+	if source == nil {
+		return ctx
+	}
+	lookup, err := lookupOf(source)
+	if err != nil {
+		if ctx.err == nil {
+			ctx.err = err
+		}
+		return ctx
+	}
+	ctx.sources = append(ctx.sources, lookup)
+	return ctx
+}
+
+// Err returns the error of the first invalid source layered on this context
+func (ctx *Context) Err() error {
+	return ctx.err
+}
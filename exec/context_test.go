@@ -1,6 +1,7 @@
 package exec_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/MarioJim/gonja/exec"
@@ -95,3 +96,69 @@ func TestFuncContext(t *testing.T) {
 		})
 	}
 }
+
+type layerStruct struct {
+	Name   string `gonja:"name"`
+	Hidden string `gonja:"-"`
+}
+
+func (l *layerStruct) Greeting() string {
+	return "Hello " + l.Name
+}
+
+func TestContextLayers(t *testing.T) {
+	assert := assert.New(t)
+	request := map[string]any{"name": "request"}
+	user := &layerStruct{Name: "user", Hidden: "hidden"}
+	site := exec.NewContext(map[string]any{"site": "site", "name": "site"})
+	ctx := exec.Layers(request, nil, user, site)
+
+	for name, expected := range map[string]any{"name": "request", "site": "site"} {
+		value, ok := ctx.Get(name)
+		if assert.True(ok, name) {
+			assert.Equal(expected, exec.ToValue(value).Interface(), name)
+		}
+	}
+	greeting, ok := ctx.Get("Greeting")
+	if assert.True(ok) {
+		assert.Equal("Hello user", exec.ToValue(greeting).Interface().(func() string)())
+	}
+	assert.False(ctx.Has("Hidden"))
+	assert.False(ctx.Has("missing"))
+
+	// Sources are left unchanged
+	sub := ctx.Inherit()
+	assert.True(sub.Replace("site", "replaced"))
+	ctx.Set("name", "set")
+	value, _ := sub.Get("site")
+	assert.Equal("replaced", value)
+	value, _ = sub.Get("name")
+	assert.Equal("set", value)
+	assert.Equal("request", request["name"])
+	value, _ = site.Get("site")
+	assert.Equal("site", value)
+}
+
+type layerGetattrer struct{}
+
+func (layerGetattrer) Getattr(name string) (any, bool) {
+	return "attr " + name, true
+}
+
+func TestContextLayersInvalid(t *testing.T) {
+	for _, source := range []any{42, "str", []int{1}, map[int]string{1: "one"}, true} {
+		ctx := exec.Layers(map[string]any{"name": "valid"}, source, map[string]any{"other": "valid"})
+		if assert.Error(t, ctx.Err(), "%T", source) {
+			assert.Contains(t, ctx.Err().Error(), fmt.Sprintf("Unable to use %T as context", source))
+		}
+		assert.True(t, ctx.Has("name"))
+		assert.True(t, ctx.Has("other"))
+		assert.Error(t, exec.Layers(ctx).Err(), "layered contexts keep their error")
+	}
+	var user *layerStruct
+	for _, source := range []any{layerStruct{}, user, map[string]string{}, layerGetattrer{}, exec.EmptyContext()} {
+		assert.NoError(t, exec.Layers(source).Err(), "%T", source)
+	}
+	value, _ := exec.Layers(layerGetattrer{}).Get("name")
+	assert.Equal(t, "attr name", exec.ToValue(value).Interface())
+}
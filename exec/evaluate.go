@@ -1,8 +1,10 @@
 package exec
 
 import (
+	"fmt"
 	"math"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -18,13 +20,25 @@ var (
 type Evaluator struct {
 	*EvalConfig
 	Ctx *Context
+
+	// program holds the compiled expressions, if any
+	program *Program
+	// current is the template holding the evaluated expressions, if known
+	current *nodes.Template
 }
 
 func (r *Renderer) Evaluator() *Evaluator {
-	return &Evaluator{
+	program := r.compiled()
+	if e := r.evaluator; e != nil && e.EvalConfig == r.EvalConfig && e.Ctx == r.Ctx && e.program == program && e.current == r.Current {
+		return e
+	}
+	r.evaluator = &Evaluator{
 		EvalConfig: r.EvalConfig,
 		Ctx:        r.Ctx,
+		program:    program,
+		current:    r.Current,
 	}
+	return r.evaluator
 }
 
 func (r *Renderer) Eval(node nodes.Expression) *Value {
@@ -33,6 +47,16 @@ func (r *Renderer) Eval(node nodes.Expression) *Value {
 }
 
 func (e *Evaluator) Eval(node nodes.Expression) *Value {
+	if e.program != nil {
+		if fn, ok := e.program.expressions[node]; ok {
+			return fn(e)
+		}
+	}
+	return e.eval(node)
+}
+
+// eval interprets an expression
+func (e *Evaluator) eval(node nodes.Expression) *Value {
 	switch n := node.(type) {
 	case *nodes.None:
 		return AsValue(nil)
@@ -68,6 +92,8 @@ func (e *Evaluator) Eval(node nodes.Expression) *Value {
 			return result
 		}
 		return result.Negate()
+	case *nodes.Conditional:
+		return e.evalConditional(n)
 	case *nodes.BinaryExpression:
 		return e.evalBinaryExpression(n)
 	case *nodes.UnaryExpression:
@@ -81,12 +107,30 @@ func (e *Evaluator) Eval(node nodes.Expression) *Value {
 	}
 }
 
+func (e *Evaluator) evalConditional(node *nodes.Conditional) *Value {
+	condition := e.Eval(node.Condition)
+	if condition.IsError() {
+		return AsValue(errors.Wrapf(condition, `Unable to evaluate condition %s`, node.Condition))
+	}
+	if condition.IsTrue() {
+		return e.Eval(node.Expression)
+	}
+	if node.Alternative != nil {
+		return e.Eval(node.Alternative)
+	}
+	return e.missingElse(node)
+}
+
 func (e *Evaluator) evalBinaryExpression(node *nodes.BinaryExpression) *Value {
-	var (
-		left  *Value
-		right *Value
-	)
-	left = e.Eval(node.Left)
+	return e.binary(node, e.Eval(node.Left), func(e *Evaluator) *Value {
+		return e.Eval(node.Right)
+	})
+}
+
+// binary applies the operator of node to the evaluated left operand and to
+// the right operand evaluated by evalRight, lazily for "and" and "or"
+func (e *Evaluator) binary(node *nodes.BinaryExpression, left *Value, evalRight evalFunc) *Value {
+	var right *Value
 	if left.IsError() {
 		return AsValue(errors.Wrapf(left, `Unable to evaluate left parameter %s`, node.Left))
 	}
@@ -95,12 +139,26 @@ func (e *Evaluator) evalBinaryExpression(node *nodes.BinaryExpression) *Value {
 	// These operators allow lazy right expression evluation
 	case "and", "or":
 	default:
-		right = e.Eval(node.Right)
+		right = evalRight(e)
 		if right.IsError() {
 			return AsValue(errors.Wrapf(right, `Unable to evaluate right parameter %s`, node.Right))
 		}
 	}
 
+	switch node.Operator.Token.Type {
+	case tokens.Add, tokens.Sub, tokens.Mul, tokens.Div, tokens.Floordiv, tokens.Mod, tokens.Pow:
+		if result, ok := operate(node.Operator.Token.Val, left, right); ok {
+			if result.IsError() {
+				return AsValue(errors.Wrapf(result, `Unable to evaluate %s`, node))
+			}
+			return result
+		}
+	case tokens.Lt, tokens.Lteq, tokens.Gt, tokens.Gteq, tokens.Eq, tokens.Ne:
+		if result, ok := compared(node.Operator.Token.Val, left, right); ok {
+			return result
+		}
+	}
+
 	switch node.Operator.Token.Type {
 	case tokens.Add:
 		if left.IsList() {
@@ -120,6 +178,9 @@ func (e *Evaluator) evalBinaryExpression(node *nodes.BinaryExpression) *Value {
 
 			return v
 		}
+		if left.IsString() && right.IsString() {
+			return e.MarkupJoin(AsValue(""), left, right)
+		}
 		if left.IsFloat() || right.IsFloat() {
 			// Result will be a float
 			return AsValue(left.Float() + right.Float())
@@ -155,12 +216,12 @@ func (e *Evaluator) evalBinaryExpression(node *nodes.BinaryExpression) *Value {
 	case tokens.Pow:
 		return AsValue(math.Pow(left.Float(), right.Float()))
 	case tokens.Tilde:
-		return AsValue(strings.Join([]string{left.String(), right.String()}, ""))
+		return e.MarkupJoin(AsValue(""), left, right)
 	case tokens.And:
 		if !left.IsTrue() {
 			return AsValue(false)
 		}
-		right = e.Eval(node.Right)
+		right = evalRight(e)
 		if right.IsError() {
 			return AsValue(errors.Wrapf(right, `Unable to evaluate right parameter %s`, node.Right))
 		}
@@ -169,7 +230,7 @@ func (e *Evaluator) evalBinaryExpression(node *nodes.BinaryExpression) *Value {
 		if left.IsTrue() {
 			return AsValue(true)
 		}
-		right = e.Eval(node.Right)
+		right = evalRight(e)
 		if right.IsError() {
 			return AsValue(errors.Wrapf(right, `Unable to evaluate right parameter %s`, node.Right))
 		}
@@ -206,7 +267,11 @@ func (e *Evaluator) evalBinaryExpression(node *nodes.BinaryExpression) *Value {
 }
 
 func (e *Evaluator) evalUnaryExpression(expr *nodes.UnaryExpression) *Value {
-	result := e.Eval(expr.Term)
+	return e.unary(expr, e.Eval(expr.Term))
+}
+
+// unary applies the sign of expr to its evaluated term
+func (e *Evaluator) unary(expr *nodes.UnaryExpression, result *Value) *Value {
 	if result.IsError() {
 		return AsValue(errors.Wrapf(result, `Unable to evaluate term %s`, expr.Term))
 	}
@@ -271,22 +336,46 @@ func (e *Evaluator) evalPair(node *nodes.Pair) *Value {
 
 func (e *Evaluator) evalName(node *nodes.Name) *Value {
 	val, ok := e.Ctx.Get(node.Name.Val)
-	if !ok && e.Config.StrictUndefined {
-		return AsValue(errors.Errorf(`Unable to evaluate name "%s"`, node.Name.Val))
+	if !ok {
+		return e.undefined(node, node.Name.Val, fmt.Sprintf(`'%s' is undefined`, node.Name.Val))
 	}
 	return ToValue(val)
 }
 
 func (e *Evaluator) evalGetitem(node *nodes.Getitem) *Value {
 	value := e.Eval(node.Node)
+	if result, stop := e.subscript(node, value); stop {
+		return result
+	}
+	if slice, ok := node.Arg.(*nodes.Slice); ok {
+		var bounds [3]*Value
+		for idx, expr := range []nodes.Expression{slice.Start, slice.Stop, slice.Step} {
+			if expr != nil {
+				bounds[idx] = e.Eval(expr)
+			}
+		}
+		return e.slice(value, slice, bounds)
+	}
+	return e.getitem(node, value, e.Eval(node.Arg))
+}
+
+// subscript checks whether an evaluated target can be subscripted, returning
+// the result of node otherwise
+func (e *Evaluator) subscript(node *nodes.Getitem, value *Value) (*Value, bool) {
 	if value.IsError() {
-		return AsValue(errors.Wrapf(value, `Unable to evaluate target %s`, node.Node))
+		return AsValue(errors.Wrapf(value, `Unable to evaluate target %s`, node.Node)), true
 	}
 	if node.Arg == nil {
-		return AsValue(errors.Wrapf(value, `Argument not provided %s`, node.Node))
+		return AsValue(errors.Wrapf(value, `Argument not provided %s`, node.Node)), true
 	}
+	if value.IsUndefined() {
+		return e.undefinedAccess(value, node), true
+	}
+	return nil, false
+}
 
-	argument := e.Eval(node.Arg)
+// getitem looks up the item of node on an evaluated target
+func (e *Evaluator) getitem(node *nodes.Getitem, value, argument *Value) *Value {
 	var key any
 	switch {
 	case argument != nil && argument.IsString():
@@ -305,20 +394,117 @@ func (e *Evaluator) evalGetitem(node *nodes.Getitem) *Value {
 		if item.IsError() || argument.IsInteger() /* always fail when accessing array indexes */ {
 			return AsValue(errors.Wrapf(item, `Unable to evaluate %s`, node))
 		}
-		if e.Config.StrictUndefined {
-			return AsValue(errors.Errorf(`Unable to evaluate %s: item '%s' not found`, node, node.Arg))
+		name := exprName(node)
+		if name == "" {
+			name = argument.String()
 		}
-		return AsValue(nil)
+		return e.undefined(node, name, fmt.Sprintf(`'%s' has no item '%s'`, describe(node.Node), argument.String()))
 	}
 	return item
 }
 
+// slice slices an evaluated target, values holding the evaluated start, stop
+// and step of node, nil when omitted
+func (e *Evaluator) slice(value *Value, node *nodes.Slice, values [3]*Value) *Value {
+	if !value.CanSlice() {
+		return AsValue(errors.Errorf(`Unable to slice %s: not a list or a string`, value))
+	}
+
+	var bounds [3]*int
+	for idx, bound := range values {
+		if bound == nil {
+			continue
+		}
+		if bound.IsError() {
+			return AsValue(errors.Wrapf(bound, `Unable to evaluate slice %s`, node))
+		}
+		if bound.IsNil() {
+			continue
+		}
+		if !bound.IsInteger() {
+			return AsValue(errors.Errorf(`Slice indices must be integers, got %s in %s`, bound, node))
+		}
+		i := bound.Integer()
+		bounds[idx] = &i
+	}
+
+	step := 1
+	if bounds[2] != nil {
+		step = *bounds[2]
+	}
+	if step == 0 {
+		return AsValue(errors.Errorf(`Slice step cannot be zero in %s`, node))
+	}
+
+	length := value.Len()
+	start, stop := sliceIndices(length, bounds[0], bounds[1], step)
+	if step == 1 {
+		if stop < start {
+			stop = start
+		}
+		return AsValueLike(value, value.Slice(start, stop).Interface())
+	}
+
+	if value.IsString() {
+		runes := []rune(value.String())
+		sliced := []rune{}
+		for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+			sliced = append(sliced, runes[i])
+		}
+		return AsValueLike(value, string(sliced))
+	}
+
+	items := ValuesList{}
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		items = append(items, ToValue(value.getResolvedValue().Index(i)))
+	}
+	return AsValue(items)
+}
+
+// sliceIndices computes the effective start and stop indices of a slice
+// over a sequence of the given length, following Python semantics
+func sliceIndices(length int, start, stop *int, step int) (int, int) {
+	adjust := func(index *int, def int) int {
+		if index == nil {
+			return def
+		}
+		i := *index
+		if i < 0 {
+			i += length
+			if i < 0 {
+				if step < 0 {
+					return -1
+				}
+				return 0
+			}
+		} else if i >= length {
+			if step < 0 {
+				return length - 1
+			}
+			return length
+		}
+		return i
+	}
+
+	if step > 0 {
+		return adjust(start, 0), adjust(stop, length)
+	}
+	return adjust(start, length-1), adjust(stop, -1)
+}
+
 func (e *Evaluator) evalGetattr(node *nodes.Getattr) *Value {
 	value := e.Eval(node.Node)
 	if value.IsError() {
 		return AsValue(errors.Wrapf(value, `Unable to evaluate target %s`, node.Node))
 	}
+	return e.getattr(value, node)
+}
 
+// getattr looks up the attribute or item of node on an evaluated target
+func (e *Evaluator) getattr(value *Value, node *nodes.Getattr) *Value {
+	if value.IsUndefined() {
+		return e.undefinedAccess(value, node)
+	}
 	if node.Attr != "" {
 		attr, found := value.Getattr(node.Attr)
 		if !found {
@@ -328,10 +514,11 @@ func (e *Evaluator) evalGetattr(node *nodes.Getattr) *Value {
 			if attr.IsError() {
 				return AsValue(errors.Wrapf(attr, `Unable to evaluate %s`, node))
 			}
-			if e.Config.StrictUndefined {
-				return AsValue(errors.Errorf(`Unable to evaluate %s: attribute '%s' not found`, node, node.Attr))
+			name := exprName(node)
+			if name == "" {
+				name = node.Attr
 			}
-			return AsValue(nil)
+			return e.undefined(node, name, fmt.Sprintf(`'%s' has no attribute '%s'`, describe(node.Node), node.Attr))
 		}
 		return attr
 	} else {
@@ -340,17 +527,49 @@ func (e *Evaluator) evalGetattr(node *nodes.Getattr) *Value {
 			if item.IsError() {
 				return AsValue(errors.Wrapf(item, `Unable to evaluate %s`, node))
 			}
-			if e.Config.StrictUndefined {
-				return AsValue(errors.Errorf(`Unable to evaluate %s: item %d not found`, node, node.Index))
+			name := exprName(node)
+			if name == "" {
+				name = strconv.Itoa(node.Index)
 			}
-			return AsValue(nil)
+			return e.undefined(node, name, fmt.Sprintf(`'%s' has no item %d`, describe(node.Node), node.Index))
 		}
 		return item
 	}
 }
 
+// argsFunc evaluates the arguments of a call, the keyword ones only if
+// kwargs is true
+type argsFunc func(e *Evaluator, kwargs bool) (*VarArgs, error)
+
 func (e *Evaluator) evalCall(node *nodes.Call) *Value {
-	fn := e.Eval(node.Func)
+	args := func(e *Evaluator, kwargs bool) (*VarArgs, error) {
+		if kwargs {
+			return e.varArgs(node.Args, node.Kwargs)
+		}
+		return e.varArgs(node.Args, nil)
+	}
+	if getattr, ok := node.Func.(*nodes.Getattr); ok && getattr.Attr != "" {
+		return e.callAttr(node, getattr, e.Eval(getattr.Node), args)
+	}
+	return e.call(node, e.Eval(node.Func), args)
+}
+
+// callAttr calls an attribute of an evaluated target
+func (e *Evaluator) callAttr(node *nodes.Call, getattr *nodes.Getattr, target *Value, args argsFunc) *Value {
+	if target.IsError() {
+		return AsValue(errors.Wrapf(target, `Unable to evaluate target %s`, getattr.Node))
+	}
+	// Go methods and fields take precedence over builtin methods
+	if _, found := target.Getattr(getattr.Attr); !found {
+		if method, exists := MethodsFor(target)[getattr.Attr]; exists {
+			return e.callMethod(node, getattr, target, method, args)
+		}
+	}
+	return e.call(node, e.getattr(target, getattr), args)
+}
+
+// call calls an evaluated function with the arguments of node
+func (e *Evaluator) call(node *nodes.Call, fn *Value, args argsFunc) *Value {
 	if fn.IsError() {
 		return AsValue(errors.Wrapf(fn, `Unable to evaluate function "%s"`, node.Func))
 	}
@@ -366,10 +585,13 @@ func (e *Evaluator) evalCall(node *nodes.Call) *Value {
 	var err error
 	t := fn.Val.Type()
 
-	if t.NumIn() == 1 && t.In(0) == reflect.TypeOf(&VarArgs{}) {
-		params, err = e.evalVarArgs(node)
+	if t.NumIn() == 1 && t.In(0) == typeOfVarArgs {
+		var varArgs *VarArgs
+		if varArgs, err = args(e, true); err == nil {
+			params = []reflect.Value{reflect.ValueOf(varArgs)}
+		}
 	} else {
-		params, err = e.evalParams(node, fn)
+		params, err = e.evalParams(node, fn, args)
 	}
 	if err != nil {
 		return AsValue(errors.Wrapf(err, `Unable to evaluate parameters`))
@@ -393,6 +615,7 @@ func (e *Evaluator) evalCall(node *nodes.Call) *Value {
 
 	if rv.Type() != typeOfValuePtr {
 		current = reflect.ValueOf(rv.Interface())
+		isSafe = isSafeType(current)
 	} else {
 		// Return the function call value
 		current = rv.Interface().(*Value).Val
@@ -407,30 +630,91 @@ func (e *Evaluator) evalCall(node *nodes.Call) *Value {
 	return &Value{Val: current, Safe: isSafe}
 }
 
-func (e *Evaluator) evalVarArgs(node *nodes.Call) ([]reflect.Value, error) {
-	params := &VarArgs{
-		Args:   []*Value{},
-		KwArgs: map[string]*Value{},
+// callMethod calls a builtin method on self. Lists can't grow in place,
+// so a list method replacing self.Val updates the variable holding it.
+func (e *Evaluator) callMethod(node *nodes.Call, getattr *nodes.Getattr, self *Value, method MethodFunction, args argsFunc) *Value {
+	params, err := args(e, true)
+	if err != nil {
+		return AsValue(errors.Wrapf(err, `Unable to evaluate parameters of method '%s' at line %d col %d`,
+			getattr.Attr, node.Location.Line, node.Location.Col))
+	}
+
+	original := self.Val
+	result := method(e, self, params)
+	if result.IsError() {
+		return AsValue(errors.Wrapf(result, `Unable to call method '%s' at line %d col %d`,
+			getattr.Attr, node.Location.Line, node.Location.Col))
+	}
+
+	if self.Val != original {
+		if err := e.writeBack(getattr.Node, self.Interface()); err != nil {
+			return AsValue(errors.Wrapf(err, `Unable to call method '%s' at line %d col %d`,
+				getattr.Attr, node.Location.Line, node.Location.Col))
+		}
+	}
+	return result
+}
+
+// writeBack stores a list grown by a method where it was looked up: in the
+// context for a variable, or in its parent for the attributes and items of
+// variables such as `obj.items`
+func (e *Evaluator) writeBack(receiver nodes.Node, value any) error {
+	if exprName(receiver) == "" {
+		return errors.Errorf(`%s can't be modified in place`, receiver)
+	}
+	switch n := receiver.(type) {
+	case *nodes.Name:
+		e.Ctx.Replace(n.Name.Val, value)
+		return nil
+	case *nodes.Getattr:
+		parent := e.Eval(n.Node)
+		if n.Attr == "" {
+			return errors.Errorf(`%s can't be modified in place`, receiver)
+		}
+		return setItem(parent, AsValue(n.Attr), value)
+	case *nodes.Getitem:
+		parent, key := e.Eval(n.Node), e.Eval(n.Arg)
+		if key.IsError() {
+			return key
+		}
+		return setItem(parent, key, value)
+	}
+	return errors.Errorf(`%s can't be modified in place`, receiver)
+}
+
+// setItem sets an item of a dict or a field of a struct
+func setItem(parent, key *Value, value any) error {
+	if parent.IsDict() {
+		return dictSet(parent, key, ToValue(value))
 	}
-	for _, param := range node.Args {
-		value := e.Eval(param)
+	return parent.Set(key, value)
+}
+
+var typeOfVarArgs = reflect.TypeOf(&VarArgs{})
+
+// varArgs evaluates the arguments of a call, a filter or a test
+func (e *Evaluator) varArgs(args []nodes.Expression, kwargs map[string]nodes.Expression) (*VarArgs, error) {
+	params := NewVarArgs()
+	for _, arg := range args {
+		value := e.Eval(arg)
 		if value.IsError() {
-			return nil, value
+			return nil, errors.Wrapf(value, `Unable to evaluate parameter %s`, arg)
 		}
 		params.Args = append(params.Args, value)
 	}
-
-	for key, param := range node.Kwargs {
-		value := e.Eval(param)
+	for key, arg := range kwargs {
+		value := e.Eval(arg)
 		if value.IsError() {
-			return nil, value
+			return nil, errors.Wrapf(value, `Unable to evaluate parameter %s=%s`, key, arg)
 		}
 		params.KwArgs[key] = value
 	}
-	return []reflect.Value{reflect.ValueOf(params)}, nil
+	return params, nil
 }
 
-func (e *Evaluator) evalParams(node *nodes.Call, fn *Value) ([]reflect.Value, error) {
+// evalParams evaluates the positional arguments of a call to a Go function,
+// converting them to the types of its parameters
+func (e *Evaluator) evalParams(node *nodes.Call, fn *Value, evalArgs argsFunc) ([]reflect.Value, error) {
 	args := node.Args
 	t := fn.Val.Type()
 
@@ -452,11 +736,11 @@ func (e *Evaluator) evalParams(node *nodes.Call, fn *Value) ([]reflect.Value, er
 	isVariadic := t.IsVariadic()
 	var fnArg reflect.Type
 
-	for idx, arg := range args {
-		pv := e.Eval(arg)
-		if pv.IsError() {
-			return nil, pv
-		}
+	values, err := evalArgs(e, false)
+	if err != nil {
+		return nil, err
+	}
+	for idx, pv := range values.Args {
 
 		if isVariadic {
 			if idx >= numArgs-1 {
@@ -0,0 +1,72 @@
+package exec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
+)
+
+// Expression is an expression evaluated without a template around it, such
+// as the condition of a rule. It is parsed and compiled once, and can then be
+// evaluated concurrently with different contexts.
+type Expression struct {
+	Source string
+	Env    *EvalConfig
+	Root   nodes.Expression
+
+	// program is the compiled form of Root
+	program *Program
+}
+
+// NewExpression parses and compiles an expression
+func NewExpression(source string, cfg *EvalConfig) (*Expression, error) {
+	root, err := parser.ParseExpression("expression", source, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{
+		Source:  source,
+		Env:     cfg,
+		Root:    root,
+		program: CompileExpression(root),
+	}, nil
+}
+
+// Eval evaluates the expression and returns its value as a Go value, like
+// Template.ExecuteNative. The context is looked up like the one of
+// Template.Execute, the globals last.
+func (expr *Expression) Eval(ctx any) (any, error) {
+	e := &Evaluator{
+		EvalConfig: expr.Env,
+		Ctx:        renderContext(expr.Env.Globals, ctx),
+	}
+	if err := e.Ctx.Err(); err != nil {
+		return nil, errors.Wrapf(err, `Unable to evaluate %s`, expr.Source)
+	}
+	if !expr.Env.Interpreted {
+		e.program = expr.program
+	}
+	value := e.Eval(expr.Root)
+	if value.IsError() {
+		return nil, expr.error(value.Unwrap())
+	}
+	native := nativeValue(value)
+	if err, ok := native.(error); ok {
+		return nil, expr.error(err)
+	}
+	return native, nil
+}
+
+// error locates an evaluation error in the expression, unless the evaluator
+// already did
+func (expr *Expression) error(err error) error {
+	prefix := fmt.Sprintf(`Unable to evaluate %s`, expr.Source)
+	if strings.HasPrefix(err.Error(), prefix+":") {
+		return err
+	}
+	return errors.Wrap(err, prefix)
+}
@@ -0,0 +1,122 @@
+package exec
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// typeInfo holds what templates see of a type
+type typeInfo struct {
+	// fields are the index sequences of the exported fields of a struct,
+	// by their name in templates
+	fields map[string][]int
+	// methods are the indices of the exported methods, by name
+	methods map[string]int
+	// protocols are the interfaces of protocols.go it implements
+	protocols protocol
+}
+
+// typeCache holds the typeInfo of the types already seen, for a set of tags
+type typeCache struct {
+	tags  []string
+	types sync.Map // reflect.Type -> *typeInfo
+}
+
+var types atomic.Pointer[typeCache]
+
+func init() {
+	SetFieldTags("gonja")
+}
+
+// SetFieldTags sets the struct tags naming the fields seen by templates,
+// looked up in order: SetFieldTags("gonja", "json") falls back to json tags.
+// Fields tagged "-" and unexported fields are hidden from templates.
+// Defaults to "gonja".
+func SetFieldTags(tags ...string) {
+	types.Store(&typeCache{tags: tags})
+}
+
+// typeInfoOf returns the typeInfo of t, computing it the first time
+func typeInfoOf(t reflect.Type) *typeInfo {
+	cache := types.Load()
+	if info, ok := cache.types.Load(t); ok {
+		return info.(*typeInfo)
+	}
+	info, _ := cache.types.LoadOrStore(t, cache.typeInfo(t))
+	return info.(*typeInfo)
+}
+
+func (cache *typeCache) typeInfo(t reflect.Type) *typeInfo {
+	info := &typeInfo{
+		fields:    map[string][]int{},
+		methods:   map[string]int{},
+		protocols: protocolsOf(t),
+	}
+	for idx := 0; idx < t.NumMethod(); idx++ {
+		if method := t.Method(idx); method.IsExported() {
+			info.methods[method.Name] = idx
+		}
+	}
+	if t.Kind() != reflect.Struct {
+		return info
+	}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() {
+			continue
+		}
+		name, ok := cache.fieldName(field)
+		if !ok {
+			continue
+		}
+		// The shallowest field wins, as with promoted fields
+		if index, exists := info.fields[name]; exists && len(index) <= len(field.Index) {
+			continue
+		}
+		info.fields[name] = field.Index
+	}
+	return info
+}
+
+// fieldName returns the name of a field from its first tag found, or false
+// if it is tagged out
+func (cache *typeCache) fieldName(field reflect.StructField) (string, bool) {
+	for _, tag := range cache.tags {
+		value, ok := field.Tag.Lookup(tag)
+		if !ok {
+			continue
+		}
+		if value == "-" {
+			return "", false
+		}
+		if name, _, _ := strings.Cut(value, ","); name != "" {
+			return name, true
+		}
+		break
+	}
+	return field.Name, true
+}
+
+// lookupField returns the field of a struct seen by templates as name
+func lookupField(val reflect.Value, name string) (reflect.Value, bool) {
+	index, ok := typeInfoOf(val.Type()).fields[name]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	field, err := val.FieldByIndexErr(index)
+	if err != nil {
+		// Promoted through a nil embedded pointer
+		return reflect.Value{}, false
+	}
+	return field, true
+}
+
+// lookupMethod returns the exported method of a value
+func lookupMethod(val reflect.Value, name string) (reflect.Value, bool) {
+	idx, ok := typeInfoOf(val.Type()).methods[name]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return val.Method(idx), true
+}
@@ -62,22 +62,9 @@ func (e *Evaluator) EvaluateFiltered(expr *nodes.FilteredExpression) *Value {
 
 // ExecuteFilter execute a filter node
 func (e *Evaluator) ExecuteFilter(fc *nodes.FilterCall, v *Value) *Value {
-	params := NewVarArgs()
-
-	for _, param := range fc.Args {
-		value := e.Eval(param)
-		if value.IsError() {
-			return AsValue(errors.Wrapf(value, `Unable to evaluate parameter %s`, param))
-		}
-		params.Args = append(params.Args, value)
-	}
-
-	for key, param := range fc.Kwargs {
-		value := e.Eval(param)
-		if value.IsError() {
-			return AsValue(errors.Wrapf(value, `Unable to evaluate parameter %s=%s`, key, param))
-		}
-		params.KwArgs[key] = value
+	params, err := e.varArgs(fc.Args, fc.Kwargs)
+	if err != nil {
+		return AsValue(err)
 	}
 	return e.ExecuteFilterByName(fc.Name, v, params)
 }
@@ -0,0 +1,28 @@
+package exec
+
+import (
+	"html/template"
+	"reflect"
+)
+
+// safeTypes lists the html/template types whose content has already been
+// vetted by the caller and must not be escaped again by gonja. The JS, URL,
+// CSS and Srcset types are only safe in their own contexts, while gonja
+// writes HTML text, so they are escaped like strings.
+var safeTypes = map[reflect.Type]bool{
+	reflect.TypeOf(template.HTML("")):     true,
+	reflect.TypeOf(template.HTMLAttr("")): true,
+}
+
+// isSafeType returns true if val holds one of the html/template types
+// considered safe for output.
+func isSafeType(val reflect.Value) bool {
+	return val.IsValid() && safeTypes[val.Type()]
+}
+
+// HTML returns the value as an html/template HTML fragment, escaping it
+// unless it is marked as safe. It allows embedding gonja values into
+// html/template pages without double escaping.
+func (v *Value) HTML() template.HTML {
+	return template.HTML(v.Markup())
+}
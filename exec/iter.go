@@ -0,0 +1,144 @@
+package exec
+
+import (
+	"iter"
+	"reflect"
+)
+
+var typeOfBool = reflect.TypeOf(true)
+
+// All returns an iterator over the items of the value, in the order of
+// Iterate: the items of lists with a nil value, the keys and values of maps.
+// Iterator functions in the style of the iter package, channels, Iterator
+// and Iterable values are iterated lazily, an item at a time.
+func (v *Value) All() iter.Seq2[*Value, *Value] {
+	if seq, ok := v.lazy(); ok {
+		return seq
+	}
+	resolved := v.getResolvedValue()
+	switch resolved.Kind() {
+	case reflect.Array, reflect.Slice:
+		return func(yield func(key, value *Value) bool) {
+			for i := 0; i < resolved.Len(); i++ {
+				if !yield(ToValue(resolved.Index(i)), nil) {
+					return
+				}
+			}
+		}
+	}
+	return func(yield func(key, value *Value) bool) {
+		v.Iterate(func(idx, count int, key, value *Value) bool {
+			return yield(key, value)
+		}, func() {})
+	}
+}
+
+// IsLazy checks whether the value is iterated lazily, its items being
+// computed while iterating
+func (v *Value) IsLazy() bool {
+	_, ok := v.lazy()
+	return ok
+}
+
+// lazy returns the iterator over the items of a value iterated lazily
+func (v *Value) lazy() (iter.Seq2[*Value, *Value], bool) {
+	if host, ok := v.host(protoIterable | protoIterator); ok {
+		if it, ok := host.(Iterable); ok {
+			return func(yield func(key, value *Value) bool) {
+				it.Iterate(func(key, value any) bool {
+					if value == nil {
+						return yield(ToValue(key), nil)
+					}
+					return yield(ToValue(key), ToValue(value))
+				})
+			}, true
+		}
+		it := host.(Iterator)
+		return func(yield func(key, value *Value) bool) {
+			for {
+				item, ok := it.Next()
+				if !ok || !yield(ToValue(item), nil) {
+					return
+				}
+			}
+		}, true
+	}
+	resolved := v.getResolvedValue()
+	switch resolved.Kind() {
+	case reflect.Chan:
+		if resolved.Type().ChanDir()&reflect.RecvDir == 0 {
+			return nil, false
+		}
+		return func(yield func(key, value *Value) bool) {
+			for {
+				item, ok := resolved.Recv()
+				if !ok || !yield(ToValue(item), nil) {
+					return
+				}
+			}
+		}, true
+	case reflect.Func:
+		return seqFunc(resolved)
+	}
+	return nil, false
+}
+
+// seqFunc returns the iterator over the items yielded by an iterator function,
+// a func(yield func(V) bool) or a func(yield func(K, V) bool)
+func seqFunc(fn reflect.Value) (iter.Seq2[*Value, *Value], bool) {
+	t := fn.Type()
+	if fn.IsNil() || t.NumIn() != 1 || t.NumOut() != 0 || t.IsVariadic() {
+		return nil, false
+	}
+	yieldType := t.In(0)
+	if yieldType.Kind() != reflect.Func || yieldType.NumIn() < 1 || yieldType.NumIn() > 2 ||
+		yieldType.NumOut() != 1 || yieldType.Out(0) != typeOfBool {
+		return nil, false
+	}
+	return func(yield func(key, value *Value) bool) {
+		fn.Call([]reflect.Value{reflect.MakeFunc(yieldType, func(args []reflect.Value) []reflect.Value {
+			var value *Value
+			if len(args) == 2 {
+				value = ToValue(args[1])
+			}
+			return []reflect.Value{reflect.ValueOf(yield(ToValue(args[0]), value))}
+		})})
+	}, true
+}
+
+// materialize collects the items of an iterator, as a list for sequences and
+// as a Dict for mappings
+func materialize(seq iter.Seq2[*Value, *Value]) *Value {
+	keys, values := ValuesList{}, ValuesList{}
+	mapping := false
+	for key, value := range seq {
+		keys = append(keys, key)
+		values = append(values, value)
+		mapping = mapping || value != nil
+	}
+	if !mapping {
+		return AsValue(keys)
+	}
+	dict := NewDict()
+	for idx, key := range keys {
+		value := values[idx]
+		if value == nil {
+			value = AsValue(nil)
+		}
+		dict.Pairs = append(dict.Pairs, &Pair{key, value})
+	}
+	return AsValue(dict)
+}
+
+// countable checks whether the items of a lazy value can be counted without
+// consuming them, unlike the ones of channels and iterators
+func (v *Value) countable() bool {
+	if _, ok := v.host(protoIterable); ok {
+		return true
+	}
+	if resolved := v.getResolvedValue(); resolved.Kind() == reflect.Func {
+		_, ok := seqFunc(resolved)
+		return ok
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
 	"github.com/pkg/errors"
 )
 
@@ -53,7 +54,7 @@ func MacroNodeToFunc(node *nodes.Macro, r *Renderer) (Macro, error) {
 		macroArguments := make([]*Pair, len(node.Kwargs))
 		for i, positionalArgument := range params.Args {
 			if i >= len(node.Kwargs) {
-				return AsValue(fmt.Errorf("macro '%s' received %d arguments but expected only %d", node.Name, len(params.Args), len(node.Wrapper.Nodes)))
+				return AsValue(fmt.Errorf("macro '%s' received %d arguments but expected only %d", node.Name, len(params.Args), len(node.Kwargs)))
 			}
 			key := r.Eval(node.Kwargs[i].Key)
 			if key.IsError() {
@@ -104,7 +105,9 @@ func MacroNodeToFunc(node *nodes.Macro, r *Renderer) (Macro, error) {
 			sub.Ctx.Set(arg.Key.String(), arg.Value)
 		}
 		err := sub.ExecuteWrapper(node.Wrapper)
-		if err != nil {
+		if _, ok := parser.AsTemplateError(err); ok {
+			return AsValue(AddFrame(err, "macro", node.Name))
+		} else if err != nil {
 			return AsValue(errors.Wrapf(err, `Unable to execute macro '%s'`, node.Name))
 		}
 		return AsSafeValue(out.String())
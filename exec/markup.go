@@ -0,0 +1,51 @@
+package exec
+
+import (
+	"strings"
+)
+
+// AsValueLike works like AsValue, but the returned value inherits the Safe
+// flag of src. It is meant for filters transforming a string without
+// changing its escaping needs (e.g. 'upper' on a safe value stays safe).
+func AsValueLike(src *Value, i any) *Value {
+	value := AsValue(i)
+	value.Safe = value.Safe || src.Safe
+	return value
+}
+
+// hasSafe reports whether at least one of the values is marked as safe
+func hasSafe(values ...*Value) bool {
+	for _, value := range values {
+		if value != nil && value.Safe {
+			return true
+		}
+	}
+	return false
+}
+
+// Markup returns the value as a markup string: unchanged if it is safe,
+// escaped otherwise.
+func (v *Value) Markup() string {
+	if v.Safe {
+		return v.String()
+	}
+	return v.Escaped()
+}
+
+// MarkupJoin concatenates values with sep following Jinja2's Markup
+// semantics: when autoescaping is enabled and any of them is safe, the
+// unsafe ones are escaped and the result is marked as safe. Otherwise
+// values are joined as plain strings.
+func (e *Evaluator) MarkupJoin(sep *Value, values ...*Value) *Value {
+	parts := make([]string, 0, len(values))
+	if e.Autoescape && hasSafe(append(values, sep)...) {
+		for _, value := range values {
+			parts = append(parts, value.Markup())
+		}
+		return AsSafeValue(strings.Join(parts, sep.Markup()))
+	}
+	for _, value := range values {
+		parts = append(parts, value.String())
+	}
+	return AsValue(strings.Join(parts, sep.String()))
+}
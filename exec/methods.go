@@ -0,0 +1,905 @@
+package exec
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// MethodFunction is the type builtin methods must fulfil
+type MethodFunction func(e *Evaluator, self *Value, params *VarArgs) *Value
+
+// MethodSet maps method names to their MethodFunction handler
+type MethodSet map[string]MethodFunction
+
+// StringMethods holds the Python str methods callable on strings
+var StringMethods = MethodSet{
+	"capitalize": strCapitalize,
+	"center":     strCenter,
+	"count":      strCount,
+	"endswith":   strEndswith,
+	"find":       strFind,
+	"index":      strIndex,
+	"isalnum":    strIsFunc(func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }),
+	"isalpha":    strIsFunc(unicode.IsLetter),
+	"isdigit":    strIsFunc(unicode.IsDigit),
+	"islower":    strIsLower,
+	"isspace":    strIsFunc(unicode.IsSpace),
+	"isupper":    strIsUpper,
+	"join":       strJoin,
+	"ljust":      strLjust,
+	"lower":      strMap(strings.ToLower),
+	"lstrip":     strStrip(strings.TrimLeft, func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }),
+	"replace":    strReplace,
+	"rfind":      strRfind,
+	"rjust":      strRjust,
+	"rsplit":     strRsplit,
+	"rstrip":     strStrip(strings.TrimRight, func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }),
+	"split":      strSplit,
+	"splitlines": strSplitlines,
+	"startswith": strStartswith,
+	"strip":      strStrip(strings.Trim, strings.TrimSpace),
+	"swapcase":   strMap(strSwapcase),
+	"title":      strTitle,
+	"upper":      strMap(strings.ToUpper),
+	"zfill":      strZfill,
+}
+
+// ListMethods holds the Python list methods callable on lists and tuples
+var ListMethods = MethodSet{
+	"append":  listAppend,
+	"clear":   listClear,
+	"copy":    listCopy,
+	"count":   listCount,
+	"extend":  listExtend,
+	"index":   listIndex,
+	"insert":  listInsert,
+	"pop":     listPop,
+	"remove":  listRemove,
+	"reverse": listReverse,
+	"sort":    listSort,
+}
+
+// DictMethods holds the Python dict methods callable on dicts and maps
+var DictMethods = MethodSet{
+	"clear":      dictClear,
+	"copy":       dictCopy,
+	"get":        dictGet,
+	"items":      dictItems,
+	"keys":       dictKeys,
+	"pop":        dictPop,
+	"setdefault": dictSetdefault,
+	"update":     dictUpdate,
+	"values":     dictValues,
+}
+
+// MethodsFor returns the builtin methods available on a value
+// or nil if it has none
+func MethodsFor(value *Value) MethodSet {
+	switch {
+	case value.IsString():
+		return StringMethods
+	case value.IsList():
+		return ListMethods
+	case value.IsDict():
+		return DictMethods
+	}
+	return nil
+}
+
+// String methods
+
+// strTitle creates its caser on each call, casers holding state
+func strTitle(e *Evaluator, self *Value, params *VarArgs) *Value {
+	return strMap(cases.Title(language.English).String)(e, self, params)
+}
+
+func strMap(fn func(string) string) MethodFunction {
+	return func(e *Evaluator, self *Value, params *VarArgs) *Value {
+		if p := params.ExpectNothing(); p.IsError() {
+			return AsValue(p)
+		}
+		return AsValueLike(self, fn(self.String()))
+	}
+}
+
+func strSwapcase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+func strCapitalize(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	runes := []rune(self.String())
+	if len(runes) == 0 {
+		return self
+	}
+	return AsValueLike(self, strings.ToUpper(string(runes[0]))+strings.ToLower(string(runes[1:])))
+}
+
+func strIsFunc(fn func(rune) bool) MethodFunction {
+	return func(e *Evaluator, self *Value, params *VarArgs) *Value {
+		if p := params.ExpectNothing(); p.IsError() {
+			return AsValue(p)
+		}
+		s := self.String()
+		if s == "" {
+			return AsValue(false)
+		}
+		for _, r := range s {
+			if !fn(r) {
+				return AsValue(false)
+			}
+		}
+		return AsValue(true)
+	}
+}
+
+// strHasCased reports whether s has cased characters and
+// all of them satisfy fn
+func strHasCased(s string, fn func(rune) bool) bool {
+	cased := false
+	for _, r := range s {
+		if unicode.IsUpper(r) || unicode.IsLower(r) || unicode.IsTitle(r) {
+			if !fn(r) {
+				return false
+			}
+			cased = true
+		}
+	}
+	return cased
+}
+
+func strIsLower(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	return AsValue(strHasCased(self.String(), unicode.IsLower))
+}
+
+func strIsUpper(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	return AsValue(strHasCased(self.String(), unicode.IsUpper))
+}
+
+func strStrip(trim func(string, string) string, trimSpace func(string) string) MethodFunction {
+	return func(e *Evaluator, self *Value, params *VarArgs) *Value {
+		p := params.Expect(0, []*KwArg{{Name: "chars", Default: nil}})
+		if p.IsError() {
+			return AsValue(p)
+		}
+		chars := p.KwArgs["chars"]
+		if chars.IsNil() {
+			return AsValueLike(self, trimSpace(self.String()))
+		}
+		return AsValueLike(self, trim(self.String(), chars.String()))
+	}
+}
+
+// strPrefixes returns the prefixes or suffixes given to startswith or endswith,
+// which can be either a string or a list of strings
+func strPrefixes(arg *Value) []string {
+	if !arg.IsList() {
+		return []string{arg.String()}
+	}
+	prefixes := []string{}
+	for i := 0; i < arg.Len(); i++ {
+		prefixes = append(prefixes, arg.Index(i).String())
+	}
+	return prefixes
+}
+
+func strStartswith(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	for _, prefix := range strPrefixes(p.First()) {
+		if strings.HasPrefix(self.String(), prefix) {
+			return AsValue(true)
+		}
+	}
+	return AsValue(false)
+}
+
+func strEndswith(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	for _, suffix := range strPrefixes(p.First()) {
+		if strings.HasSuffix(self.String(), suffix) {
+			return AsValue(true)
+		}
+	}
+	return AsValue(false)
+}
+
+// strSplitList converts the result of a split into a list of values
+func strSplitList(self *Value, parts []string) *Value {
+	list := ValuesList{}
+	for _, part := range parts {
+		list = append(list, AsValueLike(self, part))
+	}
+	return AsValue(list)
+}
+
+func strSplit(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.Expect(0, []*KwArg{{Name: "sep", Default: nil}, {Name: "maxsplit", Default: -1}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	s := self.String()
+	maxsplit := p.KwArgs["maxsplit"].Integer()
+	sep := p.KwArgs["sep"]
+	if !sep.IsNil() {
+		if sep.String() == "" {
+			return AsValue(errors.New("empty separator"))
+		}
+		n := -1
+		if maxsplit >= 0 {
+			n = maxsplit + 1
+		}
+		return strSplitList(self, strings.SplitN(s, sep.String(), n))
+	}
+
+	parts := []string{}
+	for maxsplit != 0 {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		idx := strings.IndexFunc(s, unicode.IsSpace)
+		if idx < 0 {
+			break
+		}
+		parts = append(parts, s[:idx])
+		s = s[idx:]
+		maxsplit--
+	}
+	if s = strings.TrimLeftFunc(s, unicode.IsSpace); s != "" {
+		if maxsplit != 0 {
+			s = strings.TrimRightFunc(s, unicode.IsSpace)
+		}
+		parts = append(parts, s)
+	}
+	return strSplitList(self, parts)
+}
+
+func strRsplit(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.Expect(0, []*KwArg{{Name: "sep", Default: nil}, {Name: "maxsplit", Default: -1}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	s := self.String()
+	maxsplit := p.KwArgs["maxsplit"].Integer()
+	sep := p.KwArgs["sep"]
+	if sep.IsNil() && maxsplit < 0 {
+		return strSplitList(self, strings.Fields(s))
+	}
+	if !sep.IsNil() && sep.String() == "" {
+		return AsValue(errors.New("empty separator"))
+	}
+
+	parts := []string{}
+	for maxsplit != 0 {
+		var idx, width int
+		if sep.IsNil() {
+			s = strings.TrimRightFunc(s, unicode.IsSpace)
+			idx = strings.LastIndexFunc(s, unicode.IsSpace)
+			if idx >= 0 {
+				_, width = utf8.DecodeRuneInString(s[idx:])
+			}
+		} else {
+			idx, width = strings.LastIndex(s, sep.String()), len(sep.String())
+		}
+		if idx < 0 {
+			break
+		}
+		parts = append([]string{s[idx+width:]}, parts...)
+		s = s[:idx]
+		maxsplit--
+	}
+	if sep.IsNil() {
+		s = strings.TrimRightFunc(s, unicode.IsSpace)
+		if s == "" {
+			return strSplitList(self, parts)
+		}
+	}
+	return strSplitList(self, append([]string{s}, parts...))
+}
+
+func strSplitlines(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.Expect(0, []*KwArg{{Name: "keepends", Default: false}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	keepends := p.KwArgs["keepends"].IsTrue()
+	s := self.String()
+	lines := []string{}
+	for s != "" {
+		idx := strings.IndexAny(s, "\r\n")
+		if idx < 0 {
+			lines = append(lines, s)
+			break
+		}
+		end := idx + 1
+		if strings.HasPrefix(s[idx:], "\r\n") {
+			end++
+		}
+		if keepends {
+			lines = append(lines, s[:end])
+		} else {
+			lines = append(lines, s[:idx])
+		}
+		s = s[end:]
+	}
+	return strSplitList(self, lines)
+}
+
+func strJoin(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	iterable := p.First()
+	if !iterable.IsIterable() {
+		return AsValue(errors.Errorf(`can only join an iterable, got %s`, iterable))
+	}
+	items := []*Value{}
+	iterable.Iterate(func(idx, count int, key, value *Value) bool {
+		items = append(items, key)
+		return true
+	}, func() {})
+	return e.MarkupJoin(self, items...)
+}
+
+func strReplace(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.Expect(2, []*KwArg{{Name: "count", Default: -1}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	replaced := strings.Replace(self.String(), p.Args[0].String(), p.Args[1].String(), p.KwArgs["count"].Integer())
+	return AsValueLike(self, replaced)
+}
+
+// runeIndex converts a byte index of s into a character index
+func runeIndex(s string, idx int) int {
+	if idx < 0 {
+		return idx
+	}
+	return len([]rune(s[:idx]))
+}
+
+func strFind(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	s := self.String()
+	return AsValue(runeIndex(s, strings.Index(s, p.First().String())))
+}
+
+func strRfind(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	s := self.String()
+	return AsValue(runeIndex(s, strings.LastIndex(s, p.First().String())))
+}
+
+func strIndex(e *Evaluator, self *Value, params *VarArgs) *Value {
+	idx := strFind(e, self, params)
+	if !idx.IsError() && idx.Integer() < 0 {
+		return AsValue(errors.New("substring not found"))
+	}
+	return idx
+}
+
+func strCount(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	return AsValue(strings.Count(self.String(), p.First().String()))
+}
+
+// strPad pads self to the width given in params, pad being given the number
+// of missing characters
+func strPad(self *Value, params *VarArgs, pad func(s, fill string, missing int) string) *Value {
+	p := params.Expect(1, []*KwArg{{Name: "fillchar", Default: " "}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	fill := p.KwArgs["fillchar"].String()
+	if len([]rune(fill)) != 1 {
+		return AsValue(errors.New("the fill character must be exactly one character long"))
+	}
+	s := self.String()
+	missing := p.First().Integer() - len([]rune(s))
+	if missing <= 0 {
+		return self
+	}
+	return AsValueLike(self, pad(s, fill, missing))
+}
+
+func strCenter(e *Evaluator, self *Value, params *VarArgs) *Value {
+	return strPad(self, params, func(s, fill string, missing int) string {
+		width := missing + len([]rune(s))
+		left := missing/2 + (missing & width & 1)
+		return strings.Repeat(fill, left) + s + strings.Repeat(fill, missing-left)
+	})
+}
+
+func strLjust(e *Evaluator, self *Value, params *VarArgs) *Value {
+	return strPad(self, params, func(s, fill string, missing int) string {
+		return s + strings.Repeat(fill, missing)
+	})
+}
+
+func strRjust(e *Evaluator, self *Value, params *VarArgs) *Value {
+	return strPad(self, params, func(s, fill string, missing int) string {
+		return strings.Repeat(fill, missing) + s
+	})
+}
+
+func strZfill(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	s := self.String()
+	missing := p.First().Integer() - len([]rune(s))
+	if missing <= 0 {
+		return self
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		sign, s = s[:1], s[1:]
+	}
+	return AsValueLike(self, sign+strings.Repeat("0", missing)+s)
+}
+
+// List methods
+
+// listItems returns the items of a list as values
+func listItems(self *Value) ValuesList {
+	items := ValuesList{}
+	resolved := self.getResolvedValue()
+	for i := 0; i < resolved.Len(); i++ {
+		items = append(items, ToValue(resolved.Index(i)))
+	}
+	return items
+}
+
+// elemOf converts an item to the element type of a list or a map
+func elemOf(container reflect.Value, item *Value) (reflect.Value, error) {
+	elemType := container.Type().Elem()
+	if elemType == typeOfValuePtr {
+		return reflect.ValueOf(item), nil
+	}
+	if item.IsNil() {
+		return reflect.Zero(elemType), nil
+	}
+	val := reflect.ValueOf(item.Interface())
+	if val.Type().AssignableTo(elemType) {
+		return val, nil
+	}
+	if val.Type().ConvertibleTo(elemType) {
+		return val.Convert(elemType), nil
+	}
+	return reflect.Value{}, errors.Errorf(`Can't add %s to a container of %s`, item, elemType)
+}
+
+// listSet replaces the content of a list. The list is updated in place
+// when possible, otherwise self holds the new list.
+func listSet(self *Value, items ValuesList) *Value {
+	resolved := self.getResolvedValue()
+	if resolved.Kind() == reflect.Array {
+		return AsValue(errors.New(`Can't modify a fixed size array`))
+	}
+	list := reflect.MakeSlice(resolved.Type(), 0, len(items))
+	for _, item := range items {
+		elem, err := elemOf(list, item)
+		if err != nil {
+			return AsValue(err)
+		}
+		list = reflect.Append(list, elem)
+	}
+	if resolved.CanSet() {
+		resolved.Set(list)
+	} else {
+		self.Val = list
+	}
+	return AsValue(nil)
+}
+
+// listPosition resolves a Python index on a list of the given length
+func listPosition(index, length int) int {
+	if index < 0 {
+		index += length
+	}
+	return index
+}
+
+func listAppend(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	return listSet(self, append(listItems(self), p.First()))
+}
+
+func listExtend(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	other := p.First()
+	if !other.IsIterable() {
+		return AsValue(errors.Errorf(`%s is not iterable`, other))
+	}
+	items := listItems(self)
+	other.Iterate(func(idx, count int, key, value *Value) bool {
+		items = append(items, key)
+		return true
+	}, func() {})
+	return listSet(self, items)
+}
+
+func listInsert(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(2)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	items := listItems(self)
+	index := listPosition(p.Args[0].Integer(), len(items))
+	if index < 0 {
+		index = 0
+	} else if index > len(items) {
+		index = len(items)
+	}
+	items = append(items[:index], append(ValuesList{p.Args[1]}, items[index:]...)...)
+	return listSet(self, items)
+}
+
+func listPop(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.Expect(0, []*KwArg{{Name: "index", Default: -1}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	items := listItems(self)
+	index := listPosition(p.KwArgs["index"].Integer(), len(items))
+	if index < 0 || index >= len(items) {
+		return AsValue(errors.New("pop index out of range"))
+	}
+	item := items[index]
+	if set := listSet(self, append(items[:index:index], items[index+1:]...)); set.IsError() {
+		return set
+	}
+	return item
+}
+
+func listRemove(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	items := listItems(self)
+	for idx, item := range items {
+		if item.EqualValueTo(p.First()) {
+			return listSet(self, append(items[:idx:idx], items[idx+1:]...))
+		}
+	}
+	return AsValue(errors.Errorf(`%s is not in list`, p.First()))
+}
+
+func listClear(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	return listSet(self, ValuesList{})
+}
+
+func listReverse(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	items := listItems(self)
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return listSet(self, items)
+}
+
+func listSort(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectKwArgs([]*KwArg{{Name: "reverse", Default: false}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	items := listItems(self)
+	if p.KwArgs["reverse"].IsTrue() {
+		sort.Stable(sort.Reverse(items))
+	} else {
+		sort.Stable(items)
+	}
+	return listSet(self, items)
+}
+
+func listCopy(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	return AsValue(listItems(self))
+}
+
+func listCount(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	count := 0
+	for _, item := range listItems(self) {
+		if item.EqualValueTo(p.First()) {
+			count++
+		}
+	}
+	return AsValue(count)
+}
+
+func listIndex(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.ExpectArgs(1)
+	if p.IsError() {
+		return AsValue(p)
+	}
+	for idx, item := range listItems(self) {
+		if item.EqualValueTo(p.First()) {
+			return AsValue(idx)
+		}
+	}
+	return AsValue(errors.Errorf(`%s is not in list`, p.First()))
+}
+
+// Dict methods
+
+// dictLookup returns the value at key in a dict or a map
+func dictLookup(self *Value, key *Value) (*Value, bool) {
+	resolved := self.getResolvedValue()
+	if resolved.Kind() == reflect.Map {
+		mapKey, err := mapKeyOf(resolved, key)
+		if err != nil {
+			return AsValue(nil), false
+		}
+		item := resolved.MapIndex(mapKey)
+		if !item.IsValid() {
+			return AsValue(nil), false
+		}
+		return ToValue(item), true
+	}
+	for _, pair := range dictPairs(self) {
+		if pair.Key.EqualValueTo(key) {
+			return pair.Value, true
+		}
+	}
+	return AsValue(nil), false
+}
+
+// mapKeyOf converts key to the key type of a map
+func mapKeyOf(m reflect.Value, key *Value) (reflect.Value, error) {
+	keyType := m.Type().Key()
+	if keyType == typeOfValuePtr {
+		return reflect.ValueOf(key), nil
+	}
+	if key.IsNil() {
+		return reflect.Value{}, errors.New(`None can't be used as a key`)
+	}
+	val := reflect.ValueOf(key.Interface())
+	if val.Type().AssignableTo(keyType) {
+		return val, nil
+	}
+	if val.Type().ConvertibleTo(keyType) {
+		return val.Convert(keyType), nil
+	}
+	return reflect.Value{}, errors.Errorf(`Can't use %s as a key of type %s`, key, keyType)
+}
+
+// dictPairs returns the key/value pairs of a dict or a map,
+// in the same order as Value.Keys
+func dictPairs(self *Value) []*Pair {
+	resolved := self.getResolvedValue()
+	if resolved.Type() == TypeDict {
+		return resolved.Interface().(Dict).Pairs
+	}
+	pairs := []*Pair{}
+	for _, key := range self.Keys() {
+		pairs = append(pairs, &Pair{key, ToValue(resolved.MapIndex(key.Val))})
+	}
+	return pairs
+}
+
+// dictSet sets the value at key in a dict or a map
+func dictSet(self *Value, key *Value, value *Value) error {
+	resolved := self.getResolvedValue()
+	if resolved.Kind() == reflect.Map {
+		mapKey, err := mapKeyOf(resolved, key)
+		if err != nil {
+			return err
+		}
+		elem, err := elemOf(resolved, value)
+		if err != nil {
+			return err
+		}
+		resolved.SetMapIndex(mapKey, elem)
+		return nil
+	}
+	dict, ok := self.Interface().(*Dict)
+	if !ok {
+		return errors.New(`Can't modify a dict passed by value`)
+	}
+	for _, pair := range dict.Pairs {
+		if pair.Key.EqualValueTo(key) {
+			pair.Value = value
+			return nil
+		}
+	}
+	dict.Pairs = append(dict.Pairs, &Pair{key, value})
+	return nil
+}
+
+// dictDelete removes key from a dict or a map
+func dictDelete(self *Value, key *Value) error {
+	resolved := self.getResolvedValue()
+	if resolved.Kind() == reflect.Map {
+		mapKey, err := mapKeyOf(resolved, key)
+		if err != nil {
+			return err
+		}
+		resolved.SetMapIndex(mapKey, reflect.Value{})
+		return nil
+	}
+	dict, ok := self.Interface().(*Dict)
+	if !ok {
+		return errors.New(`Can't modify a dict passed by value`)
+	}
+	for idx, pair := range dict.Pairs {
+		if pair.Key.EqualValueTo(key) {
+			dict.Pairs = append(dict.Pairs[:idx:idx], dict.Pairs[idx+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func dictKeys(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	return AsValue(self.Keys())
+}
+
+func dictValues(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	values := ValuesList{}
+	for _, pair := range dictPairs(self) {
+		values = append(values, pair.Value)
+	}
+	return AsValue(values)
+}
+
+func dictItems(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	items := ValuesList{}
+	for _, pair := range dictPairs(self) {
+		items = append(items, AsValue(ValuesList{pair.Key, pair.Value}))
+	}
+	return AsValue(items)
+}
+
+func dictGet(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.Expect(1, []*KwArg{{Name: "default", Default: nil}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	if value, found := dictLookup(self, p.First()); found {
+		return value
+	}
+	return p.KwArgs["default"]
+}
+
+func dictPop(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.Expect(1, []*KwArg{{Name: "default", Default: nil}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	value, found := dictLookup(self, p.First())
+	if !found {
+		if _, hasDefault := params.KwArgs["default"]; hasDefault || len(params.Args) > 1 {
+			return p.KwArgs["default"]
+		}
+		return AsValue(errors.Errorf(`Key %s not found`, p.First()))
+	}
+	if err := dictDelete(self, p.First()); err != nil {
+		return AsValue(err)
+	}
+	return value
+}
+
+func dictSetdefault(e *Evaluator, self *Value, params *VarArgs) *Value {
+	p := params.Expect(1, []*KwArg{{Name: "default", Default: nil}})
+	if p.IsError() {
+		return AsValue(p)
+	}
+	if value, found := dictLookup(self, p.First()); found {
+		return value
+	}
+	if err := dictSet(self, p.First(), p.KwArgs["default"]); err != nil {
+		return AsValue(err)
+	}
+	return p.KwArgs["default"]
+}
+
+func dictUpdate(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if len(params.Args) > 1 {
+		return AsValue(errors.Errorf(`Expected at most 1 argument, got %d`, len(params.Args)))
+	}
+	for _, arg := range params.Args {
+		if !arg.IsDict() {
+			return AsValue(errors.Errorf(`%s is not a dict`, arg))
+		}
+		for _, pair := range dictPairs(arg) {
+			if err := dictSet(self, pair.Key, pair.Value); err != nil {
+				return AsValue(err)
+			}
+		}
+	}
+	keys := make([]string, 0, len(params.KwArgs))
+	for key := range params.KwArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := dictSet(self, AsValue(key), params.KwArgs[key]); err != nil {
+			return AsValue(err)
+		}
+	}
+	return AsValue(nil)
+}
+
+func dictClear(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	for _, key := range self.Keys() {
+		if err := dictDelete(self, key); err != nil {
+			return AsValue(err)
+		}
+	}
+	return AsValue(nil)
+}
+
+func dictCopy(e *Evaluator, self *Value, params *VarArgs) *Value {
+	if p := params.ExpectNothing(); p.IsError() {
+		return AsValue(p)
+	}
+	pairs := []*Pair{}
+	for _, pair := range dictPairs(self) {
+		pairs = append(pairs, &Pair{pair.Key, pair.Value})
+	}
+	return AsValue(&Dict{pairs})
+}
@@ -0,0 +1,84 @@
+package exec
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// checkNames returns the first unknown filter or test of the template, or
+// the first call with invalid arguments to a macro known statically
+func (tpl *Template) checkNames() error {
+	errs := []*parser.TemplateError{}
+	fail := func(token *tokens.Token, format string, args ...interface{}) {
+		errs = append(errs, parser.NewTemplateError(tpl.Name, tpl.Source, token, fmt.Sprintf(format, args...), nil))
+	}
+
+	macros := map[*nodes.Name]*nodes.Macro{}
+	analysis.AnalyzeWith(tpl.Root, &analysis.Hooks{
+		Filter: func(call *nodes.FilterCall) {
+			if !tpl.Env.Filters.Exists(call.Name) {
+				fail(call.Token, `Filter "%s" not found`, call.Name)
+			}
+		},
+		Test: func(call *nodes.TestCall) {
+			if !tpl.Env.Tests.Exists(call.Name) {
+				fail(call.Token, `Test "%s" not found`, call.Name)
+			}
+		},
+		Read: func(name *nodes.Name, declaration nodes.Node) {
+			if macro, ok := declaration.(*nodes.Macro); ok {
+				macros[name] = macro
+			}
+		},
+	})
+
+	nodes.Inspect(tpl.Root, func(node nodes.Node) bool {
+		call, ok := node.(*nodes.Call)
+		if !ok {
+			return true
+		}
+		if name, ok := call.Func.(*nodes.Name); ok && macros[name] != nil {
+			checkMacroCall(macros[name], call, fail)
+		}
+		return true
+	})
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Col < errs[j].Col
+	})
+	return errs[0]
+}
+
+// checkMacroCall reports the arguments a call can't pass to the macro,
+// as MacroNodeToFunc would when rendering
+func checkMacroCall(macro *nodes.Macro, call *nodes.Call, fail func(*tokens.Token, string, ...interface{})) {
+	if len(call.Args) > len(macro.Kwargs) {
+		extra := call.Args[len(macro.Kwargs)]
+		fail(extra.Position(), "macro '%s' received %d arguments but expected only %d", macro.Name, len(call.Args), len(macro.Kwargs))
+	}
+	for keyword := range call.Kwargs {
+		idx := -1
+		for i, kwarg := range macro.Kwargs {
+			if key, ok := kwarg.Key.(*nodes.String); ok && key.Val == keyword {
+				idx = i
+			}
+		}
+		switch {
+		case idx < 0:
+			fail(call.Keywords[keyword], "macro '%s' takes no keyword argument '%s'", macro.Name, keyword)
+		case idx < len(call.Args):
+			fail(call.Keywords[keyword], "macro '%s' received '%s' argument twice", macro.Name, keyword)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package exec
+
+import (
+	"strings"
+
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
+)
+
+// nativeOutput collects the values rendered in native mode, along with the
+// text rendered between them
+type nativeOutput struct {
+	// out is the output of the template, values rendered by macros or blocks
+	// to another output are only rendered as text
+	out     *strings.Builder
+	flushed int
+	chunks  []*Value
+}
+
+// add records a value rendered to out
+func (n *nativeOutput) add(value *Value) {
+	n.flush()
+	n.chunks = append(n.chunks, value)
+	n.out.WriteString(value.String())
+	n.flushed = n.out.Len()
+}
+
+// flush records the text rendered since the last value
+func (n *nativeOutput) flush() {
+	if n.out.Len() > n.flushed {
+		n.chunks = append(n.chunks, AsValue(n.out.String()[n.flushed:]))
+		n.flushed = n.out.Len()
+	}
+}
+
+// value returns the Go value of the output: the value of a single output
+// node, or the literal concatenated from the chunks when it parses as one
+func (n *nativeOutput) value(cfg *EvalConfig) any {
+	n.flush()
+	switch {
+	case len(n.chunks) == 0:
+		return nil
+	case len(n.chunks) == 1 && !n.chunks[0].IsString():
+		return nativeValue(n.chunks[0])
+	}
+	var out strings.Builder
+	for _, chunk := range n.chunks {
+		out.WriteString(chunk.String())
+	}
+	source := out.String()
+	expr, err := parser.ParseExpression("native", source, cfg.Config)
+	if err != nil {
+		return source
+	}
+	if value, ok := literalValue(expr); ok {
+		return value
+	}
+	return source
+}
+
+// nativeValue returns the Go value of a rendered value, with string keys
+// unless its dicts have other keys, or the error of a value which has none
+func nativeValue(value *Value) any {
+	native := value.ToGoSimpleType(false)
+	if _, failed := native.(error); failed {
+		return value.ToGoSimpleType(true)
+	}
+	return native
+}
+
+// literalValue returns the Go value of a literal, including lists, tuples
+// and dicts with string keys of literals, as parsed from a native output.
+// Like Python's literal_eval, it rejects integers with leading zeros and
+// booleans and None not spelled True, False and None.
+func literalValue(expr nodes.Expression) (any, bool) {
+	switch n := expr.(type) {
+	case *nodes.Integer:
+		if !pythonInteger(n) {
+			return nil, false
+		}
+	case *nodes.Bool, *nodes.None:
+		switch n.Position().Val {
+		case "True", "False", "None":
+		default:
+			return nil, false
+		}
+	case *nodes.List:
+		return literalValues(n.Val)
+	case *nodes.Tuple:
+		return literalValues(n.Val)
+	case *nodes.Dict:
+		dict := make(map[string]any, len(n.Pairs))
+		for _, pair := range n.Pairs {
+			key, ok := pair.Key.(*nodes.String)
+			if !ok {
+				return nil, false
+			}
+			value, ok := literalValue(pair.Value)
+			if !ok {
+				return nil, false
+			}
+			dict[key.Val] = value
+		}
+		return dict, true
+	case *nodes.UnaryExpression:
+		switch term := n.Term.(type) {
+		case *nodes.Integer:
+			if !pythonInteger(term) {
+				return nil, false
+			}
+			if n.Negative {
+				return -term.Val, true
+			}
+			return term.Val, true
+		case *nodes.Float:
+			if n.Negative {
+				return -term.Val, true
+			}
+			return term.Val, true
+		}
+		return nil, false
+	}
+	if value, ok := Literal(expr); ok {
+		return value.Interface(), true
+	}
+	return nil, false
+}
+
+// pythonInteger returns true if an integer is written without leading zeros
+func pythonInteger(n *nodes.Integer) bool {
+	digits := n.Location.Val
+	return len(digits) == 1 || !strings.HasPrefix(digits, "0") || strings.Trim(digits, "0") == ""
+}
+
+func literalValues(exprs []nodes.Expression) (any, bool) {
+	values := make([]any, 0, len(exprs))
+	for _, expr := range exprs {
+		value, ok := literalValue(expr)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
@@ -0,0 +1,296 @@
+package exec
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// pureFilters holds the filter functions declared pure
+var pureFilters sync.Map
+
+// Pure declares a filter pure and returns it: its result only depends on
+// its input and its arguments, not on the autoescape setting, so it can be
+// applied to literals once and for all. Closures share their code, only top level functions should be
+// declared pure.
+func Pure(fn FilterFunction) FilterFunction {
+	pureFilters.Store(reflect.ValueOf(fn).Pointer(), true)
+	return fn
+}
+
+// IsPure returns true if the filter function has been declared pure
+func IsPure(fn FilterFunction) bool {
+	_, ok := pureFilters.Load(reflect.ValueOf(fn).Pointer())
+	return ok
+}
+
+// Pruner is implemented by statements which can be simplified once the
+// expressions they hold are folded
+type Pruner interface {
+	// Prune returns the nodes replacing the statement, or false to keep it
+	Prune() ([]nodes.Node, bool)
+}
+
+// Literal returns the value of a literal expression
+func Literal(expr nodes.Expression) (*Value, bool) {
+	switch n := expr.(type) {
+	case *nodes.None:
+		return AsValue(nil), true
+	case *nodes.String:
+		return AsValue(n.Val), true
+	case *nodes.Integer:
+		return AsValue(n.Val), true
+	case *nodes.Float:
+		return AsValue(n.Val), true
+	case *nodes.Bool:
+		return AsValue(n.Val), true
+	}
+	return nil, false
+}
+
+// Optimize simplifies a parsed template without changing its output:
+// constant expressions are folded, including pure filters applied to
+// literals, statically dead branches are pruned, and adjacent data nodes
+// are merged.
+func Optimize(tpl *nodes.Template, cfg *EvalConfig) {
+	o := &optimizer{
+		evaluator: &Evaluator{EvalConfig: cfg, Ctx: EmptyContext()},
+	}
+	nodes.Rewrite(tpl, o.fold)
+
+	wrappers := []*nodes.Wrapper{}
+	nodes.Inspect(tpl, func(node nodes.Node) bool {
+		if wrapper, ok := node.(*nodes.Wrapper); ok {
+			wrappers = append(wrappers, wrapper)
+		}
+		return true
+	})
+	tpl.Nodes = o.nodes(tpl.Nodes)
+	for _, wrapper := range wrappers {
+		wrapper.Nodes = o.nodes(wrapper.Nodes)
+	}
+}
+
+type optimizer struct {
+	evaluator *Evaluator
+}
+
+// fold replaces a node whose operands are constant by its value
+func (o *optimizer) fold(node nodes.Node) nodes.Node {
+	switch n := node.(type) {
+	case *nodes.Output:
+		if !o.constant(n.Expression) {
+			return n
+		}
+		value, ok := o.eval(n.Expression)
+		if !ok {
+			return n
+		}
+		if value.IsString() && !value.Safe && value.Escaped() != value.String() {
+			// Escaping depends on the autoescape setting when rendering
+			if lit, ok := literal(value, n.Expression.Position()); ok {
+				n.Expression = lit
+			}
+			return n
+		}
+		return &nodes.Data{Data: &tokens.Token{
+			Type: tokens.Data,
+			Val:  value.String(),
+			Line: n.Start.Line,
+			Col:  n.Start.Col,
+		}}
+	case *nodes.Conditional:
+		if condition, ok := Literal(n.Condition); ok {
+			if condition.IsTrue() {
+				return n.Expression
+			}
+			if n.Alternative != nil {
+				return n.Alternative
+			}
+		}
+		return n
+	case *nodes.BinaryExpression, *nodes.UnaryExpression, *nodes.Negation, *nodes.Getitem, *nodes.FilteredExpression:
+		if !o.constant(n) {
+			return n
+		}
+		value, ok := o.eval(n)
+		if !ok {
+			return n
+		}
+		if lit, ok := literal(value, n.Position()); ok {
+			return lit
+		}
+		return n
+	}
+	return node
+}
+
+// constant returns true if expr only depends on literals and pure filters
+func (o *optimizer) constant(expr nodes.Expression) bool {
+	switch n := expr.(type) {
+	case *nodes.None, *nodes.String, *nodes.Integer, *nodes.Float, *nodes.Bool:
+		return true
+	case *nodes.List:
+		return o.constants(n.Val...)
+	case *nodes.Tuple:
+		return o.constants(n.Val...)
+	case *nodes.Dict:
+		for _, pair := range n.Pairs {
+			if !o.constants(pair.Key, pair.Value) {
+				return false
+			}
+		}
+		return true
+	case *nodes.BinaryExpression:
+		if !o.constants(n.Left, n.Right) {
+			return false
+		}
+		switch n.Operator.Token.Type {
+		case tokens.Add, tokens.Tilde:
+			// Concatenating markup depends on the autoescape setting when rendering
+			return !o.markup(n.Left) && !o.markup(n.Right)
+		}
+		return true
+	case *nodes.UnaryExpression:
+		return o.constant(n.Term)
+	case *nodes.Negation:
+		return o.constant(n.Term)
+	case *nodes.Getitem:
+		if slice, ok := n.Arg.(*nodes.Slice); ok {
+			return o.constant(n.Node) && o.bounds(slice.Start, slice.Stop, slice.Step)
+		}
+		return n.Arg != nil && o.constants(n.Node, n.Arg)
+	case *nodes.FilteredExpression:
+		if !o.constant(n.Expression) {
+			return false
+		}
+		for _, call := range n.Filters {
+			fn, ok := (*o.evaluator.Filters)[call.Name]
+			if !ok || !IsPure(fn) || !o.constants(call.Args...) {
+				return false
+			}
+			for _, arg := range call.Kwargs {
+				if !o.constant(arg) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (o *optimizer) constants(exprs ...nodes.Expression) bool {
+	for _, expr := range exprs {
+		if !o.constant(expr) {
+			return false
+		}
+	}
+	return true
+}
+
+// bounds returns true if the slice bounds which are set are constant
+func (o *optimizer) bounds(exprs ...nodes.Expression) bool {
+	for _, expr := range exprs {
+		if expr != nil && !o.constant(expr) {
+			return false
+		}
+	}
+	return true
+}
+
+// markup returns true if a constant expression evaluates to a safe value
+func (o *optimizer) markup(expr nodes.Expression) bool {
+	value, ok := o.eval(expr)
+	return ok && value.Safe
+}
+
+// eval evaluates a constant expression, errors being left to the rendering
+func (o *optimizer) eval(expr nodes.Expression) (value *Value, ok bool) {
+	defer func() {
+		if recover() != nil {
+			value, ok = nil, false
+		}
+	}()
+	value = o.evaluator.Eval(expr)
+	return value, !value.IsError() && value.Undefined == nil
+}
+
+// literal returns the node of a value which has one
+func literal(value *Value, at *tokens.Token) (nodes.Expression, bool) {
+	if value.Safe {
+		return nil, false
+	}
+	token := func(typ tokens.Type, val string) *tokens.Token {
+		return &tokens.Token{Type: typ, Val: val, Line: at.Line, Col: at.Col}
+	}
+	switch v := value.Interface().(type) {
+	case nil:
+		return &nodes.None{Location: token(tokens.Name, "none")}, true
+	case string:
+		return &nodes.String{Location: token(tokens.String, v), Val: v}, true
+	case int:
+		return &nodes.Integer{Location: token(tokens.Integer, strconv.Itoa(v)), Val: v}, true
+	case float64:
+		return &nodes.Float{Location: token(tokens.Float, strconv.FormatFloat(v, 'g', -1, 64)), Val: v}, true
+	case bool:
+		return &nodes.Bool{Location: token(tokens.Name, strconv.FormatBool(v)), Val: v}, true
+	}
+	return nil, false
+}
+
+// nodes prunes the statements of a list of nodes, drops its comments and
+// merges its adjacent data
+func (o *optimizer) nodes(list []nodes.Node) []nodes.Node {
+	result := []nodes.Node{}
+	for _, node := range list {
+		switch n := node.(type) {
+		case *nodes.Comment:
+			continue
+		case *nodes.StatementBlock:
+			if pruner, ok := n.Stmt.(Pruner); ok {
+				if replacement, ok := pruner.Prune(); ok {
+					for _, node := range o.nodes(replacement) {
+						result = appendNode(result, node)
+					}
+					continue
+				}
+			}
+		}
+		result = appendNode(result, node)
+	}
+	return result
+}
+
+// appendNode appends a node, merging it with the previous one if both are data
+func appendNode(list []nodes.Node, node nodes.Node) []nodes.Node {
+	data, ok := node.(*nodes.Data)
+	if !ok {
+		return append(list, node)
+	}
+	if len(list) > 0 {
+		if previous, ok := list[len(list)-1].(*nodes.Data); ok {
+			merged := *previous.Data
+			merged.Val = dataOutput(previous) + dataOutput(data)
+			list[len(list)-1] = &nodes.Data{Data: &merged}
+			return list
+		}
+	}
+	return append(list, node)
+}
+
+// dataOutput returns the text rendered for a data node
+func dataOutput(data *nodes.Data) string {
+	output := data.Data.Val
+	if data.Trim.Left {
+		output = strings.TrimLeft(output, " \r\n\t")
+	}
+	if data.Trim.Right {
+		output = strings.TrimRight(output, " \r\n\t")
+	}
+	return output
+}
@@ -0,0 +1,183 @@
+package exec
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Host types implement these interfaces to control how templates see them,
+// the Value methods check them before falling back to reflection.
+
+// Getattrer is implemented by values resolving their attributes, e.g.
+// records loading their fields lazily. Attributes not found are looked up
+// in the fields and methods.
+type Getattrer interface {
+	Getattr(name string) (any, bool)
+}
+
+// Getitemer is implemented by values resolving their items, the key being a
+// string or an int
+type Getitemer interface {
+	Getitem(key any) (any, bool)
+}
+
+// Iterable is implemented by values iterated by for loops. Sequences yield
+// their items as keys with a nil value, mappings yield their keys and values.
+// Iteration stops when yield returns false.
+type Iterable interface {
+	Iterate(yield func(key, value any) bool)
+}
+
+// Iterator is implemented by cursors iterated lazily, e.g. over database rows.
+// Next returns the next item, and false once exhausted.
+type Iterator interface {
+	Next() (any, bool)
+}
+
+// Lener is implemented by values having a length. Values implementing it but
+// not Truther are true when their length is not zero.
+type Lener interface {
+	Len() int
+}
+
+// Truther is implemented by values deciding whether they are true in
+// conditions
+type Truther interface {
+	IsTrue() bool
+}
+
+// Escaper is implemented by values rendering themselves, escaping themselves
+// when autoescaping is enabled instead of having their String escaped
+type Escaper interface {
+	String() string
+	Escaped() string
+}
+
+// Comparer is implemented by values supporting the comparison operators.
+// Compare returns a negative number when the value is lower than other, zero
+// when they are equal and a positive number otherwise. For == and !=, an
+// error falls back to comparing the values themselves.
+type Comparer interface {
+	Compare(other any) (int, error)
+}
+
+// Operable is implemented by values supporting the arithmetic operators
+// +, -, *, /, //, % and **. reflected is true when the value is the right
+// operand, the left one not being Operable.
+type Operable interface {
+	Operate(op string, other any, reflected bool) (any, error)
+}
+
+// protocol is a set of the interfaces above
+type protocol uint16
+
+const (
+	protoGetattrer protocol = 1 << iota
+	protoGetitemer
+	protoIterable
+	protoIterator
+	protoLener
+	protoTruther
+	protoEscaper
+	protoComparer
+	protoOperable
+)
+
+var protocolTypes = map[protocol]reflect.Type{
+	protoGetattrer: reflect.TypeOf((*Getattrer)(nil)).Elem(),
+	protoGetitemer: reflect.TypeOf((*Getitemer)(nil)).Elem(),
+	protoIterable:  reflect.TypeOf((*Iterable)(nil)).Elem(),
+	protoIterator:  reflect.TypeOf((*Iterator)(nil)).Elem(),
+	protoLener:     reflect.TypeOf((*Lener)(nil)).Elem(),
+	protoTruther:   reflect.TypeOf((*Truther)(nil)).Elem(),
+	protoEscaper:   reflect.TypeOf((*Escaper)(nil)).Elem(),
+	protoComparer:  reflect.TypeOf((*Comparer)(nil)).Elem(),
+	protoOperable:  reflect.TypeOf((*Operable)(nil)).Elem(),
+}
+
+// protocolsOf returns the interfaces implemented by t
+func protocolsOf(t reflect.Type) protocol {
+	var protocols protocol
+	for proto, iface := range protocolTypes {
+		if t.Implements(iface) {
+			protocols |= proto
+		}
+	}
+	return protocols
+}
+
+// host returns the underlying value if it implements one of protocols
+func (v *Value) host(protocols protocol) (any, bool) {
+	val := v.Val
+	if !val.IsValid() || !val.CanInterface() || val.Type().NumMethod() == 0 {
+		return nil, false
+	}
+	if val.Kind() == reflect.Ptr && val.IsNil() {
+		return nil, false
+	}
+	if typeInfoOf(val.Type()).protocols&protocols == 0 {
+		return nil, false
+	}
+	return val.Interface(), true
+}
+
+// operate applies an arithmetic operator through the Operable operand, if any
+func operate(op string, left, right *Value) (*Value, bool) {
+	if operable, ok := left.host(protoOperable); ok {
+		return operableResult(operable.(Operable).Operate(op, right.Interface(), false)), true
+	}
+	if operable, ok := right.host(protoOperable); ok {
+		return operableResult(operable.(Operable).Operate(op, left.Interface(), true)), true
+	}
+	return nil, false
+}
+
+func operableResult(result any, err error) *Value {
+	if err != nil {
+		return AsValue(err)
+	}
+	return ToValue(result)
+}
+
+// compare compares two values through the Comparer operand, if any
+func compare(left, right *Value) (int, bool, error) {
+	if comparer, ok := left.host(protoComparer); ok {
+		cmp, err := comparer.(Comparer).Compare(right.Interface())
+		return cmp, true, err
+	}
+	if comparer, ok := right.host(protoComparer); ok {
+		cmp, err := comparer.(Comparer).Compare(left.Interface())
+		return -cmp, true, err
+	}
+	return 0, false, nil
+}
+
+// compared applies a comparison operator through the Comparer operand, if any
+func compared(op string, left, right *Value) (*Value, bool) {
+	cmp, ok, err := compare(left, right)
+	if !ok {
+		return nil, false
+	}
+	if err != nil {
+		if op == "==" || op == "!=" {
+			return nil, false
+		}
+		return AsValue(errors.Wrapf(err, `Unable to compare %s and %s`, left, right)), true
+	}
+	switch op {
+	case "<":
+		return AsValue(cmp < 0), true
+	case "<=":
+		return AsValue(cmp <= 0), true
+	case ">":
+		return AsValue(cmp > 0), true
+	case ">=":
+		return AsValue(cmp >= 0), true
+	case "==":
+		return AsValue(cmp == 0), true
+	case "!=":
+		return AsValue(cmp != 0), true
+	}
+	return nil, false
+}
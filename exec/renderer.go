@@ -1,11 +1,12 @@
 package exec
 
 import (
+	"fmt"
 	"strings"
 
-	"github.com/pkg/errors"
-
 	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
+	"github.com/MarioJim/gonja/tokens"
 )
 
 // Renderer is a node visitor in charge of rendering
@@ -15,6 +16,19 @@ type Renderer struct {
 	Template *Template
 	Root     *nodes.Template
 	Out      *strings.Builder
+	// Current is the template holding the rendered nodes, used to locate errors
+	Current *nodes.Template
+
+	// native collects the values rendered in native mode, see ExecuteNative
+	native *nativeOutput
+
+	// evaluator is the evaluator of the expressions rendered, reused while
+	// the context and the configuration don't change
+	evaluator *Evaluator
+
+	// program is the compiled form of programFor
+	program    *Program
+	programFor *nodes.Template
 }
 
 // NewRenderer initialize a new renderer
@@ -25,6 +39,7 @@ func NewRenderer(ctx *Context, out *strings.Builder, cfg *EvalConfig, tpl *Templ
 		Template:   tpl,
 		Root:       tpl.Root,
 		Out:        out,
+		Current:    tpl.Root,
 	}
 	r.Ctx.Set("self", Self(r))
 	return r
@@ -38,62 +53,46 @@ func (r *Renderer) Inherit() *Renderer {
 		Template:   r.Template,
 		Root:       r.Root,
 		Out:        r.Out,
+		Current:    r.Current,
+		native:     r.native,
+		program:    r.program,
+		programFor: r.programFor,
 	}
 	return sub
 }
 
+// compiled returns the program of the current template, or nil if
+// templates are interpreted
+func (r *Renderer) compiled() *Program {
+	if r.Interpreted || r.Template == nil || r.Current == nil {
+		return nil
+	}
+	if r.programFor != r.Current {
+		r.program = r.Template.compiled(r.Current)
+		r.programFor = r.Current
+	}
+	return r.program
+}
+
 // Visit implements the nodes.Visitor interface
 func (r *Renderer) Visit(node nodes.Node) (nodes.Visitor, error) {
 	switch n := node.(type) {
 	case *nodes.Comment:
 		return nil, nil
 	case *nodes.Data:
-		output := n.Data.Val
-		if n.Trim.Left {
-			output = strings.TrimLeft(output, " \n\t")
-		}
-		if n.Trim.Right {
-			output = strings.TrimRight(output, " \n\t")
-		}
-		_, err := r.Out.WriteString(output)
+		_, err := r.Out.WriteString(dataOutput(n))
 		return nil, err
 	case *nodes.Output:
-		var value *Value
-		if n.Condition != nil {
-			condition := r.Eval(n.Condition)
-			if condition.IsError() {
-				return nil, errors.Wrapf(condition, `Unable to render condition at line %d: %s`, n.Condition.Position().Line, n.Condition)
-			}
-			if !condition.IsNil() && condition.IsTrue() {
-				value = r.Eval(n.Expression)
-			} else if condition.IsNil() || !condition.IsTrue() {
-				if n.Alternative != nil {
-					value = r.Eval(n.Alternative)
-				} else {
-					return nil, nil
-				}
-			} else {
-				return nil, errors.Wrapf(condition, `Unable to evaluation condition as boolean at line %d: %s`, n.Condition.Position().Line, n.Condition)
-			}
-		} else {
-			value = r.Eval(n.Expression)
-		}
+		value := r.Eval(n.Expression)
 		if value.IsError() {
-			return nil, errors.Wrapf(value, `Unable to render expression at line %d: %s`, n.Expression.Position().Line, n.Expression)
-		}
-		var err error
-		if r.Autoescape && value.IsString() && !value.Safe {
-			_, err = r.Out.WriteString(value.Escaped())
-		} else {
-			_, err = r.Out.WriteString(value.String())
-
+			return nil, r.Error(value, "Unable to render expression", n.Expression.Position())
 		}
-		return nil, err
+		return nil, r.output(value)
 	case *nodes.StatementBlock:
 		stmt, ok := n.Stmt.(Statement)
 		if ok {
 			if err := stmt.Execute(r, n); err != nil {
-				return nil, errors.Wrapf(err, `Unable to execute statement at line %d: %s`, n.Stmt.Position().Line, n.Stmt)
+				return nil, r.Error(err, fmt.Sprintf(`Unable to execute statement "%s"`, n.Name), n.Location)
 			}
 		}
 		return nil, nil
@@ -104,7 +103,13 @@ func (r *Renderer) Visit(node nodes.Node) (nodes.Visitor, error) {
 
 // ExecuteWrapper wraps the nodes.Wrapper execution logic
 func (r *Renderer) ExecuteWrapper(wrapper *nodes.Wrapper) error {
-	return nodes.Walk(r.Inherit(), wrapper)
+	sub := r.Inherit()
+	if program := sub.compiled(); program != nil {
+		if fn, ok := program.wrappers[wrapper]; ok {
+			return fn(sub)
+		}
+	}
+	return nodes.Walk(sub, wrapper)
 }
 
 func (r *Renderer) Execute() error {
@@ -113,10 +118,90 @@ func (r *Renderer) Execute() error {
 	for root.Parent != nil {
 		root = root.Parent
 	}
+	r.Current = root
+
+	var err error
+	if program := r.compiled(); program != nil {
+		err = program.root(r)
+	} else {
+		err = nodes.Walk(r, root)
+	}
+	if terr, ok := parser.AsTemplateError(err); ok {
+		// The parent is rendered through the extends statements, innermost first
+		frames := []*parser.Frame{}
+		for tpl := r.Root; tpl.Parent != nil; tpl = tpl.Parent {
+			frame := &parser.Frame{Kind: "extends", Name: tpl.Parent.Name, Template: tpl.Name}
+			if tag := extendsTag(tpl); tag != nil {
+				frame.Line = tag.Line
+				frame.Col = tag.Col
+			}
+			frames = append([]*parser.Frame{frame}, frames...)
+		}
+		terr.Frames = append(terr.Frames, frames...)
+	}
+	return err
+}
+
+// Error returns err as a TemplateError located at token in the current
+// template. Frames added by AddFrame while the error was propagated to this
+// node are located at token as well.
+func (r *Renderer) Error(err error, msg string, token *tokens.Token) error {
+	name, source := "", ""
+	if r.Current != nil {
+		name, source = r.Current.Name, r.Current.Source
+	}
+	terr, ok := parser.AsTemplateError(err)
+	if !ok {
+		return parser.NewTemplateError(name, source, token, msg, err)
+	}
+	for _, frame := range terr.Frames {
+		if frame.Template == "" {
+			frame.Template = name
+			if token != nil {
+				frame.Line = token.Line
+				frame.Col = token.Col
+			}
+		}
+	}
+	return terr
+}
 
-	return nodes.Walk(r, root)
+// AddFrame adds an include, import or macro frame to the TemplateError held
+// by err, if any. The frame is located by Renderer.Error once the error
+// reaches the statement or the expression which led to it.
+func AddFrame(err error, kind, name string) error {
+	if terr, ok := parser.AsTemplateError(err); ok {
+		terr.AddFrame(kind, name, "", nil)
+		return terr
+	}
+	return err
+}
+
+// extendsTag returns the location of the extends statement of tpl
+func extendsTag(tpl *nodes.Template) *tokens.Token {
+	for _, node := range tpl.Nodes {
+		if block, ok := node.(*nodes.StatementBlock); ok && block.Name == "extends" {
+			return block.Location
+		}
+	}
+	return nil
 }
 
 func (r *Renderer) String() string {
 	return r.Out.String()
 }
+
+// output writes a value rendered by an Output node
+func (r *Renderer) output(value *Value) error {
+	if r.native != nil && r.native.out == r.Out {
+		r.native.add(value)
+		return nil
+	}
+	var err error
+	if r.Autoescape && value.escapes() && !value.Safe {
+		_, err = r.Out.WriteString(value.Escaped())
+	} else {
+		_, err = r.Out.WriteString(value.String())
+	}
+	return err
+}
@@ -20,6 +20,7 @@ func getBlocks(tpl *nodes.Template) map[string]*nodes.Wrapper {
 func Self(r *Renderer) map[string]func() string {
 	blocks := map[string]func() string{}
 	for name, block := range getBlocks(r.Root) {
+		block := block
 		blocks[name] = func() string {
 			sub := r.Inherit()
 			var out strings.Builder
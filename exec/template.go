@@ -2,8 +2,10 @@ package exec
 
 import (
 	"bytes"
+	"html/template"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -30,6 +32,11 @@ type Template struct {
 
 	Root   *nodes.Template
 	Macros MacroSet
+
+	// programs are the compiled forms of Root and of the templates it extends,
+	// includes and imports
+	programs      map[*nodes.Template]*Program
+	programsMutex sync.Mutex
 }
 
 func NewTemplate(name string, source string, cfg *EvalConfig) (*Template, error) {
@@ -38,11 +45,12 @@ func NewTemplate(name string, source string, cfg *EvalConfig) (*Template, error)
 		Env:    cfg,
 		Name:   name,
 		Source: source,
-		Tokens: tokens.Lex(source),
+		Tokens: tokens.LexWithConfig(source, cfg.Config),
 	}
 
 	// Parse it
 	t.Parser = parser.NewParser(name, cfg.Config, t.Tokens)
+	t.Parser.Source = source
 	t.Parser.Statements = *t.Env.Statements
 	t.Parser.TemplateParser = t.Env.GetTemplate
 	root, err := t.Parser.Parse()
@@ -51,28 +59,96 @@ func NewTemplate(name string, source string, cfg *EvalConfig) (*Template, error)
 	}
 	t.Root = root
 
+	if cfg.StrictNames {
+		if err := t.checkNames(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Optimize {
+		Optimize(root, cfg)
+	}
+
 	return t, nil
 }
 
-func (tpl *Template) execute(ctx map[string]any, out io.StringWriter) error {
-	exCtx := tpl.Env.Globals.Inherit()
-	exCtx.Update(ctx)
+// NewTemplateFromRoot returns the template of an already parsed root, such as
+// one read from a bundle
+func NewTemplateFromRoot(root *nodes.Template, cfg *EvalConfig) *Template {
+	return &Template{
+		Env:    cfg,
+		Name:   root.Name,
+		Source: root.Source,
+		Root:   root,
+	}
+}
+
+// ParseRecovering parses a template source without stopping at the first
+// syntax error. It returns the partial template, holding a nodes.Error in
+// place of each element which failed to parse, along with every error.
+func (cfg *EvalConfig) ParseRecovering(name, source string) (*nodes.Template, []*parser.TemplateError) {
+	p := parser.NewParser(name, cfg.Config, nil)
+	p.Source = source
+	p.Statements = *cfg.Statements
+	p.TemplateParser = cfg.GetTemplate
+	return p.ParseRecovering()
+}
+
+// Compile compiles the template ahead of its first rendering. Templates
+// are compiled when first rendered, Compile must be called again if Root
+// is modified afterwards.
+func (tpl *Template) Compile() {
+	tpl.programsMutex.Lock()
+	tpl.programs = map[*nodes.Template]*Program{}
+	tpl.programsMutex.Unlock()
+	tpl.compiled(tpl.Root)
+}
 
+// compiled returns the program of root, compiling it the first time
+func (tpl *Template) compiled(root *nodes.Template) *Program {
+	tpl.programsMutex.Lock()
+	defer tpl.programsMutex.Unlock()
+	if tpl.programs == nil {
+		tpl.programs = map[*nodes.Template]*Program{}
+	}
+	program, ok := tpl.programs[root]
+	if !ok {
+		program = Compile(root)
+		tpl.programs[root] = program
+	}
+	return program
+}
+
+func (tpl *Template) execute(ctx any, out io.StringWriter) error {
+	return tpl.executeWithConfig(tpl.Env, ctx, out)
+}
+
+func (tpl *Template) executeWithConfig(cfg *EvalConfig, ctx any, out io.StringWriter) error {
 	var builder strings.Builder
-	renderer := NewRenderer(exCtx, &builder, tpl.Env, tpl)
+	renderer := NewRenderer(renderContext(cfg.Globals, ctx), &builder, cfg, tpl)
+	if err := executeRenderer(renderer); err != nil {
+		return err
+	}
+	if _, err := out.WriteString(renderer.String()); err != nil {
+		return errors.Wrap(err, `Unable to execute template`)
+	}
 
-	err := renderer.Execute()
-	if err != nil {
+	return nil
+}
+
+func executeRenderer(renderer *Renderer) error {
+	if err := renderer.Ctx.Err(); err != nil {
 		return errors.Wrap(err, `Unable to execute template`)
 	}
-	if _, err = out.WriteString(renderer.String()); err != nil {
+	err := renderer.Execute()
+	if terr, ok := parser.AsTemplateError(err); ok {
+		return terr
+	} else if err != nil {
 		return errors.Wrap(err, `Unable to execute template`)
 	}
-
 	return nil
 }
 
-func (tpl *Template) newBufferAndExecute(ctx map[string]any) (*bytes.Buffer, error) {
+func (tpl *Template) newBufferAndExecute(ctx any) (*bytes.Buffer, error) {
 	var buffer bytes.Buffer
 	if err := tpl.execute(ctx, &buffer); err != nil {
 		return nil, err
@@ -81,7 +157,7 @@ func (tpl *Template) newBufferAndExecute(ctx map[string]any) (*bytes.Buffer, err
 }
 
 // Executes the template and returns the rendered template as a []byte
-func (tpl *Template) ExecuteBytes(ctx map[string]any) ([]byte, error) {
+func (tpl *Template) ExecuteBytes(ctx any) ([]byte, error) {
 	buffer, err := tpl.newBufferAndExecute(ctx)
 	if err != nil {
 		return nil, err
@@ -89,8 +165,12 @@ func (tpl *Template) ExecuteBytes(ctx map[string]any) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
-// Executes the template and returns the rendered template as a string
-func (tpl *Template) Execute(ctx map[string]any) (string, error) {
+// Executes the template and returns the rendered template as a string.
+// The context is a map of variables, a struct or pointer to a struct whose
+// fields and methods are variables, or a *Context such as the ones layering
+// several sources returned by Layers. Globals are looked up last. Other
+// contexts, such as numbers, strings or slices, return an error.
+func (tpl *Template) Execute(ctx any) (string, error) {
 	var b strings.Builder
 	err := tpl.execute(ctx, &b)
 	if err != nil {
@@ -99,3 +179,55 @@ func (tpl *Template) Execute(ctx map[string]any) (string, error) {
 
 	return b.String(), nil
 }
+
+// ExecuteHTML executes the template with autoescaping enabled, whatever the
+// configuration, and returns the rendered template as an html/template HTML
+// fragment, so it can be embedded into html/template pages without being
+// escaped again.
+func (tpl *Template) ExecuteHTML(ctx any) (template.HTML, error) {
+	cfg := tpl.Env.Inherit()
+	cfg.Autoescape = true
+
+	var b strings.Builder
+	if err := tpl.executeWithConfig(cfg, ctx, &b); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+// ExecuteCollectUndefined executes the template and returns the rendered
+// template along with every undefined name, attribute or item accessed while
+// rendering. Undefined values never fail the rendering in this mode, even
+// with a strict undefined policy.
+func (tpl *Template) ExecuteCollectUndefined(ctx any) (string, []*UndefinedAccess, error) {
+	accesses := []*UndefinedAccess{}
+	cfg := tpl.Env.Inherit()
+	cfg.undefinedAccesses = &accesses
+
+	var b strings.Builder
+	err := tpl.executeWithConfig(cfg, ctx, &b)
+	if err != nil {
+		return "", accesses, err
+	}
+
+	return b.String(), accesses, nil
+}
+
+// ExecuteNative executes the template and returns its output as a Go value
+// instead of a string. A template made of a single output node returns the
+// value of its expression, e.g. a []any for {{ items | list }}. Otherwise the
+// output is parsed as a literal when it is one, e.g. 12 for {{ 1 }}{{ 2 }},
+// and returned as a string if not. An empty output returns nil.
+func (tpl *Template) ExecuteNative(ctx any) (any, error) {
+	var builder strings.Builder
+	renderer := NewRenderer(renderContext(tpl.Env.Globals, ctx), &builder, tpl.Env, tpl)
+	renderer.native = &nativeOutput{out: &builder}
+	if err := executeRenderer(renderer); err != nil {
+		return nil, err
+	}
+	value := renderer.native.value(tpl.Env)
+	if err, ok := value.(error); ok {
+		return nil, errors.Wrap(err, `Unable to execute template`)
+	}
+	return value, nil
+}
@@ -53,27 +53,10 @@ func (e *Evaluator) EvalTest(expr *nodes.TestExpression) *Value {
 }
 
 func (e *Evaluator) ExecuteTest(tc *nodes.TestCall, v *Value) *Value {
-	params := &VarArgs{
-		Args:   []*Value{},
-		KwArgs: map[string]*Value{},
-	}
-
-	for _, param := range tc.Args {
-		value := e.Eval(param)
-		if value.IsError() {
-			return AsValue(errors.Wrapf(value, `Unable to evaluate parameter %s`, param))
-		}
-		params.Args = append(params.Args, value)
-	}
-
-	for key, param := range tc.Kwargs {
-		value := e.Eval(param)
-		if value.IsError() {
-			return AsValue(errors.Wrapf(value, `Unable to evaluate parameter %s`, param))
-		}
-		params.KwArgs[key] = value
+	params, err := e.varArgs(tc.Args, tc.Kwargs)
+	if err != nil {
+		return AsValue(err)
 	}
-
 	return e.ExecuteTestByName(tc.Name, v, params)
 }
 
@@ -0,0 +1,227 @@
+package exec
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/nodes"
+)
+
+// Undefined describes a variable, attribute or item which could not be
+// resolved while evaluating a template
+type Undefined struct {
+	Name string // Name is the template expression which was missing, e.g. "user.name"
+	Hint string // Hint explains what was missing
+
+	// Chainable undefined values return themselves on attribute and item
+	// access instead of failing
+	Chainable bool
+	// Debug undefined values render back as `{{ name }}`
+	Debug bool
+}
+
+func (u *Undefined) String() string {
+	if u.Debug && u.Name == "" {
+		return fmt.Sprintf("{{ undefined value printed: %s }}", u.Hint)
+	}
+	if u.Debug {
+		return fmt.Sprintf("{{ %s }}", u.Name)
+	}
+	return ""
+}
+
+// UndefinedFunc builds the value returned when a name, an attribute or an
+// item can't be resolved. It is the undefined policy of an EvalConfig.
+type UndefinedFunc func(name, hint string) *Value
+
+// AsUndefined wraps an Undefined into a Value. The resulting value behaves
+// like a NIL value except for its rendering and the defined/undefined tests.
+func AsUndefined(u *Undefined) *Value {
+	return &Value{Undefined: u}
+}
+
+// DefaultUndefined renders as an empty string and fails on attribute or
+// item access, like the default undefined of Jinja. It is opt-in, gonja
+// defaulting to ChainableUndefined.
+func DefaultUndefined(name, hint string) *Value {
+	return AsUndefined(&Undefined{Name: name, Hint: hint})
+}
+
+// ChainableUndefined renders as an empty string and returns itself on
+// attribute or item access, so `{{ a.b.c }}` is empty whenever `a` is missing
+func ChainableUndefined(name, hint string) *Value {
+	return AsUndefined(&Undefined{Name: name, Hint: hint, Chainable: true})
+}
+
+// DebugUndefined renders the missing expression back as `{{ name }}`
+func DebugUndefined(name, hint string) *Value {
+	return AsUndefined(&Undefined{Name: name, Hint: hint, Debug: true})
+}
+
+// StrictUndefined fails as soon as something is undefined
+func StrictUndefined(name, hint string) *Value {
+	return AsValue(errors.New(hint))
+}
+
+// IsUndefined checks whether the value stands for something missing
+func (v *Value) IsUndefined() bool {
+	return v.Undefined != nil
+}
+
+// UndefinedAccess locates a missing name, attribute or item met while
+// rendering a template
+type UndefinedAccess struct {
+	Name     string // Name is the whole path accessed, e.g. "user.address['city']"
+	Hint     string
+	Template string // Template is the name of the template holding the access
+	Line     int
+	Col      int
+
+	// undefined is the value returned for the access, which attribute and
+	// item accesses extend
+	undefined *Undefined
+}
+
+func (a *UndefinedAccess) String() string {
+	return fmt.Sprintf("%s (%s) at line %d col %d", a.Name, a.Hint, a.Line, a.Col)
+}
+
+// undefined builds an undefined value following the configured policy.
+// Config.StrictUndefined is honored when no policy has been set.
+// When undefined accesses are collected, the access is recorded and
+// failing policies fall back on DefaultUndefined so rendering goes on.
+func (e *Evaluator) undefined(node nodes.Node, name, hint string) *Value {
+	value := e.policy()(name, hint)
+	if e.undefinedAccesses != nil {
+		if value.IsError() {
+			value = DefaultUndefined(name, hint)
+		}
+		e.collect(node, name, hint, value)
+	}
+	return value
+}
+
+// collect records an undefined access
+func (e *Evaluator) collect(node nodes.Node, name, hint string, value *Value) {
+	pos := node.Position()
+	access := &UndefinedAccess{
+		Name:      name,
+		Hint:      hint,
+		Line:      pos.Line,
+		Col:       pos.Col,
+		undefined: value.Undefined,
+	}
+	if e.current != nil {
+		access.Template = e.current.Name
+	}
+	*e.undefinedAccesses = append(*e.undefinedAccesses, access)
+}
+
+// policy returns the configured undefined policy
+func (e *Evaluator) policy() UndefinedFunc {
+	if e.Undefined != nil {
+		return e.Undefined
+	}
+	if e.Config.StrictUndefined {
+		return StrictUndefined
+	}
+	return ChainableUndefined
+}
+
+// UndefinedValue returns an undefined value which is not missing from the
+// context, such as the result of the 'try' filter. It follows the policy,
+// failing policies falling back on DefaultUndefined since nothing is
+// missing from the context.
+func (e *Evaluator) UndefinedValue(hint string) *Value {
+	value := e.policy()("", hint)
+	if value.IsError() {
+		return DefaultUndefined("", hint)
+	}
+	return value
+}
+
+// missingElse returns the value of a conditional expression whose condition
+// is false and which has no else clause
+func (e *Evaluator) missingElse(node *nodes.Conditional) *Value {
+	return e.UndefinedValue(fmt.Sprintf(`the inline if-expression on line %d evaluated to false and no else section was defined`, node.Position().Line))
+}
+
+// undefinedAccess handles an attribute or item access on an undefined value.
+// Collecting evaluations chain, extending the path of the collected access.
+func (e *Evaluator) undefinedAccess(value *Value, node nodes.Node) *Value {
+	if e.undefinedAccesses != nil {
+		e.extend(value, node)
+		return value
+	}
+	if value.Undefined.Chainable {
+		return value
+	}
+	return AsValue(errors.Errorf(`Unable to evaluate %s: %s`, node, value.Undefined.Hint))
+}
+
+// extend records the path of an attribute or item access on an undefined
+// value, in place of the access which returned the value if node extends it
+func (e *Evaluator) extend(value *Value, node nodes.Node) {
+	name := exprName(node)
+	if name == "" {
+		return
+	}
+	var target nodes.Node
+	switch n := node.(type) {
+	case *nodes.Getattr:
+		target = n.Node
+	case *nodes.Getitem:
+		target = n.Node
+	}
+	accesses := *e.undefinedAccesses
+	for idx := len(accesses) - 1; idx >= 0; idx-- {
+		access := accesses[idx]
+		if access.undefined == value.Undefined && access.Name == exprName(target) {
+			access.Name = name
+			return
+		}
+	}
+	e.collect(node, name, value.Undefined.Hint, value)
+}
+
+// exprName returns the template representation of simple lookup
+// expressions like `a`, `a.b`, `a.0` or `a['b']`, or an empty string
+func exprName(node nodes.Node) string {
+	switch n := node.(type) {
+	case *nodes.Name:
+		return n.Name.Val
+	case *nodes.Getattr:
+		target := exprName(n.Node)
+		if target == "" {
+			return ""
+		}
+		if n.Attr != "" {
+			return target + "." + n.Attr
+		}
+		return target + "." + strconv.Itoa(n.Index)
+	case *nodes.Getitem:
+		target := exprName(n.Node)
+		if target == "" {
+			return ""
+		}
+		switch arg := n.Arg.(type) {
+		case *nodes.String:
+			return fmt.Sprintf("%s['%s']", target, arg.Val)
+		case *nodes.Integer:
+			return fmt.Sprintf("%s[%s]", target, arg)
+		case *nodes.Name:
+			return fmt.Sprintf("%s[%s]", target, arg)
+		}
+	}
+	return ""
+}
+
+// describe names the target of a lookup in undefined hints
+func describe(node nodes.Node) string {
+	if name := exprName(node); name != "" {
+		return name
+	}
+	return "object"
+}
@@ -17,6 +17,8 @@ import (
 type Value struct {
 	Val  reflect.Value
 	Safe bool // used to indicate whether a Value needs explicit escaping in the template
+
+	Undefined *Undefined // set when the value stands for something missing
 }
 
 // AsValue converts any given Value to a gonja.Value
@@ -27,8 +29,10 @@ type Value struct {
 //
 //	AsValue("my string")
 func AsValue(i any) *Value {
+	val := reflect.ValueOf(i)
 	return &Value{
-		Val: reflect.ValueOf(i),
+		Val:  val,
+		Safe: isSafeType(val),
 	}
 }
 
@@ -97,7 +101,7 @@ func (v *Value) IsDict() bool {
 }
 
 func (v *Value) IsIterable() bool {
-	return v.IsString() || v.IsList() || v.IsDict()
+	return v.IsString() || v.IsList() || v.IsDict() || v.IsLazy()
 }
 
 // IsNil checks whether the underlying value is NIL
@@ -120,6 +124,14 @@ func (v *Value) Error() string {
 	return ""
 }
 
+// Unwrap returns the error held by the value, if any
+func (v *Value) Unwrap() error {
+	if v.IsError() {
+		return v.Interface().(error)
+	}
+	return nil
+}
+
 func (v *Value) ToGoSimpleType(allowInterfaceKeys bool) any {
 	switch {
 	case v.IsError():
@@ -134,6 +146,8 @@ func (v *Value) ToGoSimpleType(allowInterfaceKeys bool) any {
 		return v.Integer()
 	case v.IsString():
 		return v.String()
+	case v.IsLazy():
+		return materialize(v.All()).ToGoSimpleType(allowInterfaceKeys)
 	case v.IsList():
 		var err error
 		list := make([]any, 0)
@@ -208,9 +222,15 @@ func (v *Value) ToGoSimpleType(allowInterfaceKeys bool) any {
 // NIL values will lead to an empty string. Unsupported types are leading
 // to their respective type name.
 func (v *Value) String() string {
+	if v.IsUndefined() {
+		return v.Undefined.String()
+	}
 	if v.IsNil() {
 		return ""
 	}
+	if escaper, ok := v.host(protoEscaper); ok {
+		return escaper.(Escaper).String()
+	}
 	resolved := v.getResolvedValue()
 
 	switch resolved.Kind() {
@@ -286,9 +306,20 @@ func (v *Value) String() string {
 
 // Escaped returns the escaped version of String()
 func (v *Value) Escaped() string {
+	if escaper, ok := v.host(protoEscaper); ok {
+		return escaper.(Escaper).Escaped()
+	}
 	return u.Escape(v.String())
 }
 
+// escapes reports whether the value is escaped when rendered with autoescaping
+func (v *Value) escapes() bool {
+	if _, ok := v.host(protoEscaper); ok {
+		return true
+	}
+	return v.IsString()
+}
+
 // Integer returns the underlying value as an integer (converts the underlying
 // value, if necessary). If it's not possible to convert the underlying value,
 // it will return 0.
@@ -361,11 +392,18 @@ func (v *Value) Bool() bool {
 //   - bool == true
 //   - underlying value is a struct
 //
+// Values implementing Truther or Lener decide themselves.
 // Otherwise returns always FALSE.
 func (v *Value) IsTrue() bool {
 	if v.IsNil() || v.IsError() {
 		return false
 	}
+	if host, ok := v.host(protoTruther | protoLener); ok {
+		if truther, ok := host.(Truther); ok {
+			return truther.IsTrue()
+		}
+		return host.(Lener).Len() > 0
+	}
 	switch v.getResolvedValue().Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return v.getResolvedValue().Int() != 0
@@ -379,6 +417,11 @@ func (v *Value) IsTrue() bool {
 		return v.getResolvedValue().Bool()
 	case reflect.Struct:
 		return true // struct instance is always true
+	case reflect.Func:
+		if v.IsLazy() {
+			return true // as are iterator functions, which are not consumed
+		}
+		fallthrough
 	default:
 		log.Errorf("Value.IsTrue() not available for type: %s\n", v.getResolvedValue().Kind().String())
 		return false
@@ -393,6 +436,9 @@ func (v *Value) IsTrue() bool {
 //
 //	AsValue(1).Negate().IsTrue() == false
 func (v *Value) Negate() *Value {
+	if _, ok := v.host(protoTruther | protoLener); ok {
+		return AsValue(!v.IsTrue())
+	}
 	switch v.getResolvedValue().Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
@@ -411,15 +457,30 @@ func (v *Value) Negate() *Value {
 		return AsValue(!v.getResolvedValue().Bool())
 	case reflect.Struct:
 		return AsValue(false)
+	case reflect.Func:
+		if v.IsLazy() {
+			return AsValue(false)
+		}
+		fallthrough
 	default:
 		log.Errorf("Value.IsTrue() not available for type: %s\n", v.getResolvedValue().Kind().String())
 		return AsValue(true)
 	}
 }
 
-// Len returns the length for an array, chan, map, slice or string.
-// Otherwise it will return 0.
+// Len returns the length for an array, chan, map, slice, string, Lener,
+// Iterable or iterator function. Otherwise it will return 0.
 func (v *Value) Len() int {
+	if lener, ok := v.host(protoLener); ok {
+		return lener.(Lener).Len()
+	}
+	if v.countable() {
+		length := 0
+		for range v.All() {
+			length++
+		}
+		return length
+	}
 	switch v.getResolvedValue().Kind() {
 	case reflect.Array, reflect.Chan, reflect.Slice:
 		return v.getResolvedValue().Len()
@@ -485,14 +546,26 @@ func (v *Value) Index(i int) *Value {
 //
 //	AsValue("Hello, World!").Contains(AsValue("World")) == true
 func (v *Value) Contains(other *Value) bool {
+	if v.IsLazy() {
+		for key := range v.All() {
+			if key.EqualValueTo(other) {
+				return true
+			}
+		}
+		return false
+	}
+	if getitemer, ok := v.host(protoGetitemer); ok {
+		_, found := getitemer.(Getitemer).Getitem(other.Interface())
+		return found
+	}
 	resolved := v.getResolvedValue()
 	switch resolved.Kind() {
 	case reflect.Struct:
 		if dict, ok := resolved.Interface().(Dict); ok {
 			return dict.Keys().Contains(other)
 		}
-		fieldValue := resolved.FieldByName(other.String())
-		return fieldValue.IsValid()
+		_, found := lookupField(resolved, other.String())
+		return found
 	case reflect.Map:
 		var mapValue reflect.Value
 		switch other.Interface().(type) {
@@ -556,6 +629,10 @@ func (v *Value) Iterate(fn func(idx, count int, key, value *Value) bool, empty f
 // not affect the iteration through a map because maps don't have any particular order.
 // However, you can force an order using the `sorted` keyword (and even use `reversed sorted`).
 func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, empty func(), reverse bool, sorted bool, caseSensitive bool) {
+	if seq, ok := v.lazy(); ok {
+		materialize(seq).IterateOrder(fn, empty, reverse, sorted, caseSensitive)
+		return
+	}
 	resolved := v.getResolvedValue()
 	switch resolved.Kind() {
 	case reflect.Map:
@@ -661,24 +738,6 @@ func (v *Value) IterateOrder(fn func(idx, count int, key, value *Value) bool, em
 			empty()
 		}
 		return // done
-	case reflect.Chan:
-		items := []reflect.Value{}
-		for {
-			value, ok := resolved.Recv()
-			if !ok {
-				break
-			}
-			items = append(items, value)
-		}
-		count := len(items)
-		if count > 0 {
-			for idx, value := range items {
-				fn(idx, count, &Value{Val: value}, nil)
-			}
-		} else {
-			empty()
-		}
-		return
 	case reflect.Struct:
 		if resolved.Type() != TypeDict {
 			log.Errorf("Value.Iterate() not available for type: %s\n", resolved.Kind().String())
@@ -822,18 +881,22 @@ func ToValue(data any) *Value {
 		// Value is not valid (e. g. NIL value)
 		return AsValue(nil)
 	}
-	return &Value{Val: val, Safe: isSafe}
+	return &Value{Val: val, Safe: isSafe || isSafeType(val)}
 }
 
 func (v *Value) Getattr(name string) (*Value, bool) {
 	if v.IsNil() {
 		return AsValue(errors.New(`Can't use getattr on None`)), false
 	}
-	var val reflect.Value
-	val = v.Val.MethodByName(name)
-	if val.IsValid() {
-		return ToValue(val), true
+	if getattrer, ok := v.host(protoGetattrer); ok {
+		if attr, found := getattrer.(Getattrer).Getattr(name); found || attr != nil {
+			return ToValue(attr), found
+		}
+	}
+	if method, ok := lookupMethod(v.Val, name); ok {
+		return ToValue(method), true
 	}
+	var val reflect.Value
 	if v.Val.Kind() == reflect.Ptr {
 		val = v.Val.Elem()
 		if !val.IsValid() {
@@ -845,8 +908,7 @@ func (v *Value) Getattr(name string) (*Value, bool) {
 	}
 
 	if val.Kind() == reflect.Struct {
-		field := val.FieldByName(name)
-		if field.IsValid() {
+		if field, ok := lookupField(val, name); ok {
 			return ToValue(field), true
 		}
 	}
@@ -858,6 +920,10 @@ func (v *Value) Getitem(key any) (*Value, bool) {
 	if v.IsNil() {
 		return AsValue(errors.New(`Can't use Getitem on None`)), false
 	}
+	if getitemer, ok := v.host(protoGetitemer); ok {
+		item, found := getitemer.(Getitemer).Getitem(key)
+		return ToValue(item), found
+	}
 	var val reflect.Value
 	if v.Val.Kind() == reflect.Ptr {
 		val = v.Val.Elem()
@@ -886,7 +952,19 @@ func (v *Value) Getitem(key any) (*Value, bool) {
 
 	case int:
 		switch val.Kind() {
-		case reflect.String, reflect.Array, reflect.Slice:
+		case reflect.String:
+			runes := []rune(val.String())
+			if t < 0 {
+				t += len(runes)
+			}
+			if t >= 0 && len(runes) > t {
+				return AsValue(string(runes[t])), true
+			}
+			return AsValue(nil), false
+		case reflect.Array, reflect.Slice:
+			if t < 0 {
+				t += val.Len()
+			}
 			if t >= 0 && val.Len() > t {
 				atIndex := val.Index(t)
 				if atIndex.IsValid() {
@@ -932,8 +1010,8 @@ func (v *Value) Set(key *Value, value any) error {
 		if !key.IsString() {
 			return errors.Errorf(`Can't write non-string field "%s" to struct: %s`, key, value)
 		}
-		field := val.FieldByName(key.String())
-		if field.IsValid() && field.CanSet() {
+		field, found := lookupField(val, key.String())
+		if found && field.CanSet() {
 			field.Set(reflect.ValueOf(value))
 		} else {
 			return errors.Errorf(`Can't write field "%s"`, key)
@@ -1,6 +1,7 @@
 package exec_test
 
 import (
+	"html/template"
 	"reflect"
 	"testing"
 
@@ -136,6 +137,18 @@ type testStruct struct {
 	Attr string
 }
 
+type embeddedStruct struct {
+	Embedded string
+}
+
+type taggedStruct struct {
+	*embeddedStruct
+	Renamed string `gonja:"renamed" json:"json_renamed"`
+	Hidden  string `gonja:"-"`
+	JSON    string `json:"json_name,omitempty"`
+	private string
+}
+
 func (t testStruct) String() string {
 	return t.Attr
 }
@@ -152,6 +165,13 @@ var getattrCases = []struct {
 	{"attr found", testStruct{"test"}, "Attr", true, "test", flags{IsString: true, IsTrue: true, IsIterable: true}},
 	{"attr not found", testStruct{"test"}, "Missing", false, "", flags{IsNil: true}},
 	{"item", map[string]any{"Attr": "test"}, "Attr", false, "", flags{IsNil: true}},
+	{"tagged attr", taggedStruct{Renamed: "test"}, "renamed", true, "test", flags{IsString: true, IsTrue: true, IsIterable: true}},
+	{"tagged attr by field name", taggedStruct{Renamed: "test"}, "Renamed", false, "", flags{IsNil: true}},
+	{"attr tagged out", taggedStruct{Hidden: "test"}, "Hidden", false, "", flags{IsNil: true}},
+	{"unexported attr", taggedStruct{private: "test"}, "private", false, "", flags{IsNil: true}},
+	{"json tag ignored", taggedStruct{JSON: "test"}, "JSON", true, "test", flags{IsString: true, IsTrue: true, IsIterable: true}},
+	{"promoted attr", taggedStruct{embeddedStruct: &embeddedStruct{"test"}}, "Embedded", true, "test", flags{IsString: true, IsTrue: true, IsIterable: true}},
+	{"promoted attr through nil", taggedStruct{}, "Embedded", false, "", flags{IsNil: true}},
 }
 
 func TestValueGetAttr(t *testing.T) {
@@ -245,6 +265,8 @@ var setCases = []struct {
 	{"existing attr on struct by value", testStruct{"test"}, "Attr", "value", true, `Can't write field "Attr"`},
 	{"missing attr on struct by ref", &testStruct{"test"}, "Missing", "value", true, "test"},
 	{"missing attr on struct by value", testStruct{"test"}, "Missing", "value", true, "test"},
+	{"attr tagged out on struct by ref", &taggedStruct{}, "Hidden", "value", true, ""},
+	{"unexported attr on struct by ref", &taggedStruct{}, "private", "value", true, ""},
 	{
 		"existing key on map",
 		map[string]any{"Attr": "test"},
@@ -287,6 +309,42 @@ func TestValueSet(t *testing.T) {
 	}
 }
 
+func TestValueFieldTags(t *testing.T) {
+	assert := assert.New(t)
+	tagged := &taggedStruct{Renamed: "renamed", Hidden: "hidden", JSON: "json", private: "private"}
+	value := exec.AsValue(tagged)
+
+	if assert.NoError(value.Set(exec.AsValue("renamed"), "value")) {
+		assert.Equal("value", tagged.Renamed)
+	}
+	assert.True(value.Contains(exec.AsValue("renamed")))
+	assert.False(value.Contains(exec.AsValue("Renamed")))
+	assert.False(value.Contains(exec.AsValue("Hidden")))
+	assert.False(value.Contains(exec.AsValue("private")))
+
+	exec.SetFieldTags("gonja", "json")
+	defer exec.SetFieldTags("gonja")
+	out, found := value.Getattr("json_name")
+	if assert.True(found) {
+		assert.Equal("json", out.String())
+	}
+	_, found = value.Getattr("JSON")
+	assert.False(found)
+	// The first tag found wins
+	_, found = value.Getattr("json_renamed")
+	assert.False(found)
+	assert.True(value.Contains(exec.AsValue("renamed")))
+}
+
+func BenchmarkValueGetattr(b *testing.B) {
+	value := exec.AsValue(taggedStruct{embeddedStruct: &embeddedStruct{"embedded"}, Renamed: "renamed"})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		value.Getattr("renamed")
+		value.Getattr("Embedded")
+	}
+}
+
 var valueKeysCases = []struct {
 	name     string
 	value    any
@@ -337,3 +395,34 @@ func TestValueKeys(t *testing.T) {
 		})
 	}
 }
+
+var safeTypesCases = []struct {
+	name  string
+	value any
+	safe  bool
+	html  template.HTML
+}{
+	{"string", "<b>", false, "&lt;b&gt;"},
+	{"template.HTML", template.HTML("<b>"), true, "<b>"},
+	{"template.HTMLAttr", template.HTMLAttr(`class="a"`), true, `class="a"`},
+	{"template.JS", template.JS("</script><b>"), false, "&lt;/script&gt;&lt;b&gt;"},
+	{"template.URL", template.URL(`"><script>`), false, "&quot;&gt;&lt;script&gt;"},
+	{"template.CSS", template.CSS("</style>"), false, "&lt;/style&gt;"},
+}
+
+func TestValueSafeTypes(t *testing.T) {
+	for _, lc := range safeTypesCases {
+		test := lc
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			value := exec.AsValue(test.value)
+			assert.Equal(test.safe, value.Safe)
+			assert.Equal(test.html, value.HTML())
+
+			data := map[string]any{"value": test.value}
+			fromMap := exec.ToValue(reflect.ValueOf(data).MapIndex(reflect.ValueOf("value")))
+			assert.Equal(test.safe, fromMap.Safe)
+		})
+	}
+}
@@ -0,0 +1,370 @@
+// Package formatter pretty prints templates without changing their output.
+//
+// Tags and expressions get consistent spacing and double quoted strings.
+// Nested tags standing on their own line are indented, but only where the
+// renderer strips that indentation anyway: after a `{%-` marker or with
+// LstripBlocks. Data, comments and raw blocks are kept untouched.
+package formatter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/builtins"
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// Options control how templates are formatted
+type Options struct {
+	// Config provides the delimiters and the LstripBlocks option of the
+	// environment rendering the templates. Defaults to config.DefaultConfig.
+	Config *config.Config
+	// Indent is the indentation of one nesting level. Defaults to 4 spaces.
+	Indent string
+}
+
+// DefaultOptions are used when no options are given
+var DefaultOptions = &Options{
+	Config: config.DefaultConfig,
+	Indent: "    ",
+}
+
+// bodyTags are the tags opening a body closed by an `end` tag
+var bodyTags = map[string]bool{
+	"autoescape": true,
+	"block":      true,
+	"filter":     true,
+	"for":        true,
+	"if":         true,
+	"macro":      true,
+	"raw":        true,
+	"with":       true,
+}
+
+// Source formats the template source. The template must be valid.
+func Source(source string, opts *Options) (string, error) {
+	if opts == nil {
+		opts = DefaultOptions
+	}
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = config.DefaultConfig
+	}
+	indent := opts.Indent
+	if indent == "" {
+		indent = DefaultOptions.Indent
+	}
+
+	if err := parse(source, cfg); err != nil {
+		return "", errors.Wrap(err, "Unable to parse template")
+	}
+	toks, err := lex(source, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	f := &formatter{cfg: cfg, indent: indent, toks: toks}
+	formatted := f.format()
+
+	if err := verify(toks, formatted, cfg); err != nil {
+		return "", errors.Wrap(err, "Formatting changed the template")
+	}
+	return formatted, nil
+}
+
+// lexConfig keeps all of the source in the tokens
+func lexConfig(cfg *config.Config) *config.Config {
+	lexCfg := cfg.Inherit()
+	lexCfg.TrimBlocks = false
+	lexCfg.LstripBlocks = false
+	lexCfg.KeepTrailingNewline = true
+	lexCfg.NewlineSequence = ""
+	return lexCfg
+}
+
+func lex(source string, cfg *config.Config) ([]*tokens.Token, error) {
+	lexer := tokens.NewLexerWithConfig(source, lexConfig(cfg))
+	toks := []*tokens.Token{}
+	for _, tok := range lexer.Tokens() {
+		if tok.Type == tokens.Error {
+			return nil, errors.Errorf(`Unable to lex template at line %d col %d: %s`, tok.Line, tok.Col, tok.Val)
+		}
+		toks = append(toks, tok)
+	}
+	return toks, nil
+}
+
+// parse checks the source is a valid template. Referenced templates are
+// not loaded.
+func parse(source string, cfg *config.Config) error {
+	p := parser.NewParser("formatter", cfg, tokens.LexWithConfig(source, cfg))
+	p.Statements = builtins.Statements
+	p.TemplateParser = func(string) (*nodes.Template, error) {
+		return &nodes.Template{
+			Blocks: nodes.BlockSet{},
+			Macros: map[string]*nodes.Macro{},
+		}, nil
+	}
+	_, err := p.Parse()
+	return err
+}
+
+// verify ensures the formatted source parses and holds the same tokens as
+// the original one, except for whitespace within tags and stripped indentation
+func verify(original []*tokens.Token, formatted string, cfg *config.Config) error {
+	if err := parse(formatted, cfg); err != nil {
+		return err
+	}
+	toks, err := lex(formatted, cfg)
+	if err != nil {
+		return err
+	}
+	before, after := significant(original), significant(toks)
+	if len(before) != len(after) {
+		return errors.Errorf("expected %d tokens, got %d", len(before), len(after))
+	}
+	for idx, tok := range before {
+		other := after[idx]
+		val, otherVal := tok.Val, other.Val
+		if tok.Type == tokens.Data && idx+1 < len(before) && stripsIndentation(before[idx+1], cfg) {
+			val, otherVal = strings.TrimRight(val, " \t"), strings.TrimRight(otherVal, " \t")
+		}
+		if tok.Type != other.Type || val != otherVal {
+			return errors.Errorf("expected %s at line %d col %d, got %s", tok, tok.Line, tok.Col, other)
+		}
+	}
+	return nil
+}
+
+func significant(toks []*tokens.Token) []*tokens.Token {
+	result := []*tokens.Token{}
+	for _, tok := range toks {
+		if tok.Type != tokens.Whitespace {
+			result = append(result, tok)
+		}
+	}
+	return result
+}
+
+// stripsIndentation returns true if the renderer drops the indentation
+// preceding the tag opened by tok
+func stripsIndentation(tok *tokens.Token, cfg *config.Config) bool {
+	if tok.Type != tokens.BlockBegin && tok.Type != tokens.CommentBegin {
+		return false
+	}
+	return strings.HasSuffix(tok.Val, "-") || (cfg.LstripBlocks && !strings.HasSuffix(tok.Val, "+"))
+}
+
+type formatter struct {
+	cfg    *config.Config
+	indent string
+	toks   []*tokens.Token
+	pos    int
+
+	out   strings.Builder
+	data  string // pending data, written once the following tag is known
+	level int
+	raw   bool
+}
+
+func (f *formatter) next() *tokens.Token {
+	tok := f.toks[f.pos]
+	f.pos++
+	return tok
+}
+
+func (f *formatter) format() string {
+	for f.pos < len(f.toks) {
+		tok := f.next()
+		switch tok.Type {
+		case tokens.Data:
+			f.flush()
+			f.data = tok.Val
+		case tokens.CommentBegin:
+			f.indentData(tok, f.level)
+			f.out.WriteString(tok.Val)
+			for end := false; !end; {
+				inner := f.next()
+				f.out.WriteString(inner.Val)
+				end = inner.Type == tokens.CommentEnd
+			}
+		case tokens.VariableBegin:
+			f.flush()
+			f.tag(tok, tokens.VariableEnd)
+		case tokens.BlockBegin:
+			name := f.tagName()
+			level := f.level
+			switch {
+			case bodyTags[name]:
+				f.level++
+			case strings.HasPrefix(name, "end"):
+				f.level--
+				level = f.level
+			case name == "elif" || name == "else":
+				level--
+			}
+			if f.raw {
+				f.flush()
+			} else {
+				f.indentData(tok, level)
+			}
+			f.raw = name == "raw"
+			f.tag(tok, tokens.BlockEnd)
+		case tokens.EOF:
+			f.flush()
+		}
+	}
+	return f.out.String()
+}
+
+// tagName returns the name of the statement opened at the current position
+func (f *formatter) tagName() string {
+	for _, tok := range f.toks[f.pos:] {
+		if tok.Type == tokens.Name {
+			return tok.Val
+		}
+		if tok.Type != tokens.Whitespace {
+			break
+		}
+	}
+	return ""
+}
+
+func (f *formatter) flush() {
+	f.out.WriteString(f.data)
+	f.data = ""
+}
+
+// indentData writes the pending data, reindenting the line of the tag
+// opened by tok if the renderer strips its indentation
+func (f *formatter) indentData(tok *tokens.Token, level int) {
+	data := f.data
+	lineStart := strings.LastIndexAny(data, "\r\n") + 1
+	atLineStart := lineStart > 0 || f.out.Len() == 0
+	if atLineStart && stripsIndentation(tok, f.cfg) && strings.Trim(data[lineStart:], " \t") == "" {
+		if level < 0 {
+			level = 0
+		}
+		data = data[:lineStart] + strings.Repeat(f.indent, level)
+	}
+	f.out.WriteString(data)
+	f.data = ""
+}
+
+// tag writes a tag from begin up to the token of type end
+func (f *formatter) tag(begin *tokens.Token, end tokens.Type) {
+	f.out.WriteString(begin.Val)
+	f.out.WriteByte(' ')
+	expr := []*tokens.Token{}
+	for {
+		tok := f.next()
+		if tok.Type == end {
+			f.out.WriteString(formatExpression(expr, end == tokens.BlockEnd))
+			f.out.WriteByte(' ')
+			f.out.WriteString(tok.Val)
+			return
+		}
+		if tok.Type != tokens.Whitespace {
+			expr = append(expr, tok)
+		}
+	}
+}
+
+// keywords are names after which a parenthesis or a bracket doesn't start
+// a call or a subscript, and a sign is unary
+var keywords = map[string]bool{
+	"if":   true,
+	"elif": true,
+	"else": true,
+	"for":  true,
+	"set":  true,
+}
+
+// formatExpression formats the tokens of a tag, whitespaces excluded.
+// The first token of a block is the statement name.
+func formatExpression(toks []*tokens.Token, block bool) string {
+	var out strings.Builder
+	brackets := []tokens.Type{}
+	var prev *tokens.Token
+	unary := false
+	for idx, tok := range toks {
+		inside := tokens.Type(-1)
+		if len(brackets) > 0 {
+			inside = brackets[len(brackets)-1]
+		}
+
+		afterTagName := block && idx == 1
+		if prev != nil && spaced(prev, tok, inside, unary, afterTagName) {
+			out.WriteByte(' ')
+		}
+
+		switch tok.Type {
+		case tokens.Lparen, tokens.Lbracket, tokens.Lbrace:
+			brackets = append(brackets, tok.Type)
+		case tokens.Rparen, tokens.Rbracket, tokens.Rbrace:
+			if len(brackets) > 0 {
+				brackets = brackets[:len(brackets)-1]
+			}
+		}
+
+		unary = (tok.Type == tokens.Sub || tok.Type == tokens.Add) && startsOperand(prev, afterTagName)
+		out.WriteString(tokenSource(tok))
+		prev = tok
+	}
+	return out.String()
+}
+
+// startsOperand returns true if a token following prev starts an operand
+func startsOperand(prev *tokens.Token, afterTagName bool) bool {
+	if prev == nil || afterTagName {
+		return true
+	}
+	switch prev.Type {
+	case tokens.Name:
+		return keywords[prev.Val]
+	case tokens.Integer, tokens.Float, tokens.String,
+		tokens.Rparen, tokens.Rbracket, tokens.Rbrace:
+		return false
+	}
+	return true
+}
+
+// spaced returns true if tokens prev and tok are separated by a space
+func spaced(prev, tok *tokens.Token, inside tokens.Type, unary, afterTagName bool) bool {
+	switch {
+	case unary:
+		return false
+	case prev.Type == tokens.Lparen || prev.Type == tokens.Lbracket || prev.Type == tokens.Lbrace:
+		return false
+	case tok.Type == tokens.Rparen || tok.Type == tokens.Rbracket || tok.Type == tokens.Rbrace:
+		return false
+	case tok.Type == tokens.Comma || tok.Type == tokens.Dot || prev.Type == tokens.Dot:
+		return false
+	case tok.Type == tokens.Colon:
+		return false
+	case prev.Type == tokens.Colon:
+		return inside == tokens.Lbrace
+	case (tok.Type == tokens.Assign || prev.Type == tokens.Assign) && inside == tokens.Lparen:
+		return false
+	case tok.Type == tokens.Lparen || tok.Type == tokens.Lbracket:
+		// calls and subscripts stick to their target
+		return startsOperand(prev, afterTagName)
+	}
+	return true
+}
+
+// tokenSource returns the source of a token, strings being double quoted
+func tokenSource(tok *tokens.Token) string {
+	if tok.Type != tokens.String {
+		return tok.Val
+	}
+	if strings.Contains(tok.Val, `"`) && !strings.Contains(tok.Val, `'`) {
+		return fmt.Sprintf(`'%s'`, tok.Val)
+	}
+	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(tok.Val, `"`, `\"`))
+}
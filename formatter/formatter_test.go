@@ -0,0 +1,87 @@
+package formatter_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/formatter"
+)
+
+var formatterCases = []struct {
+	name     string
+	source   string
+	expected string
+}{
+	{"spacing", `{{a+b*-c}}`, `{{ a + b * -c }}`},
+	{"filters", `{{ a|default( 'x' )|upper }}`, `{{ a | default("x") | upper }}`},
+	{"calls and kwargs", `{{ f( a,b = 1 ) }}`, `{{ f(a, b=1) }}`},
+	{"subscripts and slices", `{{ a [ 'b' ] [1 : -1] }}`, `{{ a["b"][1:-1] }}`},
+	{"collections", `{{ [1,2] ~ {'a':(1,2)} }}`, `{{ [1, 2] ~ {"a": (1, 2)} }}`},
+	{"quoting", `{{ 'a' ~ "b" ~ 'it"s' ~ "it's" }}`, `{{ "a" ~ "b" ~ 'it"s' ~ "it's" }}`},
+	{"multiline expression", "{{\n  a\n  and not b\n}}", `{{ a and not b }}`},
+	{"conditional", `{{ a if b else[1] }}`, `{{ a if b else [1] }}`},
+	{"statements", `{%if(a)%}{%for k,v in d if k!=1%}{{k}}{%endfor%}{%endif%}`, `{% if (a) %}{% for k, v in d if k != 1 %}{{ k }}{% endfor %}{% endif %}`},
+	{"set and macro", `{%set a=1%}{%macro m(x,y=-1)%}{{x}}{%endmacro%}`, `{% set a = 1 %}{% macro m(x, y=-1) %}{{ x }}{% endmacro %}`},
+	{"whitespace control", `{%-if a-%}{{-a-}}{%+endif+%}`, `{%- if a -%}{{- a -}}{%+ endif +%}`},
+	{"comments and raw are kept", `{#  a {{ b }} #}{% raw %}{{a+b}}{% endraw %}`, `{#  a {{ b }} #}{% raw %}{{a+b}}{% endraw %}`},
+	{"indentation is kept in output", "{% if a %}\n{% if b %}\nx\n{% endif %}\n{% endif %}", "{% if a %}\n{% if b %}\nx\n{% endif %}\n{% endif %}"},
+	{"stripped indentation", "{% if a %}\n{%- if b %}\n  x\n        {%- else %}\ny\n{%- endif %}\n{% endif %}", "{% if a %}\n    {%- if b %}\n  x\n    {%- else %}\ny\n    {%- endif %}\n{% endif %}"},
+}
+
+func TestSource(t *testing.T) {
+	for _, tc := range formatterCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			formatted, err := formatter.Source(test.source, nil)
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(test.expected, formatted)
+
+			again, err := formatter.Source(formatted, nil)
+			assert.NoError(err)
+			assert.Equal(formatted, again, "formatting is not idempotent")
+		})
+	}
+}
+
+func TestSourceLstripBlocks(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.LstripBlocks = true
+	opts := &formatter.Options{Config: cfg, Indent: "\t"}
+	formatted, err := formatter.Source("{% for a in b %}\n{% if a %}\n  {{ a }}\n{%+ endif %}\n  {% endfor %}\n", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "{% for a in b %}\n\t{% if a %}\n  {{ a }}\n{%+ endif %}\n{% endfor %}\n", formatted)
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := formatter.Source(`{% if a %}`, nil)
+	assert.Error(t, err)
+	_, err = formatter.Source(`{{ a ) }}`, nil)
+	assert.Error(t, err)
+}
+
+func TestSourceFixtures(t *testing.T) {
+	files, err := filepath.Glob("../integration/testdata/*/*.tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range files {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := formatter.Source(string(source), nil)
+		if !assert.NoError(t, err, path) {
+			continue
+		}
+		again, err := formatter.Source(formatted, nil)
+		assert.NoError(t, err, path)
+		assert.Equal(t, formatted, again, path)
+	}
+}
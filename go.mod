@@ -1,6 +1,6 @@
 module github.com/MarioJim/gonja
 
-go 1.20
+go 1.23
 
 require (
 	github.com/json-iterator/go v1.1.12
@@ -0,0 +1,190 @@
+package integration_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja"
+	"github.com/MarioJim/gonja/builtins/statements"
+	"github.com/MarioJim/gonja/bundle"
+	"github.com/MarioJim/gonja/exec"
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// bundleFixtures writes the parsable fixtures of a folder to a bundle
+func bundleFixtures(tb testing.TB, root string) ([]byte, []string) {
+	matches, err := filepath.Glob(filepath.Join(root, "*.tpl"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	env := testEnv(root)
+	filenames := []string{}
+	for _, match := range matches {
+		filename := filepath.Base(match)
+		if _, err := env.FromFile(filename); err == nil {
+			filenames = append(filenames, filename)
+		}
+	}
+	var buf bytes.Buffer
+	if err := env.WriteBundle(&buf, filenames...); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes(), filenames
+}
+
+func TestBundle(t *testing.T) {
+	for _, dir := range fixtureDirs {
+		root := filepath.Join(*testdataFlag, dir)
+		data, filenames := bundleFixtures(t, root)
+
+		// Templates are not parsed again: the loader only finds the helpers
+		// which are loaded dynamically
+		env := testEnv(root)
+		env.Globals.Set("this_is_a_global_variable", "this is a global text")
+		if err := env.LoadBundle(data); err != nil {
+			t.Fatal(err)
+		}
+		for _, filename := range filenames {
+			name := strings.TrimSuffix(filepath.Join(dir, filename), ".tpl")
+			t.Run(name, func(t *testing.T) {
+				tpl, err := env.FromCache(filename)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Nil(t, tpl.Tokens, "bundled templates are not lexed")
+				expected, err := os.ReadFile(filepath.Join(root, filename+".out"))
+				if !assert.NoError(t, err) {
+					return
+				}
+				rand.Seed(42)
+				rendered, err := tpl.Execute(Fixtures)
+				if assert.NoError(t, err) {
+					assert.Equal(t, string(expected), rendered)
+				}
+			})
+		}
+	}
+}
+
+func TestBundleSharesTemplates(t *testing.T) {
+	assert := assert.New(t)
+	env := testEnv(*testdataFlag)
+	var buf bytes.Buffer
+	if !assert.NoError(env.WriteBundle(&buf, "macro.tpl", "macro.helper")) {
+		return
+	}
+	roots, err := bundle.Read(buf.Bytes(), gonja.VERSION, env.Config)
+	if !assert.NoError(err) || !assert.Len(roots, 2) {
+		return
+	}
+
+	// The helper parsed for each import of macro.tpl is written once
+	imports := 0
+	nodes.Inspect(roots[0], func(node nodes.Node) bool {
+		if block, ok := node.(*nodes.StatementBlock); ok {
+			if stmt, ok := block.Stmt.(*statements.FromImportStmt); ok && stmt.Filename == "macro.helper" {
+				assert.Same(roots[1], stmt.Template)
+				for _, macro := range stmt.Macros {
+					assert.Same(roots[1].Macros[macro.Name], macro)
+				}
+				imports++
+			}
+		}
+		return true
+	})
+	assert.Equal(1, imports)
+}
+
+func TestBundleRejected(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	var buf bytes.Buffer
+	if !assert.NoError(t, env.WriteBundle(&buf, "macro.tpl")) {
+		return
+	}
+	data := buf.Bytes()
+
+	_, err := bundle.Read(data, "0.0.0", env.Config)
+	assert.True(t, errors.Is(err, bundle.ErrStale), "another version: %v", err)
+
+	other := testEnv(*testdataFlag)
+	other.TrimBlocks = true
+	assert.True(t, errors.Is(other.LoadBundle(data), bundle.ErrStale), "another configuration")
+
+	other = testEnv(*testdataFlag)
+	other.Autoescape = false
+	assert.True(t, errors.Is(other.LoadBundle(data), bundle.ErrStale), "another autoescape setting")
+
+	assert.EqualError(t, env.LoadBundle([]byte("{{ template }}")), "Unable to read bundle: not a template bundle")
+	for size := len("GONJA\x00"); size < len(data); size++ {
+		assert.Error(t, env.LoadBundle(data[:size]), "truncated to %d bytes", size)
+	}
+	assert.Error(t, env.LoadBundle(append(data, 0)), "trailing data")
+
+	// A template bundled twice ends the bundle with a reference to the first
+	// one, corrupting it into a nil reference fails the loading
+	var twice bytes.Buffer
+	if !assert.NoError(t, env.WriteBundle(&twice, "macro.tpl", "macro.tpl")) {
+		return
+	}
+	corrupted := twice.Bytes()
+	assert.NoError(t, testEnv(*testdataFlag).LoadBundle(corrupted))
+	corrupted[len(corrupted)-1] = 0
+	assert.NotPanics(t, func() {
+		assert.Error(t, testEnv(*testdataFlag).LoadBundle(corrupted), "nil template reference")
+	})
+}
+
+type noCodecStmt struct{}
+
+func (stmt *noCodecStmt) Position() *tokens.Token { return nil }
+func (stmt *noCodecStmt) String() string          { return "noCodecStmt" }
+func (stmt *noCodecStmt) Execute(r *exec.Renderer, tag *nodes.StatementBlock) error {
+	return nil
+}
+
+func TestBundleWithoutCodec(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	env.Statements.Register("nocodec", func(p *parser.Parser, args *parser.Parser) (nodes.Statement, error) {
+		return &noCodecStmt{}, nil
+	})
+	tpl, err := env.FromString(`{% nocodec %}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = bundle.Write(&bytes.Buffer{}, []*nodes.Template{tpl.Root}, gonja.VERSION, env.Config)
+	assert.EqualError(t, err, `Unable to write bundle: Statement "nocodec" can't be written to a bundle, it has no registered codec`)
+}
+
+// BenchmarkBundle compares loading the fixtures from a bundle with parsing them
+func BenchmarkBundle(b *testing.B) {
+	root := filepath.Join(*testdataFlag, "statements")
+	data, filenames := bundleFixtures(b, root)
+	b.Run("parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			env := testEnv(root)
+			for _, filename := range filenames {
+				if _, err := env.FromFile(filename); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("load", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := testEnv(root).LoadBundle(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package integration_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// fixtureDirs are the folders of the template fixtures, relative to the test data
+var fixtureDirs = []string{"", "expressions", "filters", "functions", "tests", "statements"}
+
+func TestInterpretedTemplates(t *testing.T) {
+	for _, dir := range fixtureDirs {
+		root := filepath.Join(*testdataFlag, dir)
+		env := testEnv(root)
+		env.Interpreted = true
+		env.Globals.Set("this_is_a_global_variable", "this is a global text")
+		t.Run(dir, func(t *testing.T) {
+			GlobTemplateTests(t, root, env)
+		})
+	}
+}
+
+func TestCompileAfterRewrite(t *testing.T) {
+	assert := assert.New(t)
+	env := testEnv(*testdataFlag)
+	tpl, err := env.FromString(`{% for x in items %}{{ name }}{% endfor %}`)
+	if !assert.NoError(err) {
+		return
+	}
+	ctx := map[string]any{"items": []int{1, 2}, "name": "world"}
+	out, err := tpl.Execute(ctx)
+	assert.NoError(err)
+	assert.Equal("worldworld", out)
+
+	nodes.Rewrite(tpl.Root, func(node nodes.Node) nodes.Node {
+		if name, ok := node.(*nodes.Name); ok && name.Name.Val == "name" {
+			return &nodes.String{Location: &tokens.Token{Type: tokens.String, Val: "gonja"}, Val: "gonja"}
+		}
+		return node
+	})
+	tpl.Compile()
+	out, err = tpl.Execute(ctx)
+	assert.NoError(err)
+	assert.Equal("gonjagonja", out)
+}
+
+// BenchmarkTemplates renders the fixtures with their compiled form and by
+// interpreting their AST
+func BenchmarkTemplates(b *testing.B) {
+	for _, dir := range fixtureDirs {
+		root := filepath.Join(*testdataFlag, dir)
+		matches, err := filepath.Glob(filepath.Join(root, "*.tpl"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, match := range matches {
+			filename := filepath.Base(match)
+			name := strings.TrimSuffix(filepath.Join(dir, filename), ".tpl")
+			for _, interpreted := range []bool{false, true} {
+				env := testEnv(root)
+				env.Interpreted = interpreted
+				env.Globals.Set("this_is_a_global_variable", "this is a global text")
+				tpl, err := env.FromFile(filename)
+				if err != nil {
+					continue
+				}
+				if _, err := tpl.Execute(Fixtures); err != nil {
+					continue
+				}
+				mode := "compiled"
+				if interpreted {
+					mode = "interpreted"
+				}
+				b.Run(fmt.Sprintf("%s/%s", name, mode), func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						if _, err := tpl.Execute(Fixtures); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package integration_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja"
+)
+
+type pageView struct {
+	Title string `gonja:"title"`
+	Items []string
+	Draft bool `gonja:"-"`
+}
+
+func (p *pageView) Count() int {
+	return len(p.Items)
+}
+
+func TestStructContext(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	env.Globals.Set("site", "gonja")
+	tpl, err := env.FromString(`{{ title }} ({{ Count() }}): {{ Items | join(", ") }} {{ Draft is undefined }} {{ site }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	view := pageView{Title: "Fruits", Items: []string{"apple", "pear"}, Draft: true}
+	out, err := tpl.Execute(&view)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Fruits (2): apple, pear True gonja", out)
+	}
+
+	// Methods with a pointer receiver are only reachable through a pointer
+	tpl, err = env.FromString(`{{ title }} {{ Count is undefined }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err = tpl.Execute(view)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Fruits True", out)
+	}
+}
+
+func TestLayeredContext(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	env.Globals.Set("site", "gonja")
+	env.Globals.Set("title", "global")
+	tpl, err := env.FromString(`{% set site = "set" %}{{ title }} {{ user }} {{ site }} {{ Count() }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	request := gonja.Context{"title": "request"}
+	user := map[string]any{"user": "ada", "title": "user"}
+	out, err := tpl.Execute(gonja.Layers(request, user, &pageView{Title: "view"}))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "request ada set 0", out)
+	}
+	assert.Equal(t, gonja.Context{"title": "request"}, request)
+
+	tpl, err = env.FromString(`{{ title }} {{ user }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err = tpl.Execute(gonja.Layers(nil, user))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "user ada", out)
+	}
+}
+
+func TestInvalidContext(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	tpl, err := env.FromString(`{{ name }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	expr, err := env.CompileExpression(`name`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, ctx := range []any{42, "str", []int{1}, gonja.Layers(gonja.Context{"name": "ada"}, 42)} {
+		_, err := tpl.Execute(ctx)
+		if assert.Error(t, err, "%#v", ctx) {
+			assert.Contains(t, err.Error(), "as context, expected a map, a struct, a pointer to a struct or a *Context")
+		}
+		_, err = tpl.ExecuteNative(ctx)
+		assert.Error(t, err, "%#v", ctx)
+		_, err = expr.Eval(ctx)
+		assert.Error(t, err, "%#v", ctx)
+	}
+}
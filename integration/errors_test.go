@@ -0,0 +1,88 @@
+package integration_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja/exec"
+	"github.com/MarioJim/gonja/parser"
+)
+
+var templateErrorCases = []struct {
+	name     string
+	template string
+	error    string
+	snippet  string
+	frames   []parser.Frame
+}{
+	{
+		"include and extends", "include.helper",
+		`child.helper:3:13: Unable to render expression: Unable to evaluate missing.attr: 'missing' is undefined, from extends 'base.helper' at child.helper:1:1, from include 'child.helper' at include.helper:2:3`,
+		"  {{ missing.attr }}\n            ^",
+		[]parser.Frame{
+			{Kind: "extends", Name: "base.helper", Template: "child.helper", Line: 1, Col: 1},
+			{Kind: "include", Name: "child.helper", Template: "include.helper", Line: 2, Col: 3},
+		},
+	},
+	{
+		"imported macro", "call.helper",
+		`macros.helper:2:7: Unable to render expression: Unable to evaluate x.attr: 'missing' is undefined, from macro 'fail' at call.helper:2:11`,
+		"  {{ x.attr }}\n      ^",
+		[]parser.Frame{
+			{Kind: "macro", Name: "fail", Template: "call.helper", Line: 2, Col: 11},
+		},
+	},
+	{
+		"syntax error", "broken.helper",
+		`broken.helper:2:7: Unexpected delimiter ")"`,
+		"\t{{ a ) }}\n\t     ^",
+		[]parser.Frame{},
+	},
+	{
+		"included syntax error", "include_broken.helper",
+		`broken.helper:2:7: Unexpected delimiter ")", from include 'broken.helper' at include_broken.helper:2:4`,
+		"\t{{ a ) }}\n\t     ^",
+		[]parser.Frame{
+			{Kind: "include", Name: "broken.helper", Template: "include_broken.helper", Line: 2, Col: 4},
+		},
+	},
+}
+
+func TestTemplateErrors(t *testing.T) {
+	env := testEnv("./testdata/errors")
+	env.Undefined = exec.DefaultUndefined
+	for _, tc := range templateErrorCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			tpl, err := env.FromFile(test.template)
+			if err == nil {
+				_, err = tpl.Execute(Fixtures)
+			}
+			var terr *parser.TemplateError
+			if !assert.True(errors.As(err, &terr), "Expected a TemplateError, got %v", err) {
+				return
+			}
+			assert.Equal(test.error, terr.Error())
+			assert.Equal(test.snippet, terr.Snippet())
+			frames := []parser.Frame{}
+			for _, frame := range terr.Frames {
+				frames = append(frames, *frame)
+			}
+			assert.Equal(test.frames, frames)
+		})
+	}
+}
+
+func TestTemplateErrorsFromString(t *testing.T) {
+	env := testEnv("./testdata/errors")
+	_, err := env.FromString("{% for %}")
+	var terr *parser.TemplateError
+	if assert.True(t, errors.As(err, &terr)) {
+		assert.Equal(t, "string", terr.Template)
+		assert.Equal(t, 1, terr.Line)
+		assert.Equal(t, 4, terr.Col)
+	}
+}
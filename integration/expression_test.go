@@ -0,0 +1,119 @@
+package integration_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja"
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/exec"
+)
+
+type expressionUser struct {
+	Age   int
+	Flags []string
+}
+
+var expressionCases = []struct {
+	name     string
+	source   string
+	expected any
+	err      string
+}{
+	{"rule", `user.age >= 18 and "beta" in user.flags`, true, ""},
+	{"arithmetic", `user.age * 2 + 1`, 85, ""},
+	{"filter", `user.flags | map("upper") | list`, []any{"BETA", "ADMIN"}, ""},
+	{"test", `user.age is even`, true, ""},
+	{"global", `range(2) | list`, []any{0, 1}, ""},
+	{"conditional", `"adult" if user.age >= 18 else "minor"`, "adult", ""},
+	{"dict", `{"age": user.age}`, map[string]any{"age": 42}, ""},
+	{"undefined", `missing`, nil, ""},
+	{"undefined test", `missing is undefined`, true, ""},
+	{"error", `user.age()`, nil, "Unable to evaluate user.age()"},
+}
+
+func TestCompileExpression(t *testing.T) {
+	for _, tc := range expressionCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			for _, interpreted := range []bool{false, true} {
+				env := testEnv(*testdataFlag)
+				env.Interpreted = interpreted
+				expr, err := env.CompileExpression(test.source)
+				if !assert.NoError(t, err) {
+					return
+				}
+				out, err := expr.Eval(map[string]any{
+					"user": map[string]any{"age": 42, "flags": []string{"beta", "admin"}},
+				})
+				if test.err != "" {
+					if assert.Error(t, err, "interpreted: %t", interpreted) {
+						assert.Contains(t, err.Error(), test.err)
+					}
+					continue
+				}
+				if assert.NoError(t, err, "interpreted: %t", interpreted) {
+					assert.Equal(t, test.expected, out, "interpreted: %t", interpreted)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	for _, source := range []string{`1 +`, `(1`, `1 2`, `{{ 1 }}`, ``} {
+		_, err := env.CompileExpression(source)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestCompileExpressionStrictUndefined(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.StrictUndefined = true
+	env := gonja.NewEnvironment(cfg, gonja.DefaultLoader)
+	expr, err := env.CompileExpression(`user.missing`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = expr.Eval(map[string]any{"user": map[string]any{}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `'user' has no attribute 'missing'`)
+	}
+}
+
+func TestCompileExpressionErrorPrefix(t *testing.T) {
+	for _, interpreted := range []bool{false, true} {
+		env := testEnv(*testdataFlag)
+		env.Undefined = exec.DefaultUndefined
+		env.Interpreted = interpreted
+		expr, err := env.CompileExpression(`missing.attr`)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = expr.Eval(nil)
+		assert.EqualError(t, err, `Unable to evaluate missing.attr: 'missing' is undefined`, "interpreted: %t", interpreted)
+	}
+}
+
+func TestCompileExpressionConcurrently(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	expr, err := env.CompileExpression(`user.Age >= 18 and "beta" in user.Flags`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(age int) {
+			defer wg.Done()
+			out, err := expr.Eval(map[string]any{"user": expressionUser{age, []string{"beta"}}})
+			if assert.NoError(t, err) {
+				assert.Equal(t, age >= 18, out)
+			}
+		}(i * 3)
+	}
+	wg.Wait()
+}
@@ -2,6 +2,7 @@ package integration_test
 
 import (
 	"fmt"
+	"html/template"
 	"sort"
 
 	"strings"
@@ -228,6 +229,15 @@ Yep!`,
 			},
 		},
 	},
+	"html": map[string]any{
+		"fragment": template.HTML("<b>bold</b>"),
+		"attr":     template.HTMLAttr(`class="highlight"`),
+		"url":      template.URL("/search?q=gonja&page=2"),
+		"js":       template.JS(`alert("<hi>")`),
+		"fn": func() template.HTML {
+			return template.HTML("<i>from a function</i>")
+		},
+	},
 	"persons": []*person{
 		{"John", "Doe", "male"},
 		{"Jane", "Doe", "female"},
@@ -0,0 +1,29 @@
+package integration_test
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteHTMLAutoescapes(t *testing.T) {
+	for _, interpreted := range []bool{false, true} {
+		env := testEnv(*testdataFlag)
+		env.Autoescape = false
+		env.Interpreted = interpreted
+		tpl, err := env.FromString(`<p>{{ comment }}</p>`)
+		if !assert.NoError(t, err) {
+			return
+		}
+		ctx := map[string]any{"comment": "<script>alert(1)</script>"}
+		out, err := tpl.ExecuteHTML(ctx)
+		if assert.NoError(t, err, "interpreted: %t", interpreted) {
+			assert.Equal(t, template.HTML("<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"), out, "interpreted: %t", interpreted)
+		}
+		text, err := tpl.Execute(ctx)
+		if assert.NoError(t, err, "interpreted: %t", interpreted) {
+			assert.Equal(t, "<p><script>alert(1)</script></p>", text, "the configuration is left unchanged")
+		}
+	}
+}
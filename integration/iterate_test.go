@@ -0,0 +1,111 @@
+package integration_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cursor counts the rows pulled, as a database cursor would
+type cursor struct {
+	rows   int
+	Pulled int
+}
+
+func (c *cursor) Next() (any, bool) {
+	if c.Pulled == c.rows {
+		return nil, false
+	}
+	c.Pulled++
+	return c.Pulled, true
+}
+
+var iterateCases = []struct {
+	name     string
+	source   string
+	expected string
+}{
+	{"iterator", `{% for row in rows %}{{ row }}:{{ rows.Pulled }} {% endfor %}`, "1:1 2:2 3:3 "},
+	{"last looks ahead", `{% for row in rows %}{{ row }}:{{ loop.last }}:{{ rows.Pulled }} {% endfor %}`, "1:False:2 2:False:3 3:True:3 "},
+	{"next item looks ahead", `{% for row in rows %}{{ loop.NextItem }}:{{ rows.Pulled }} {% endfor %}`, "2:2 3:3 :3 "},
+	{"length pulls all", `{% for row in rows %}{{ loop.length }}:{{ rows.Pulled }} {% endfor %}`, "3:3 3:3 3:3 "},
+	{"revindex pulls all", `{% for row in rows %}{{ loop.revindex }}{{ loop.revindex0 }}:{{ rows.Pulled }} {% endfor %}`, "32:3 21:3 10:3 "},
+	{"filtered", `{% for row in rows if row is odd %}{{ row }}:{{ loop.index }}:{{ loop.last }} {% endfor %}`, "1:1:False 3:2:True "},
+	{"empty", `{% for row in none %}{{ row }}{% else %}empty{% endfor %}`, "empty"},
+	{"iterator function", `{% for item in seq %}{{ item }} {% endfor %}`, "a b c "},
+	{"iterator function of pairs", `{% for idx, item in seq2 %}{{ idx }}={{ item }} {% endfor %}`, "0=a 1=b 2=c "},
+	{"iterator function filters", `{{ seq | join(",") }} {{ seq | length }} {{ "b" in seq }} {{ seq | reverse | list }}`, "a,b,c 3 True ['c', 'b', 'a']"},
+	{"iterator function first, last and random", `{{ seq | first }} {{ seq | last }} {{ seq | random in ["a", "b", "c"] }}`, "a c True"},
+	{"iterator first pulls one row", `{{ rows | first }}:{{ rows.Pulled }} {{ none | first }}{{ none | last }}{{ none | random }}`, "1:1 "},
+	{"channel first", `{{ channel | first }} {{ channel | last }}`, "1 2"},
+	{"range first, last and random", `{{ range(3) | first }} {{ range(3) | last }} {{ range(1, 2) | random }} {{ range(0) | last }}`, "0 2 1 "},
+	{"channel", `{% for item in channel %}{{ item }} {% endfor %}`, "1 2 "},
+	{"range", `{% for i in range(3) %}{{ i }}{% endfor %} {% for i in range(5, 0, -2) %}{{ i }}{% endfor %}`, "012 531"},
+	{"range length", `{{ range(1, 10, 3) | length }} {{ range(0) | length }} {{ range(3, 0) | list }}`, "3 0 []"},
+	{"range truthiness", `{{ "yes" if range(1) else "no" }} {{ "yes" if range(0) else "no" }}`, "yes no"},
+	{"range string", `{{ range(2, 4) }}`, "range(2, 4, 1)"},
+}
+
+func TestIterate(t *testing.T) {
+	for _, tc := range iterateCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			for _, interpreted := range []bool{false, true} {
+				channel := make(chan int, 2)
+				channel <- 1
+				channel <- 2
+				close(channel)
+				items := []string{"a", "b", "c"}
+				ctx := map[string]any{
+					"rows":    &cursor{rows: 3},
+					"none":    &cursor{},
+					"seq":     slices.Values(items),
+					"seq2":    slices.All(items),
+					"channel": channel,
+				}
+				env := testEnv(*testdataFlag)
+				env.Interpreted = interpreted
+				tpl, err := env.FromString(test.source)
+				if !assert.NoError(t, err) {
+					return
+				}
+				out, err := tpl.Execute(ctx)
+				if assert.NoError(t, err, "interpreted: %t", interpreted) {
+					assert.Equal(t, test.expected, out, "interpreted: %t", interpreted)
+				}
+			}
+		})
+	}
+}
+
+func TestIterateStopsEarly(t *testing.T) {
+	yielded, stopped := 0, false
+	seq := func(yield func(int) bool) {
+		defer func() { stopped = true }()
+		for i := 0; ; i++ {
+			yielded++
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	env := testEnv(*testdataFlag)
+	tpl, err := env.FromString(`{% for i in seq %}{{ i }}{{ fail(i) }}{% endfor %}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = tpl.Execute(map[string]any{
+		"seq": seq,
+		"fail": func(i int) (string, error) {
+			if i == 2 {
+				return "", fmt.Errorf("stop at %d", i)
+			}
+			return "", nil
+		},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, yielded)
+	assert.True(t, stopped, "the iterator function returns once the loop stops")
+}
@@ -0,0 +1,68 @@
+package integration_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodsGrowingTemporaryList(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	env.Globals.Set("items", func() []int { return []int{1} })
+	for _, source := range []string{`{{ items().append(2) }}`, `{{ [1].append(2) }}`} {
+		tpl, err := env.FromString(source)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = tpl.Execute(nil)
+		if assert.Error(t, err, source) {
+			assert.Contains(t, err.Error(), "can't be modified in place")
+		}
+	}
+}
+
+func TestMethodsConcurrently(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	tpl, err := env.FromString(`{{ name.title() }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, name := range []string{"ada lovelace", "grace hopper", "alan turing", "edsger dijkstra"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_, err := tpl.Execute(map[string]any{"name": name})
+				assert.NoError(t, err)
+			}
+		}(name)
+	}
+	wg.Wait()
+}
+
+func TestMethodsGrowingGlobalListConcurrently(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	env.Globals.Set("items", []any{})
+	tpl, err := env.FromString(`{{ items.append(1) }}{{ items | length }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				out, err := tpl.Execute(nil)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "1", out)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	items, _ := env.Globals.Get("items")
+	assert.Equal(t, []any{}, items, "globals are left unchanged")
+}
@@ -0,0 +1,97 @@
+package integration_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var nativeCases = []struct {
+	name     string
+	source   string
+	expected any
+}{
+	{"list", `{{ ["1", "2", "3"] | map("int") | list }}`, []any{1, 2, 3}},
+	{"integer", `{{ 1 + 2 }}`, 3},
+	{"float", `{{ 1.5 }}`, 1.5},
+	{"boolean", `{{ 1 < 2 }}`, true},
+	{"none", `{{ none }}`, nil},
+	{"dict", `{{ {"a": [1, 2]} }}`, map[string]any{"a": []any{1, 2}}},
+	{"variable", `{{ user }}`, map[string]any{"name": "Ada"}},
+	{"range", `{{ range(3) }}`, []any{0, 1, 2}},
+	{"lazy", `{{ seq }}`, []any{"a", "b"}},
+	{"string of a literal", `{{ "1" }}`, 1},
+	{"string", `{{ "Ada" }}`, "Ada"},
+	{"leading zeros", `{{ "007" }}`, "007"},
+	{"negative leading zeros", `-{{ "007" }}`, "-007"},
+	{"zeros", `{{ "00" }}`, 0},
+	{"lowercase boolean", `{{ "true" }}`, "true"},
+	{"lowercase boolean in a list", `[{{ "false" }}]`, "[false]"},
+	{"lowercase none", `{{ "none" }}`, "none"},
+	{"nil", `{{ "nil" }}`, "nil"},
+	{"python constants", `[{{ "True" }}, {{ "None" }}]`, []any{true, nil}},
+	{"parenthesised", `{{ "(1)" }}`, 1},
+	{"parenthesised string", `{{ '("a")' }}`, "a"},
+	{"parenthesised tuple", `({{ 1 }}, {{ 2 }})`, []any{1, 2}},
+	{"concatenated", `{{ 1 }}{{ 2 }}`, 12},
+	{"concatenated list", `[{{ 1 }}, {{ 2 }}]`, []any{1, 2}},
+	{"concatenated negative", `-{{ 1 }}`, -1},
+	{"concatenated text", `a {{ 1 }}`, "a 1"},
+	{"statements", `{% for i in [1, 2] %}{{ i }}{% endfor %}`, 12},
+	{"text", `Hello`, "Hello"},
+	{"unbalanced", `[{{ 1 }}`, "[1"},
+	{"empty", ``, nil},
+	{"empty output", `{% if false %}{{ 1 }}{% endif %}`, nil},
+}
+
+func TestExecuteNative(t *testing.T) {
+	for _, tc := range nativeCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			for _, interpreted := range []bool{false, true} {
+				ctx := map[string]any{
+					"user": map[string]any{"name": "Ada"},
+					"seq": func(yield func(string) bool) {
+						_ = yield("a") && yield("b")
+					},
+				}
+				env := testEnv(*testdataFlag)
+				env.Interpreted = interpreted
+				tpl, err := env.FromString(test.source)
+				if !assert.NoError(t, err) {
+					return
+				}
+				out, err := tpl.ExecuteNative(ctx)
+				if assert.NoError(t, err, "interpreted: %t", interpreted) {
+					assert.Equal(t, test.expected, out, "interpreted: %t", interpreted)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteNativeMacro(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	tpl, err := env.FromString(`{% macro two() %}{{ 2 }}{% endmacro %}{{ 1 }}{{ two() }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := tpl.ExecuteNative(nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 12, out, "values rendered by macros are rendered as text")
+	}
+}
+
+func TestExecuteNativeError(t *testing.T) {
+	for _, interpreted := range []bool{false, true} {
+		env := testEnv(*testdataFlag)
+		env.Interpreted = interpreted
+		tpl, err := env.FromString(`{{ m }}`)
+		if !assert.NoError(t, err) {
+			return
+		}
+		out, err := tpl.ExecuteNative(map[string]any{"m": map[int]string{1: "a"}})
+		assert.Error(t, err, "interpreted: %t", interpreted)
+		assert.Nil(t, out, "interpreted: %t", interpreted)
+	}
+}
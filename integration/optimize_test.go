@@ -0,0 +1,104 @@
+package integration_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja/nodes"
+)
+
+func TestOptimizedTemplates(t *testing.T) {
+	for _, dir := range fixtureDirs {
+		root := filepath.Join(*testdataFlag, dir)
+		env := testEnv(root)
+		env.Optimize = true
+		env.Globals.Set("this_is_a_global_variable", "this is a global text")
+		t.Run(dir, func(t *testing.T) {
+			GlobTemplateTests(t, root, env)
+		})
+	}
+}
+
+var optimizeCases = []struct {
+	name     string
+	source   string
+	expected string
+	// nodes is the number of nodes left at the root of the template
+	nodes int
+}{
+	{"arithmetic", `a{{ 1 + 2 * 3 }}b`, "a7b", 1},
+	{"pure filters", `{{ "hello" | upper | center(9) }}`, "  HELLO  ", 1},
+	{"escaped string", `a{{ "<b>" ~ "!" }}`, "a&lt;b&gt;!", 2},
+	{"safe string", `{{ "<b>" | safe }}`, "<b>", 1},
+	{"impure filter", `{{ [1, 2] | random | string | length }}`, "1", 1},
+	{"variable", `{{ name | upper }}`, "WORLD", 1},
+	{"conditional expression", `{{ name if false else "x" }}`, "x", 1},
+	{"conditional without else", `{{ ("x" if false) is defined }}`, "False", 1},
+	{"comments", `a{# comment #}b`, "ab", 1},
+	{"trimmed data", "a  {{- 'b' -}}  c", "abc", 1},
+	{"dead branches", `{% if false %}a{% elif 0 %}b{% elif "" %}c{% else %}d{% endif %}`, "d", 1},
+	{"taken branch", `a{% if 1 < 2 %}b{% else %}c{% endif %}d`, "abd", 1},
+	{"no branch taken", `a{% if None %}b{% endif %}c`, "ac", 1},
+	{"runtime condition", `{% if false %}a{% elif name %}b{% elif true %}c{% else %}d{% endif %}`, "b", 1},
+	{"scoped branch", `{% if true %}{% set x = 1 %}{{ x }}{% endif %}{{ x }}`, "1", 2},
+	{"nested branches", `{% for i in [1] %}{% if i %}{% if true %}a{% endif %}b{% endif %}{% endfor %}`, "ab", 1},
+	{"autoescape block concatenation", `{% autoescape false %}{{ ("<b>" | safe) ~ "<i>" + "</i>" }}{% endautoescape %}`, "<b><i></i>", 1},
+	{"autoescape block format", `{% autoescape false %}{{ ("<b>%s</b>" | safe) | format("<i>") }}{% endautoescape %}`, "<b><i></b>", 1},
+	{"autoescape block truncate", `{% autoescape false %}{{ ("<b>abcdefghij" | safe) | truncate(9, true, "<>", 0) }}{% endautoescape %}`, "<b>abcd<>", 1},
+	{"error left to rendering", `{{ 1 | round(method="nope") }}`, "", 1},
+}
+
+func TestOptimize(t *testing.T) {
+	ctx := map[string]any{"name": "world"}
+	for _, tc := range optimizeCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			env := testEnv(*testdataFlag)
+			env.Optimize = true
+			tpl, err := env.FromString(test.source)
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Len(tpl.Root.Nodes, test.nodes)
+
+			reference, err := testEnv(*testdataFlag).FromString(test.source)
+			if !assert.NoError(err) {
+				return
+			}
+			expected, expectedErr := reference.Execute(ctx)
+			out, err := tpl.Execute(ctx)
+			if expectedErr != nil {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(test.expected, out)
+			assert.Equal(expected, out)
+		})
+	}
+}
+
+func TestOptimizeFoldsIntoData(t *testing.T) {
+	env := testEnv(*testdataFlag)
+	env.Optimize = true
+	tpl, err := env.FromString(`{% for i in [1] %}a{{ 1 + 1 }}{# c #}b{% endfor %}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var wrapper *nodes.Wrapper
+	nodes.Inspect(tpl.Root, func(node nodes.Node) bool {
+		if w, ok := node.(*nodes.Wrapper); ok && wrapper == nil {
+			wrapper = w
+		}
+		return true
+	})
+	if assert.NotNil(t, wrapper) && assert.Len(t, wrapper.Nodes, 1) {
+		data, ok := wrapper.Nodes[0].(*nodes.Data)
+		if assert.True(t, ok) {
+			assert.Equal(t, "a2b", data.Data.Val)
+		}
+	}
+}
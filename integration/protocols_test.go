@@ -0,0 +1,181 @@
+package integration_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// money implements the arithmetic and comparison operators
+type money struct {
+	cents int
+}
+
+func (m money) String() string {
+	return fmt.Sprintf("$%d.%02d", m.cents/100, m.cents%100)
+}
+
+// Escaped renders the amount as markup
+func (m money) Escaped() string {
+	return fmt.Sprintf(`<span class="money">%s</span>`, m)
+}
+
+func (m money) Compare(other any) (int, error) {
+	o, ok := other.(money)
+	if !ok {
+		return 0, errors.Errorf("can't compare money with %T", other)
+	}
+	return m.cents - o.cents, nil
+}
+
+func (m money) Operate(op string, other any, reflected bool) (any, error) {
+	switch o := other.(type) {
+	case money:
+		switch op {
+		case "+":
+			return money{m.cents + o.cents}, nil
+		case "-":
+			return money{m.cents - o.cents}, nil
+		}
+	case int:
+		if op == "*" {
+			return money{m.cents * o}, nil
+		}
+		if op == "/" && !reflected {
+			return money{m.cents / o}, nil
+		}
+	}
+	return nil, errors.Errorf("unsupported operation %s %s %T", m, op, other)
+}
+
+// record loads its fields lazily and counts the loads
+type record struct {
+	fields map[string]any
+	loads  int
+}
+
+func (r *record) Getattr(name string) (any, bool) {
+	r.loads++
+	value, ok := r.fields[name]
+	return value, ok
+}
+
+func (r *record) Getitem(key any) (any, bool) {
+	name, ok := key.(string)
+	if !ok {
+		return nil, false
+	}
+	return r.Getattr(strings.ToLower(name))
+}
+
+func (r *record) Iterate(yield func(key, value any) bool) {
+	for _, name := range []string{"id", "name"} {
+		if !yield(name, r.fields[name]) {
+			return
+		}
+	}
+}
+
+// cart is a sequence, empty when it has no items
+type cart struct {
+	items []string
+}
+
+func (c cart) Iterate(yield func(key, value any) bool) {
+	for _, item := range c.items {
+		if !yield(item, nil) {
+			return
+		}
+	}
+}
+
+func (c cart) Len() int {
+	return len(c.items)
+}
+
+// toggle is true when enabled
+type toggle struct {
+	enabled bool
+}
+
+func (f toggle) IsTrue() bool {
+	return f.enabled
+}
+
+var protocolCases = []struct {
+	name     string
+	source   string
+	expected string
+	err      string
+}{
+	{"escaped", `{{ price }}`, `<span class="money">$12.50</span>`, ""},
+	{"string", `{{ price | string }}`, "$12.50", ""},
+	{"addition", `{{ (price + fee) | string }}`, "$13.75", ""},
+	{"multiplication", `{{ (price * 2) | string }} {{ (2 * price) | string }}`, "$25.00 $25.00", ""},
+	{"comparison", `{{ price > fee }} {{ price <= fee }} {{ price == price }} {{ price != fee }}`, "True False True True", ""},
+	{"equality fallback", `{{ price == 1 }} {{ price != 1 }}`, "False True", ""},
+	{"unsupported operation", `{{ 2 / price }}`, "", "unsupported operation $12.50 / int"},
+	{"unsupported comparison", `{{ price < 1 }}`, "", "can't compare money with int"},
+	{"getattr", `{{ user.name }} {{ user.missing is undefined }}`, "Ada True", ""},
+	{"getitem", `{{ user["NAME"] }}`, "Ada", ""},
+	{"mapping", `{% for key, value in user %}{{ key }}={{ value }} {% endfor %}`, "id=1 name=Ada ", ""},
+	{"contains", `{{ "name" in user }} {{ "email" in user }}`, "True False", ""},
+	{"sequence", `{% for item in cart %}{{ loop.index }}/{{ loop.revindex }} {{ item }} {% endfor %}`, "1/2 apple 2/1 pear ", ""},
+	{"reversed", `{{ cart | reverse | join(",") }}`, "pear,apple", ""},
+	{"length", `{{ cart | length }} {{ empty | length }}`, "2 0", ""},
+	{"empty", `{% for item in empty %}{{ item }}{% else %}empty{% endfor %}`, "empty", ""},
+	{"truthiness from length", `{{ "yes" if cart else "no" }} {{ "yes" if empty else "no" }} {{ not empty }}`, "yes no True", ""},
+	{"truthiness", `{{ "on" if on else "off" }} {{ "on" if off else "off" }} {{ not off }}`, "on off True", ""},
+}
+
+func TestProtocols(t *testing.T) {
+	for _, tc := range protocolCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			for _, interpreted := range []bool{false, true} {
+				ctx := map[string]any{
+					"price": money{1250},
+					"fee":   money{125},
+					"user":  &record{fields: map[string]any{"id": 1, "name": "Ada"}},
+					"cart":  cart{[]string{"apple", "pear"}},
+					"empty": cart{},
+					"on":    toggle{true},
+					"off":   toggle{false},
+				}
+				env := testEnv(*testdataFlag)
+				env.Interpreted = interpreted
+				tpl, err := env.FromString(test.source)
+				if !assert.NoError(t, err) {
+					return
+				}
+				out, err := tpl.Execute(ctx)
+				if test.err != "" {
+					if assert.Error(t, err) {
+						assert.Contains(t, err.Error(), test.err)
+					}
+					continue
+				}
+				if assert.NoError(t, err, "interpreted: %t", interpreted) {
+					assert.Equal(t, test.expected, out, "interpreted: %t", interpreted)
+				}
+			}
+		})
+	}
+}
+
+func TestProtocolsLazyRecord(t *testing.T) {
+	user := &record{fields: map[string]any{"name": "Ada"}}
+	env := testEnv(*testdataFlag)
+	tpl, err := env.FromString(`{% if user %}{{ user.name }}{% endif %}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := tpl.Execute(map[string]any{"user": user})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Ada", out)
+		assert.Equal(t, 1, user.loads, "fields are only loaded when accessed")
+	}
+}
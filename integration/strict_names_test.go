@@ -0,0 +1,47 @@
+package integration_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var strictNamesCases = []struct {
+	name   string
+	source string
+	error  string
+}{
+	{"valid", `{% macro m(a, b=1) %}{{ a }}{% endmacro %}{{ m(1, b=2) | upper }}{% if x is odd %}{% endif %}`, ""},
+	{"unknown filter in a branch", "{% if false %}\n  {{ a | upper | nope }}\n{% endif %}", `string:2:18: Filter "nope" not found`},
+	{"unknown filter statement", `{% filter nope %}{% endfilter %}`, `string:1:11: Filter "nope" not found`},
+	{"unknown test", `{{ a is nope(1) }}`, `string:1:9: Test "nope" not found`},
+	{"first error", `{{ a is nope }}{{ b | nope }}`, `string:1:9: Test "nope" not found`},
+	{"too many arguments", `{% macro m(a) %}{% endmacro %}{{ m(1, 2) }}`, `string:1:39: macro 'm' received 2 arguments but expected only 1`},
+	{"unknown keyword", `{% macro m(a) %}{% endmacro %}{{ m(b=2) }}`, `string:1:36: macro 'm' takes no keyword argument 'b'`},
+	{"argument twice", `{% macro m(a) %}{% endmacro %}{{ m(1, a=2) }}`, `string:1:39: macro 'm' received 'a' argument twice`},
+	{"imported macro", `{% from "macro.helper" import imported_macro as im %}{{ im(1, 2) }}`, `string:1:63: macro 'imported_macro' received 2 arguments but expected only 1`},
+	{"shadowed macro", `{% macro m(a) %}{% endmacro %}{% set m = other %}{{ m(1, 2) }}`, ""},
+	{"statement", `{% nope %}`, `string:1:4: Statement 'nope' not found (or beginning not provided)`},
+}
+
+func TestStrictNames(t *testing.T) {
+	env := testEnv("./testdata")
+	env.StrictNames = true
+	for _, tc := range strictNamesCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			_, err := env.FromString(test.source)
+			if test.error == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Equal(t, test.error, err.Error())
+			}
+		})
+	}
+}
+
+func TestStrictNamesDisabled(t *testing.T) {
+	env := testEnv("./testdata")
+	_, err := env.FromString(`{% if false %}{{ a | nope }}{% endif %}`)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,6 @@
+{{ ("<b>"|safe) ~ "<i>" }}
+{{ "<i>" ~ ("<b>"|safe) }}
+{{ ("<b>"|safe) + "<i>" }}
+{{ "<i>" + "<b>" }}
+{{ html.fragment ~ " & more" }}
+{{ ("<i>"|safe) ~ 42 }}
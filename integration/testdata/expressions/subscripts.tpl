@@ -0,0 +1,17 @@
+{{ simple.multiple_item_list[1:] }}
+{{ simple.multiple_item_list[:3] }}
+{{ simple.multiple_item_list[2:5] }}
+{{ simple.multiple_item_list[::2] }}
+{{ simple.multiple_item_list[::-1] }}
+{{ simple.multiple_item_list[-3:] }}
+{{ simple.multiple_item_list[:-8] }}
+{{ simple.multiple_item_list[-2:-5:-1] }}
+{{ simple.multiple_item_list[5:2] }}
+{{ simple.multiple_item_list[-1] }}
+{{ simple.multiple_item_list[-10] }}
+{{ simple.name[1:] }}
+{{ simple.name[:-3] }}
+{{ simple.name[::-1] }}
+{{ simple.name[-1] }}
+{% set start = 1 %}{{ simple.name[start:start + 2] }}
+{% set items = ["a", "b", "c", "d"] %}{{ items[1::2] }}
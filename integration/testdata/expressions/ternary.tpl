@@ -4,4 +4,12 @@
 {{ "never" if 2 is odd else "if and else when false" }}
 {{ "never" if None else "when condition is nil" }}
 {{ "never" if '' else "when condition is empty string" }}
-{{ "never" if 0 else "when condition is 0" }}
\ No newline at end of file
+{{ "never" if 0 else "when condition is 0" }}
+{{ "as filter argument"|replace("argument", "arg" if true else "param") }}
+{{ ["in", "a" if false else "the", "list"]|join(" ") }}
+{{ "chained" if false else "conditional" if true else "never" }}
+{{ ("filtered if true"|upper) if true }}
+{{ ("missing else" if false) is undefined }}
+{% set assigned = "assigned" if 1 > 0 else "never" %}{{ assigned }}
+{% macro greet(name="macro default" if true else "never") %}{{ name }}{% endmacro %}{{ greet() }}
+{% for i in [1, 2, 3] if i is odd %}{{ i if i > 1 else "one" }} {% endfor %}
@@ -0,0 +1,17 @@
+{{ "<b>%s</b>"|safe|format("<i>") }}
+{{ "<b>%s</b>"|format("<i>") }}
+{{ ["<b>"|safe, "<i>"]|join(", ") }}
+{{ ["<b>", "<i>"]|join("<br>"|safe) }}
+{{ ["<b>", "<i>"]|join(", ") }}
+{{ "a & b"|replace("&", "<br>"|safe) }}
+{{ "<b>a</b>"|safe|replace("a", "<i>") }}
+{{ "<b>a</b>"|replace("a", "c") }}
+{{ "<b>safe</b>"|safe|upper }}
+{{ "<b>SAFE</b>"|safe|lower }}
+{{ "<b>safe</b>"|safe|title }}
+{{ "<b>safe</b>"|safe|capitalize }}
+{{ "  <b>safe</b>  "|safe|trim }}
+{{ "<b>"|safe|center(7) }}
+{{ "<b>a</b> b c d e f g h i j k l"|safe|truncate(20, end="<>") }}
+{{ "<b>line</b>\n<b>line</b>"|safe|indent(2) }}
+{{ "<b>"|upper }}
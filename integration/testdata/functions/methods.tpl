@@ -0,0 +1,23 @@
+{{ simple.name.upper() }} {{ simple.name.title() }} {{ simple.name.capitalize() }} {{ "MiXed".swapcase() }}
+{{ "  padded  ".strip() }}|{{ "xxhixx".strip("x") }}|{{ "  left".lstrip() }}|{{ "right  ".rstrip() }}|
+{{ "/usr/bin".startswith("/") }} {{ "file.tpl".endswith((".html", ".tpl")) }} {{ "abc".startswith("b") }}
+{{ "a,b,,c".split(",") }} {{ "  a  b c ".split() }} {{ "a b c d".split(" ", 2) }} {{ "a b c d".rsplit(" ", 1) }}
+{{ "one\ntwo\r\nthree".splitlines() }}
+{{ "-".join(["a", "b", "c"]) }} {{ ", ".join(simple.multiple_item_list[:3]) }}
+{{ "aaa".replace("a", "b", 2) }} {{ "hello".find("l") }} {{ "hello".rfind("l") }} {{ "hello".find("z") }} {{ "hello".count("l") }}
+{{ "42".isdigit() }} {{ "abc".isalpha() }} {{ "a1".isalnum() }} {{ "  ".isspace() }} {{ "ABC".isupper() }} {{ "abc".islower() }}
+[{{ "ab".center(6, "*") }}] [{{ "ab".ljust(4) }}] [{{ "ab".rjust(4, "-") }}] [{{ "42".zfill(5) }}] [{{ "-42".zfill(5) }}]
+{{ ("<b>"|safe).upper() }} {{ "<i>".upper() }}
+{% set items = [3, 1, 2] %}{{ items.append(4) }}{{ items }}
+{{ items.pop() }} {{ items.pop(0) }} {{ items }}
+{{ items.extend([5, 6]) }}{{ items.insert(0, 0) }}{{ items }}
+{{ items.index(5) }} {{ items.count(1) }} {{ items.remove(1) }}{{ items }}
+{{ items.reverse() }}{{ items }} {{ items.sort() }}{{ items }} {{ items.sort(reverse=True) }}{{ items }}
+{% for i in [1, 2] %}{{ items.append(i) }}{% endfor %}{{ items }} {{ items.copy() }} {{ items.clear() }}{{ items }}
+{% set d = {"a": 1, "b": 2} %}{{ d.keys() }} {{ d.values() }} {{ d.items() }}
+{{ d.get("a") }} {{ d.get("z", "default") }} {{ d.get("z") is none }}
+{{ d.setdefault("c", 3) }} {{ d.setdefault("a", 9) }} {{ d.pop("b") }} {{ d.pop("z", "none") }} {{ d }}
+{{ d.update({"e": 5}) }}{{ d.update(f=6) }}{{ d }}
+{% for k, v in d.items() %}{{ k }}={{ v }} {% endfor %}
+{{ simple.intmap.get(5) }} {{ simple.intmap.keys() }} {{ simple.strmap.get("gh") }}
+{% set obj = {"items": [1]} %}{{ obj.items.append(2) }}{{ obj["items"].append(3) }}{{ obj.items.extend([4]) }}{{ obj.items }}
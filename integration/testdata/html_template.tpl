@@ -0,0 +1,6 @@
+{{ html.fragment }}
+<p {{ html.attr }}>{{ "text" }}</p>
+<a href="{{ html.url }}">link</a>
+<script>{{ html.js }}</script>
+{{ html.fn() }}
+{{ "<b>unsafe</b>" }}
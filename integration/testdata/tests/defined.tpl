@@ -6,3 +6,4 @@
 {{ simple.str is not defined }}
 {{ simple.missing is defined }}
 {{ simple.missing is not defined }}
+{{ simple.nil is defined }}
@@ -2,3 +2,4 @@
 {{ simple.nil is none }}
 {{ simple.nil is not none }}
 {{ simple.number is none }}
+{{ not_found is none }}
@@ -0,0 +1,4 @@
+[{{ missing.attr.deeper }}] [{{ simple.missing.attr }}] [{{ missing['key'].attr }}]
+{{ missing.attr is defined }} {{ simple.missing.attr is undefined }}
+{{ missing.attr | default('fallback') }}
+[{{ (missing | try).attr }}] [{{ ("" | try).attr.deeper }}]
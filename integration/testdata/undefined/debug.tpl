@@ -0,0 +1,5 @@
+Hello {{ missing }}!
+Hello {{ simple.missing }} and {{ simple['missing'] }}!
+Hello {{ simple.str }}!
+{{ missing is defined }} {{ missing | default('fallback') }}
+{{ "x" if false }}
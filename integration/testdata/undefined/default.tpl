@@ -0,0 +1,5 @@
+[{{ missing }}] [{{ simple.missing }}] [{{ simple['missing'] }}]
+{{ missing is defined }} {{ simple.missing is undefined }} {{ missing is none }}
+{{ missing | default('fallback') }} {{ simple.missing | default('fallback') }}
+{% if missing %}truthy{% else %}falsy{% endif %}
+{% for item in missing %}{{ item }}{% else %}empty{% endfor %}
@@ -0,0 +1,3 @@
+{{ missing is defined }} {{ simple.missing is undefined }} {{ simple.str is defined }}
+{{ missing | default('fallback') }}
+[{{ "x" if false }}] {{ ("x" if false) is defined }}
@@ -0,0 +1,3 @@
+[{{ missing.attr }}] [{{ simple.missing.attr }}] [{{ missing["key"].attr }}]
+{{ missing.attr is defined }} {{ missing.attr | default("fallback") }}
+[{{ (missing | try).attr }}] [{{ ("" | try).attr.deeper }}]
@@ -0,0 +1,12 @@
+Indented blocks:
+    {% if true %}
+    yes
+    {% endif %}
+	{# tabbed comment #}
+Text before {% if true %}is kept{% endif %}
+    {{ "variables are kept" }}
+A plus opts out:
+    {%+ if true %}
+    kept
+    {%+ endif %}
+end
@@ -0,0 +1,5 @@
+first
+secondthird
+{% if true %}
+fourth
+{% endif %}
@@ -0,0 +1 @@
+Single trailing newline is removed
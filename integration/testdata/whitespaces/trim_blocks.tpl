@@ -0,0 +1,21 @@
+Blocks leave no blank line:
+{% if true %}
+yes
+{% endif %}
+{% for i in simple.multiple_item_list %}
+{{ i }}
+{% endfor %}
+Comments too:
+{# a comment #}
+after comment
+Variables keep their newline:
+{{ "value" }}
+A plus keeps the newline:
+{% if true +%}
+kept
+{% endif +%}
+done
+    {% if true %}
+indentation is kept
+    {% endif %}
+end
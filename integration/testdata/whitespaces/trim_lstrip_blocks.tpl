@@ -0,0 +1,13 @@
+<ul>
+    {% for i in simple.multiple_item_list %}
+    <li>{{ i }}</li>
+    {% endfor %}
+</ul>
+config:
+  {% if true %}
+  enabled: true
+  {% else %}
+  enabled: false
+  {% endif %}
+  {# comment #}
+  name: gonja
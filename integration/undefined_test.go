@@ -0,0 +1,188 @@
+package integration_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/MarioJim/gonja"
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/exec"
+)
+
+// undefinedPolicies holds the undefined policy to use by fixture name
+var undefinedPolicies = map[string]exec.UndefinedFunc{
+	"default":   exec.DefaultUndefined,
+	"chainable": exec.ChainableUndefined,
+	"debug":     exec.DebugUndefined,
+	"strict":    exec.StrictUndefined,
+	"unset":     nil,
+}
+
+func TestUndefined(t *testing.T) {
+	files, err := filepath.Glob("testdata/undefined/*.tpl")
+	if err != nil {
+		panic(err)
+	}
+	for _, path := range files {
+		source := path
+		output := path + ".out"
+		name := strings.TrimSuffix(filepath.Base(source), ".tpl")
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Error(err)
+				}
+			}()
+			env := gonja.NewEnvironment(config.NewConfig(), gonja.DefaultLoader)
+			env.Undefined = undefinedPolicies[name]
+
+			tpl, err := env.FromFile(source)
+			if err != nil {
+				t.Fatalf("Error on FromFile('%s'): %s", source, err.Error())
+			}
+			expected, rerr := os.ReadFile(output)
+			if rerr != nil {
+				t.Fatalf("Error on ReadFile('%s'): %s", output, rerr.Error())
+			}
+			rendered, err := tpl.ExecuteBytes(Fixtures)
+			if err != nil {
+				t.Fatalf("Error on Execute('%s'): %s", source, err.Error())
+			}
+			if !bytes.Equal(expected, rendered) {
+				diff := difflib.UnifiedDiff{
+					A:        difflib.SplitLines(string(expected)),
+					B:        difflib.SplitLines(string(rendered)),
+					FromFile: "Expected",
+					ToFile:   "Rendered",
+					Context:  2,
+					Eol:      "\n",
+				}
+				result, _ := difflib.GetUnifiedDiffString(diff)
+				t.Errorf("%s rendered with diff:\n%v", source, result)
+			}
+		})
+	}
+}
+
+func TestUndefinedErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   exec.UndefinedFunc
+		template string
+		message  string
+	}{
+		{"default attribute", exec.DefaultUndefined, "{{ missing.attr }}", `'missing' is undefined`},
+		{"debug attribute", exec.DebugUndefined, "{{ missing.attr }}", `'missing' is undefined`},
+		{"strict name", exec.StrictUndefined, "{{ missing }}", `'missing' is undefined`},
+		{"strict attribute", exec.StrictUndefined, "{{ simple.missing }}", `'simple' has no attribute 'missing'`},
+		{"strict item", exec.StrictUndefined, "{{ simple['missing'] }}", `'simple' has no item 'missing'`},
+	} {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			env := gonja.NewEnvironment(config.NewConfig(), gonja.DefaultLoader)
+			env.Undefined = test.policy
+			tpl, err := env.FromString(test.template)
+			if err != nil {
+				t.Fatalf("Error on FromString('%s'): %s", test.template, err.Error())
+			}
+			_, err = tpl.Execute(Fixtures)
+			if err == nil {
+				t.Fatalf("Expected an error rendering '%s'", test.template)
+			}
+			if !strings.Contains(err.Error(), test.message) {
+				t.Errorf("Expected error '%s' to contain '%s'", err.Error(), test.message)
+			}
+		})
+	}
+}
+
+func TestCollectUndefined(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.StrictUndefined = true
+	env := gonja.NewEnvironment(cfg, gonja.DefaultLoader)
+	tpl, err := env.FromString("{{ missing.attr }}|{{ simple.str }}\n{% if simple.missing %}{% endif %}{{ simple['nope'] }}|{{ simple.number }}")
+	if err != nil {
+		t.Fatalf("Error on FromString: %s", err.Error())
+	}
+	out, accesses, err := tpl.ExecuteCollectUndefined(Fixtures)
+	if err != nil {
+		t.Fatalf("Error on ExecuteCollectUndefined: %s", err.Error())
+	}
+	if out != "|string\n|42" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	expected := []string{
+		`missing.attr ('missing' is undefined) at line 1 col 4`,
+		`simple.missing ('simple' has no attribute 'missing') at line 2 col 13`,
+		`simple['nope'] ('simple' has no item 'nope') at line 2 col 44`,
+	}
+	if len(accesses) != len(expected) {
+		t.Fatalf("Expected %d undefined accesses, got %d: %v", len(expected), len(accesses), accesses)
+	}
+	for idx, access := range accesses {
+		if access.String() != expected[idx] {
+			t.Errorf("Expected undefined access '%s', got '%s'", expected[idx], access)
+		}
+	}
+}
+
+func TestCollectUndefinedPaths(t *testing.T) {
+	env := gonja.NewEnvironment(config.NewConfig(), gonja.DefaultLoader)
+	tpl, err := env.FromString(`{{ user.address.city }}{{ user['emails'][0] }}{{ simple.missing.deeper['key'].attr }}{{ simple.strmap.missing }}`)
+	if err != nil {
+		t.Fatalf("Error on FromString: %s", err.Error())
+	}
+	_, accesses, err := tpl.ExecuteCollectUndefined(Fixtures)
+	if err != nil {
+		t.Fatalf("Error on ExecuteCollectUndefined: %s", err.Error())
+	}
+	expected := []string{
+		`user.address.city ('user' is undefined) at line 1 col 4`,
+		`user['emails'][0] ('user' is undefined) at line 1 col 27`,
+		`simple.missing.deeper['key'].attr ('simple' has no attribute 'missing') at line 1 col 56`,
+		`simple.strmap.missing ('simple.strmap' has no attribute 'missing') at line 1 col 102`,
+	}
+	if len(accesses) != len(expected) {
+		t.Fatalf("Expected %d undefined accesses, got %d: %v", len(expected), len(accesses), accesses)
+	}
+	for idx, access := range accesses {
+		if access.String() != expected[idx] {
+			t.Errorf("Expected undefined access '%s', got '%s'", expected[idx], access)
+		}
+	}
+}
+
+func TestCollectUndefinedTemplates(t *testing.T) {
+	for _, interpreted := range []bool{false, true} {
+		env := testEnv(filepath.Join(*testdataFlag, "undefined"))
+		env.Interpreted = interpreted
+		tpl, err := env.FromFile("collect_child.helper")
+		if err != nil {
+			t.Fatalf("Error on FromFile: %s", err.Error())
+		}
+		_, accesses, err := tpl.ExecuteCollectUndefined(nil)
+		if err != nil {
+			t.Fatalf("Error on ExecuteCollectUndefined: %s", err.Error())
+		}
+		expected := []string{
+			"collect_child.helper: child_missing at line 1 col 55",
+			"collect_included.helper: included_missing at line 1 col 4",
+			"collect_base.helper: base_missing at line 1 col 20",
+		}
+		if len(accesses) != len(expected) {
+			t.Fatalf("Expected %d undefined accesses, got %d: %v", len(expected), len(accesses), accesses)
+		}
+		for idx, access := range accesses {
+			located := fmt.Sprintf("%s: %s at line %d col %d", access.Template, access.Name, access.Line, access.Col)
+			if located != expected[idx] {
+				t.Errorf("Expected undefined access '%s', got '%s' (interpreted: %t)", expected[idx], located, interpreted)
+			}
+		}
+	}
+}
@@ -12,6 +12,26 @@ import (
 	"github.com/pmezard/go-difflib/difflib"
 )
 
+// whitespaceConfigs holds the whitespace options to set by fixture name
+var whitespaceConfigs = map[string]func(*config.Config){
+	"trim_blocks": func(cfg *config.Config) {
+		cfg.TrimBlocks = true
+	},
+	"lstrip_blocks": func(cfg *config.Config) {
+		cfg.LstripBlocks = true
+	},
+	"trim_lstrip_blocks": func(cfg *config.Config) {
+		cfg.TrimBlocks = true
+		cfg.LstripBlocks = true
+	},
+	"no_trailing_newline": func(cfg *config.Config) {
+		cfg.KeepTrailingNewline = false
+	},
+	"newline_sequence": func(cfg *config.Config) {
+		cfg.NewlineSequence = "\r\n"
+	},
+}
+
 func TestWhiteSpace(t *testing.T) {
 	files, err := filepath.Glob("testdata/whitespaces/*.tpl")
 	if err != nil {
@@ -28,6 +48,9 @@ func TestWhiteSpace(t *testing.T) {
 				}
 			}()
 			cfg := config.NewConfig()
+			if setup, ok := whitespaceConfigs[name]; ok {
+				setup(cfg)
+			}
 			env := gonja.NewEnvironment(cfg, gonja.DefaultLoader)
 
 			tpl, err := env.FromFile(source)
@@ -0,0 +1,290 @@
+// Package lint reports common problems in templates without rendering them.
+//
+// It builds on the analysis package: each rule looks at the names, filters,
+// tests and branches of the templates and reports located diagnostics.
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/MarioJim/gonja/analysis"
+	"github.com/MarioJim/gonja/exec"
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// Rule names
+const (
+	SyntaxError       = "syntax-error"
+	UnknownFilter     = "unknown-filter"
+	UnknownTest       = "unknown-test"
+	UnusedMacro       = "unused-macro"
+	UnusedVariable    = "unused-variable"
+	LoopShadowing     = "loop-shadowing"
+	UnreachableBranch = "unreachable-branch"
+	DeprecatedFilter  = "deprecated-filter"
+)
+
+// Severity of a diagnostic
+type Severity int
+
+const (
+	Off Severity = iota // Disables a rule
+	Info
+	Warning
+	Error
+)
+
+var severityNames = map[Severity]string{
+	Off:     "off",
+	Info:    "info",
+	Warning: "warning",
+	Error:   "error",
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// ParseSeverity returns the severity named name
+func ParseSeverity(name string) (Severity, error) {
+	for severity, sname := range severityNames {
+		if sname == name {
+			return severity, nil
+		}
+	}
+	return Off, fmt.Errorf("unknown severity '%s'", name)
+}
+
+// DefaultRules are the severities of the rules by default
+var DefaultRules = map[string]Severity{
+	SyntaxError:       Error,
+	UnknownFilter:     Error,
+	UnknownTest:       Error,
+	UnusedMacro:       Warning,
+	UnusedVariable:    Warning,
+	LoopShadowing:     Warning,
+	UnreachableBranch: Warning,
+	DeprecatedFilter:  Info,
+}
+
+// DefaultDeprecatedFilters maps the deprecated filter aliases to their
+// replacement. It is empty, the aliases of the builtin filters such as `d`
+// and `e` being supported like in Jinja.
+var DefaultDeprecatedFilters = map[string]string{}
+
+// Diagnostic is a problem located in a template
+type Diagnostic struct {
+	Template string
+	Line     int
+	Col      int
+	Rule     string
+	Severity Severity
+	Message  string
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s (%s)", d.Template, d.Line, d.Col, d.Severity, d.Message, d.Rule)
+}
+
+// Linter checks templates against a set of rules
+type Linter struct {
+	// Rules maps rule names to their severity, missing rules are disabled
+	Rules map[string]Severity
+	// DeprecatedFilters maps deprecated filter names to their replacement
+	DeprecatedFilters map[string]string
+	// Filters and Tests are the known filters and tests, unknown ones are
+	// not checked if nil
+	Filters *exec.FilterSet
+	Tests   *exec.TestSet
+}
+
+// New returns a linter with the default rules, checking filters and tests
+// against the ones of the configuration
+func New(cfg *exec.EvalConfig) *Linter {
+	rules := map[string]Severity{}
+	for rule, severity := range DefaultRules {
+		rules[rule] = severity
+	}
+	deprecated := map[string]string{}
+	for name, replacement := range DefaultDeprecatedFilters {
+		deprecated[name] = replacement
+	}
+	return &Linter{
+		Rules:             rules,
+		DeprecatedFilters: deprecated,
+		Filters:           cfg.Filters,
+		Tests:             cfg.Tests,
+	}
+}
+
+// Lint checks templates and returns the diagnostics sorted by template and
+// position. The macros and variables of a template referenced by another
+// one are never reported as unused, as the referencing template may use them.
+func (l *Linter) Lint(templates ...*nodes.Template) []*Diagnostic {
+	referenced := map[string]bool{}
+	for _, tpl := range templates {
+		for _, name := range analysis.ReferencedTemplates(tpl) {
+			referenced[name] = true
+		}
+	}
+	diagnostics := []*Diagnostic{}
+	for _, tpl := range templates {
+		c := &checker{
+			Linter:     l,
+			template:   tpl,
+			referenced: referenced[tpl.Name],
+			used:       map[nodes.Node]bool{},
+			unresolved: map[string]bool{},
+		}
+		diagnostics = append(diagnostics, c.check()...)
+	}
+	SortDiagnostics(diagnostics)
+	return diagnostics
+}
+
+// SyntaxErrors returns the diagnostics of errors returned by ParseRecovering
+func (l *Linter) SyntaxErrors(errs []*parser.TemplateError) []*Diagnostic {
+	severity := l.Rules[SyntaxError]
+	diagnostics := []*Diagnostic{}
+	if severity == Off {
+		return diagnostics
+	}
+	for _, err := range errs {
+		message := err.Message
+		if err.Err != nil {
+			message += ": " + err.Err.Error()
+		}
+		diagnostics = append(diagnostics, &Diagnostic{
+			Template: err.Template,
+			Line:     err.Line,
+			Col:      err.Col,
+			Rule:     SyntaxError,
+			Severity: severity,
+			Message:  message,
+		})
+	}
+	return diagnostics
+}
+
+// SortDiagnostics sorts diagnostics by template and position
+func SortDiagnostics(diagnostics []*Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Template != b.Template {
+			return a.Template < b.Template
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+}
+
+// declaration is a macro or a variable which should be used
+type declaration struct {
+	rule  string
+	name  string
+	node  nodes.Node
+	token *tokens.Token
+}
+
+// checker lints a single template
+type checker struct {
+	*Linter
+	template   *nodes.Template
+	referenced bool
+
+	declarations []declaration
+	used         map[nodes.Node]bool
+	unresolved   map[string]bool // Names read without a known declaration
+	diagnostics  []*Diagnostic
+}
+
+func (c *checker) check() []*Diagnostic {
+	analysis.AnalyzeWith(c.template, &analysis.Hooks{
+		Declare:     c.declare,
+		Assign:      c.assign,
+		Read:        c.read,
+		Filter:      c.filter,
+		Test:        c.test,
+		Unreachable: c.unreachable,
+	})
+	for _, decl := range c.declarations {
+		// Macros may be called before being defined, from another macro
+		if !c.used[decl.node] && !c.unresolved[decl.name] {
+			c.report(decl.rule, decl.token, "%s '%s' is never used", kinds[decl.rule], decl.name)
+		}
+	}
+	return c.diagnostics
+}
+
+var kinds = map[string]string{
+	UnusedMacro:    "macro",
+	UnusedVariable: "variable",
+}
+
+func (c *checker) report(rule string, token *tokens.Token, format string, args ...interface{}) {
+	severity := c.Rules[rule]
+	if severity == Off {
+		return
+	}
+	diagnostic := &Diagnostic{
+		Template: c.template.Name,
+		Rule:     rule,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if token != nil {
+		diagnostic.Line = token.Line
+		diagnostic.Col = token.Col
+	}
+	c.diagnostics = append(c.diagnostics, diagnostic)
+}
+
+func (c *checker) declare(name string, node nodes.Node) {
+	// Imported macros are declared by another template
+	if macro, ok := node.(*nodes.Macro); ok && c.template.Macros[name] == macro && !c.referenced {
+		c.declarations = append(c.declarations, declaration{UnusedMacro, name, node, macro.Location})
+	}
+}
+
+func (c *checker) assign(target *nodes.Name, shadows bool) {
+	if shadows {
+		// Reported once, the value is usually read by the next iteration
+		c.report(LoopShadowing, target.Name, "set of '%s' in a loop does not change '%s' outside of the loop", target.Name.Val, target.Name.Val)
+		return
+	}
+	if !c.referenced {
+		c.declarations = append(c.declarations, declaration{UnusedVariable, target.Name.Val, target, target.Name})
+	}
+}
+
+func (c *checker) read(name *nodes.Name, decl nodes.Node) {
+	if decl != nil {
+		c.used[decl] = true
+	} else {
+		c.unresolved[name.Name.Val] = true
+	}
+}
+
+func (c *checker) filter(call *nodes.FilterCall) {
+	if c.Filters != nil && !c.Filters.Exists(call.Name) {
+		c.report(UnknownFilter, call.Token, "unknown filter '%s'", call.Name)
+	}
+	if replacement, ok := c.DeprecatedFilters[call.Name]; ok {
+		c.report(DeprecatedFilter, call.Token, "filter '%s' is deprecated, use '%s'", call.Name, replacement)
+	}
+}
+
+func (c *checker) test(call *nodes.TestCall) {
+	if c.Tests != nil && !c.Tests.Exists(call.Name) {
+		c.report(UnknownTest, call.Token, "unknown test '%s'", call.Name)
+	}
+}
+
+func (c *checker) unreachable(branch *nodes.Wrapper) {
+	c.report(UnreachableBranch, branch.Location, "branch is unreachable, a previous condition is always true")
+}
@@ -0,0 +1,132 @@
+package lint_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja"
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/lint"
+	"github.com/MarioJim/gonja/loaders"
+	"github.com/MarioJim/gonja/nodes"
+)
+
+var lintCases = []struct {
+	name        string
+	source      string
+	diagnostics []string
+}{
+	{"clean", `{% set a = b %}{% for x in a %}{{ x | upper }}{% endfor %}`, []string{}},
+	{"unknown filter", `{{ a | nope }}{{ b | upper | nope2(1) }}`, []string{
+		`string:1:8: error: unknown filter 'nope' (unknown-filter)`,
+		`string:1:30: error: unknown filter 'nope2' (unknown-filter)`,
+	}},
+	{"unknown test", `{% if a is nope %}{% endif %}{{ b is odd }}`, []string{
+		`string:1:12: error: unknown test 'nope' (unknown-test)`,
+	}},
+	{"unused macro", `{% macro used() %}{% endmacro %}{% macro unused() %}{{ used() }}{% endmacro %}`, []string{
+		`string:1:42: warning: macro 'unused' is never used (unused-macro)`,
+	}},
+	{"macro called before definition", `{% macro a() %}{{ b() }}{% endmacro %}{% macro b() %}{% endmacro %}{{ a() }}`, []string{}},
+	{"unused variable", "{% set a = 1 %}{% set b = 2 %}\n{{ b }}{% with c = 3 %}{% set d = c %}{% endwith %}", []string{
+		`string:1:8: warning: variable 'a' is never used (unused-variable)`,
+		`string:2:31: warning: variable 'd' is never used (unused-variable)`,
+	}},
+	{"set in loop shadows", `{% set total = 0 %}{% for x in xs %}{% set total = total + x %}{% set y = x %}{{ y }}{% endfor %}{{ total }}`, []string{
+		`string:1:44: warning: set of 'total' in a loop does not change 'total' outside of the loop (loop-shadowing)`,
+	}},
+	{"set in nested loops", `{% for x in xs %}{% set n = x %}{% for y in x %}{% set n = y %}{% endfor %}{{ n }}{% endfor %}`, []string{
+		`string:1:56: warning: set of 'n' in a loop does not change 'n' outside of the loop (loop-shadowing)`,
+	}},
+	{"unreachable branches", `{% if true %}a{% elif b %}b{% else %}c{% endif %}{% if not 0 %}d{% else %}e{% endif %}{% if a %}f{% else %}g{% endif %}`, []string{
+		`string:1:27: warning: branch is unreachable, a previous condition is always true (unreachable-branch)`,
+		`string:1:38: warning: branch is unreachable, a previous condition is always true (unreachable-branch)`,
+		`string:1:75: warning: branch is unreachable, a previous condition is always true (unreachable-branch)`,
+	}},
+	{"deprecated filters", `{{ a | d("x") | e | title }}{% filter e %}{{ b }}{% endfilter %}`, []string{
+		`string:1:8: info: filter 'd' is deprecated, use 'default' (deprecated-filter)`,
+		`string:1:17: info: filter 'e' is deprecated, use 'escape' (deprecated-filter)`,
+		`string:1:39: info: filter 'e' is deprecated, use 'escape' (deprecated-filter)`,
+	}},
+}
+
+func lintEnv() *gonja.Environment {
+	loader := loaders.MustNewFileSystemLoader("../integration/testdata")
+	return gonja.NewEnvironment(config.NewConfig(), loader)
+}
+
+func messages(diagnostics []*lint.Diagnostic) []string {
+	messages := []string{}
+	for _, diagnostic := range diagnostics {
+		messages = append(messages, diagnostic.String())
+	}
+	return messages
+}
+
+func TestLint(t *testing.T) {
+	env := lintEnv()
+	linter := lint.New(env.EvalConfig)
+	linter.DeprecatedFilters = map[string]string{"d": "default", "e": "escape"}
+	for _, tc := range lintCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			tpl, err := env.FromString(test.source)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, test.diagnostics, messages(linter.Lint(tpl.Root)))
+		})
+	}
+}
+
+func TestLintRules(t *testing.T) {
+	env := lintEnv()
+	tpl, err := env.FromString(`{% set a = 1 %}{{ b | d }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	linter := lint.New(env.EvalConfig)
+	linter.Rules[lint.UnusedVariable] = lint.Off
+	linter.Rules[lint.DeprecatedFilter] = lint.Error
+	linter.DeprecatedFilters["d"] = "default"
+	assert.Equal(t, []string{
+		`string:1:23: error: filter 'd' is deprecated, use 'default' (deprecated-filter)`,
+	}, messages(linter.Lint(tpl.Root)))
+}
+
+func TestLintReferencedTemplates(t *testing.T) {
+	env := lintEnv()
+	templates := []*nodes.Template{}
+	for _, name := range []string{"lint/page.helper", "lint/macros.helper"} {
+		tpl, err := env.FromFile(name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		templates = append(templates, tpl.Root)
+	}
+	linter := lint.New(env.EvalConfig)
+	assert.Equal(t, []string{
+		`lint/page.helper:2:10: warning: macro 'card' is never used (unused-macro)`,
+		`lint/page.helper:4:31: warning: set of 'total' in a loop does not change 'total' outside of the loop (loop-shadowing)`,
+	}, messages(linter.Lint(templates...)))
+}
+
+func TestLintAliasesNotDeprecatedByDefault(t *testing.T) {
+	env := lintEnv()
+	tpl, err := env.FromString(`{{ a | d("x") | e }}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{}, messages(lint.New(env.EvalConfig).Lint(tpl.Root)))
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	env := lintEnv()
+	linter := lint.New(env.EvalConfig)
+	_, errs := env.ParseRecovering("tpl", "{{ a ) }}\n{% foo %}")
+	assert.Equal(t, []string{
+		`tpl:1:6: error: Unexpected delimiter ")" (syntax-error)`,
+		`tpl:2:4: error: Statement 'foo' not found (or beginning not provided) (syntax-error)`,
+	}, messages(linter.SyntaxErrors(errs)))
+}
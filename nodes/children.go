@@ -0,0 +1,296 @@
+package nodes
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Parent is implemented by every node and builtin statement to enumerate
+// and replace its direct children.
+type Parent interface {
+	Node
+	// Children returns the non-nil direct children in source order
+	Children() []Node
+	// ReplaceChildren replaces every non-nil direct child with fn(child),
+	// in source order. Children held with a concrete type (like *Wrapper)
+	// must be replaced by a node of the same type.
+	ReplaceChildren(fn func(Node) Node)
+}
+
+// AppendChildren appends the non-nil nodes to children
+func AppendChildren(children []Node, nodes ...Node) []Node {
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		if w, ok := node.(*Wrapper); ok && w == nil {
+			continue
+		}
+		children = append(children, node)
+	}
+	return children
+}
+
+// AppendExpressions appends the non-nil expressions to children
+func AppendExpressions(children []Node, exprs []Expression) []Node {
+	for _, expr := range exprs {
+		children = AppendChildren(children, expr)
+	}
+	return children
+}
+
+// AppendKwargs appends keyword arguments to children, sorted by keyword
+func AppendKwargs(children []Node, kwargs map[string]Expression) []Node {
+	for _, key := range sortedKeys(kwargs) {
+		children = AppendChildren(children, kwargs[key])
+	}
+	return children
+}
+
+// AppendFilters appends the arguments of a filter chain to children
+func AppendFilters(children []Node, filters []*FilterCall) []Node {
+	for _, filter := range filters {
+		children = AppendExpressions(children, filter.Args)
+		children = AppendKwargs(children, filter.Kwargs)
+	}
+	return children
+}
+
+// ReplaceExpression returns fn(expr), or nil if expr is nil
+func ReplaceExpression(expr Expression, fn func(Node) Node) Expression {
+	if expr == nil {
+		return nil
+	}
+	return fn(expr)
+}
+
+// ReplaceExpressions replaces expressions in place
+func ReplaceExpressions(exprs []Expression, fn func(Node) Node) {
+	for idx, expr := range exprs {
+		exprs[idx] = ReplaceExpression(expr, fn)
+	}
+}
+
+// ReplaceKwargs replaces keyword arguments in place, sorted by keyword
+func ReplaceKwargs(kwargs map[string]Expression, fn func(Node) Node) {
+	for _, key := range sortedKeys(kwargs) {
+		kwargs[key] = ReplaceExpression(kwargs[key], fn)
+	}
+}
+
+// ReplaceFilters replaces the arguments of a filter chain in place
+func ReplaceFilters(filters []*FilterCall, fn func(Node) Node) {
+	for _, filter := range filters {
+		ReplaceExpressions(filter.Args, fn)
+		ReplaceKwargs(filter.Kwargs, fn)
+	}
+}
+
+// ReplaceWrapper returns fn(wrapper), or nil if wrapper is nil
+func ReplaceWrapper(wrapper *Wrapper, fn func(Node) Node) *Wrapper {
+	if wrapper == nil {
+		return nil
+	}
+	replaced, ok := fn(wrapper).(*Wrapper)
+	if !ok {
+		panic(fmt.Sprintf("%s must be replaced by a wrapper", wrapper))
+	}
+	return replaced
+}
+
+// ReplacePair returns fn(pair), or nil if pair is nil
+func ReplacePair(pair *Pair, fn func(Node) Node) *Pair {
+	if pair == nil {
+		return nil
+	}
+	replaced, ok := fn(pair).(*Pair)
+	if !ok {
+		panic(fmt.Sprintf("%s must be replaced by a pair", pair))
+	}
+	return replaced
+}
+
+func sortedKeys(kwargs map[string]Expression) []string {
+	keys := make([]string, 0, len(kwargs))
+	for key := range kwargs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *Template) Children() []Node { return AppendChildren(nil, t.Nodes...) }
+func (t *Template) ReplaceChildren(fn func(Node) Node) {
+	for idx, node := range t.Nodes {
+		t.Nodes[idx] = fn(node)
+	}
+}
+
+func (d *Data) Children() []Node                   { return nil }
+func (d *Data) ReplaceChildren(fn func(Node) Node) {}
+
+func (c *Comment) Children() []Node                   { return nil }
+func (c *Comment) ReplaceChildren(fn func(Node) Node) {}
+
+func (o *Output) Children() []Node { return AppendChildren(nil, o.Expression) }
+func (o *Output) ReplaceChildren(fn func(Node) Node) {
+	o.Expression = ReplaceExpression(o.Expression, fn)
+}
+
+func (expr *FilteredExpression) Children() []Node {
+	return AppendFilters(AppendChildren(nil, expr.Expression), expr.Filters)
+}
+func (expr *FilteredExpression) ReplaceChildren(fn func(Node) Node) {
+	expr.Expression = ReplaceExpression(expr.Expression, fn)
+	ReplaceFilters(expr.Filters, fn)
+}
+
+func (expr *TestExpression) Children() []Node {
+	children := AppendExpressions(AppendChildren(nil, expr.Expression), expr.Test.Args)
+	return AppendKwargs(children, expr.Test.Kwargs)
+}
+func (expr *TestExpression) ReplaceChildren(fn func(Node) Node) {
+	expr.Expression = ReplaceExpression(expr.Expression, fn)
+	ReplaceExpressions(expr.Test.Args, fn)
+	ReplaceKwargs(expr.Test.Kwargs, fn)
+}
+
+func (s *String) Children() []Node                   { return nil }
+func (s *String) ReplaceChildren(fn func(Node) Node) {}
+
+func (i *Integer) Children() []Node                   { return nil }
+func (i *Integer) ReplaceChildren(fn func(Node) Node) {}
+
+func (f *Float) Children() []Node                   { return nil }
+func (f *Float) ReplaceChildren(fn func(Node) Node) {}
+
+func (b *Bool) Children() []Node                   { return nil }
+func (b *Bool) ReplaceChildren(fn func(Node) Node) {}
+
+func (n *Name) Children() []Node                   { return nil }
+func (n *Name) ReplaceChildren(fn func(Node) Node) {}
+
+func (n *None) Children() []Node                   { return nil }
+func (n *None) ReplaceChildren(fn func(Node) Node) {}
+
+func (l *List) Children() []Node                   { return AppendExpressions(nil, l.Val) }
+func (l *List) ReplaceChildren(fn func(Node) Node) { ReplaceExpressions(l.Val, fn) }
+
+func (t *Tuple) Children() []Node                   { return AppendExpressions(nil, t.Val) }
+func (t *Tuple) ReplaceChildren(fn func(Node) Node) { ReplaceExpressions(t.Val, fn) }
+
+func (d *Dict) Children() []Node {
+	children := []Node{}
+	for _, pair := range d.Pairs {
+		children = AppendChildren(children, pair)
+	}
+	return children
+}
+func (d *Dict) ReplaceChildren(fn func(Node) Node) {
+	for idx, pair := range d.Pairs {
+		d.Pairs[idx] = ReplacePair(pair, fn)
+	}
+}
+
+func (p *Pair) Children() []Node { return AppendChildren(nil, p.Key, p.Value) }
+func (p *Pair) ReplaceChildren(fn func(Node) Node) {
+	p.Key = ReplaceExpression(p.Key, fn)
+	p.Value = ReplaceExpression(p.Value, fn)
+}
+
+func (v *Variable) Children() []Node {
+	children := []Node{}
+	for _, part := range v.Parts {
+		children = AppendKwargs(AppendExpressions(children, part.Args), part.Kwargs)
+	}
+	return children
+}
+func (v *Variable) ReplaceChildren(fn func(Node) Node) {
+	for _, part := range v.Parts {
+		ReplaceExpressions(part.Args, fn)
+		ReplaceKwargs(part.Kwargs, fn)
+	}
+}
+
+func (c *Call) Children() []Node {
+	return AppendKwargs(AppendExpressions(AppendChildren(nil, c.Func), c.Args), c.Kwargs)
+}
+func (c *Call) ReplaceChildren(fn func(Node) Node) {
+	c.Func = ReplaceExpression(c.Func, fn)
+	ReplaceExpressions(c.Args, fn)
+	ReplaceKwargs(c.Kwargs, fn)
+}
+
+func (g *Getitem) Children() []Node { return AppendChildren(nil, g.Node, g.Arg) }
+func (g *Getitem) ReplaceChildren(fn func(Node) Node) {
+	g.Node = ReplaceExpression(g.Node, fn)
+	g.Arg = ReplaceExpression(g.Arg, fn)
+}
+
+func (s *Slice) Children() []Node { return AppendChildren(nil, s.Start, s.Stop, s.Step) }
+func (s *Slice) ReplaceChildren(fn func(Node) Node) {
+	s.Start = ReplaceExpression(s.Start, fn)
+	s.Stop = ReplaceExpression(s.Stop, fn)
+	s.Step = ReplaceExpression(s.Step, fn)
+}
+
+func (g *Getattr) Children() []Node { return AppendChildren(nil, g.Node) }
+func (g *Getattr) ReplaceChildren(fn func(Node) Node) {
+	g.Node = ReplaceExpression(g.Node, fn)
+}
+
+func (n *Negation) Children() []Node { return AppendChildren(nil, n.Term) }
+func (n *Negation) ReplaceChildren(fn func(Node) Node) {
+	n.Term = ReplaceExpression(n.Term, fn)
+}
+
+func (u *UnaryExpression) Children() []Node { return AppendChildren(nil, u.Term) }
+func (u *UnaryExpression) ReplaceChildren(fn func(Node) Node) {
+	u.Term = ReplaceExpression(u.Term, fn)
+}
+
+func (b *BinaryExpression) Children() []Node { return AppendChildren(nil, b.Left, b.Right) }
+func (b *BinaryExpression) ReplaceChildren(fn func(Node) Node) {
+	b.Left = ReplaceExpression(b.Left, fn)
+	b.Right = ReplaceExpression(b.Right, fn)
+}
+
+func (c *Conditional) Children() []Node {
+	return AppendChildren(nil, c.Expression, c.Condition, c.Alternative)
+}
+func (c *Conditional) ReplaceChildren(fn func(Node) Node) {
+	c.Expression = ReplaceExpression(c.Expression, fn)
+	c.Condition = ReplaceExpression(c.Condition, fn)
+	c.Alternative = ReplaceExpression(c.Alternative, fn)
+}
+
+func (s *StatementBlock) Children() []Node { return AppendChildren(nil, s.Stmt) }
+func (s *StatementBlock) ReplaceChildren(fn func(Node) Node) {
+	if s.Stmt != nil {
+		s.Stmt = fn(s.Stmt)
+	}
+}
+
+func (w *Wrapper) Children() []Node { return AppendChildren(nil, w.Nodes...) }
+func (w *Wrapper) ReplaceChildren(fn func(Node) Node) {
+	for idx, node := range w.Nodes {
+		w.Nodes[idx] = fn(node)
+	}
+}
+
+func (m *Macro) Children() []Node {
+	children := []Node{}
+	for _, kwarg := range m.Kwargs {
+		children = AppendChildren(children, kwarg)
+	}
+	return AppendChildren(children, m.Wrapper)
+}
+func (m *Macro) ReplaceChildren(fn func(Node) Node) {
+	for idx, kwarg := range m.Kwargs {
+		m.Kwargs[idx] = ReplacePair(kwarg, fn)
+	}
+	m.Wrapper = ReplaceWrapper(m.Wrapper, fn)
+}
+
+func (c *Error) Children() []Node                   { return nil }
+func (c *Error) ReplaceChildren(fn func(Node) Node) {}
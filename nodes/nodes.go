@@ -45,6 +45,7 @@ type Statement interface {
 // Template is the root node of any template
 type Template struct {
 	Name   string
+	Source string
 	Nodes  []Node
 	Blocks BlockSet
 	Macros map[string]*Macro
@@ -101,21 +102,13 @@ func (c *Comment) String() string {
 
 // Ouput represents a printable expression node {{ }}
 type Output struct {
-	Start       *tokens.Token
-	Expression  Expression
-	Condition   Expression
-	Alternative Expression
-	End         *tokens.Token
+	Start      *tokens.Token
+	Expression Expression
+	End        *tokens.Token
 }
 
 func (o *Output) Position() *tokens.Token { return o.Start }
 func (o *Output) String() string {
-	if o.Alternative != nil {
-		return fmt.Sprintf("output(%s if %s else %s)", o.Expression, o.Condition, o.Alternative)
-	}
-	if o.Condition != nil {
-		return fmt.Sprintf("output(%s if %s)", o.Expression, o.Condition)
-	}
 	return fmt.Sprintf("output(%s)", o.Expression)
 }
 
@@ -293,6 +286,7 @@ type Call struct {
 	Func     Node
 	Args     []Expression
 	Kwargs   map[string]Expression
+	Keywords map[string]*tokens.Token // Tokens of the keyword argument names
 }
 
 func (c *Call) Position() *tokens.Token { return c.Location }
@@ -311,6 +305,28 @@ func (g *Getitem) String() string {
 	return fmt.Sprintf("%s[%s]", g.Node, g.Arg)
 }
 
+// Slice is a `start:stop:step` subscript, any of its parts may be nil
+type Slice struct {
+	Location *tokens.Token
+	Start    Expression
+	Stop     Expression
+	Step     Expression
+}
+
+func (s *Slice) Position() *tokens.Token { return s.Location }
+func (s *Slice) String() string {
+	parts := make([]string, 3)
+	for idx, expr := range []Expression{s.Start, s.Stop, s.Step} {
+		if expr != nil {
+			parts[idx] = expr.String()
+		}
+	}
+	if s.Step == nil {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, ":")
+}
+
 type Getattr struct {
 	Location *tokens.Token
 	Node     Node
@@ -363,6 +379,23 @@ func (expr *BinaryExpression) String() string {
 	return fmt.Sprintf("%s %s %s", expr.Left, expr.Operator.Token.Val, expr.Right)
 }
 
+// Conditional is the `expression if condition else alternative` expression.
+// Alternative is nil when there is no else clause.
+type Conditional struct {
+	Location    *tokens.Token
+	Expression  Expression
+	Condition   Expression
+	Alternative Expression
+}
+
+func (c *Conditional) Position() *tokens.Token { return c.Expression.Position() }
+func (c *Conditional) String() string {
+	if c.Alternative != nil {
+		return fmt.Sprintf("%s if %s else %s", c.Expression, c.Condition, c.Alternative)
+	}
+	return fmt.Sprintf("%s if %s", c.Expression, c.Condition)
+}
+
 type BinOperator struct {
 	Token *tokens.Token
 }
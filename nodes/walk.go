@@ -1,13 +1,14 @@
 package nodes
 
-import (
-	"github.com/pkg/errors"
-)
-
 type Visitor interface {
 	Visit(node Node) (Visitor, error)
 }
 
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor w
+// for each of the children of node. Nodes which don't implement Parent
+// have no children.
 func Walk(v Visitor, node Node) error {
 	v, err := v.Visit(node)
 	if err != nil {
@@ -17,21 +18,12 @@ func Walk(v Visitor, node Node) error {
 		return nil
 	}
 
-	switch n := node.(type) {
-	case *Template:
-		for _, node := range n.Nodes {
-			if err := Walk(v, node); err != nil {
-				return err
-			}
-		}
-	case *Wrapper:
-		for _, node := range n.Nodes {
-			if err := Walk(v, node); err != nil {
+	if parent, ok := node.(Parent); ok {
+		for _, child := range parent.Children() {
+			if err := Walk(v, child); err != nil {
 				return err
 			}
 		}
-	default:
-		return errors.Errorf("Unkown type %T", n)
 	}
 	return nil
 }
@@ -47,8 +39,19 @@ func (f Inspector) Visit(node Node) (Visitor, error) {
 
 // Inspect traverses an AST in depth-first order: It starts by calling
 // f(node); node must not be nil. If f returns true, Inspect invokes f
-// recursively for each of the non-nil children of node, followed by a
-// call of f(nil).
+// recursively for each of the non-nil children of node.
 func Inspect(node Node, f func(Node) bool) {
 	Walk(Inspector(f), node)
 }
+
+// Rewrite traverses an AST in depth-first order, rewriting the children of
+// a node before the node itself: every node is replaced by fn(node). It
+// returns the rewritten root. fn may return its argument to keep a node.
+func Rewrite(node Node, fn func(Node) Node) Node {
+	if parent, ok := node.(Parent); ok {
+		parent.ReplaceChildren(func(child Node) Node {
+			return Rewrite(child, fn)
+		})
+	}
+	return fn(node)
+}
@@ -0,0 +1,82 @@
+package nodes_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja"
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+var inspectCases = []struct {
+	name   string
+	source string
+	names  []string
+}{
+	{"output", `{{ a + b.c | default(d) }}{{ e is divisibleby(f) }}`, []string{"a", "b", "d", "e", "f"}},
+	{"expressions", `{{ [a, (b, c), {d: e}][f:g] if h else i(j, k=l) }}`, []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "l"}},
+	{"if", `{% if a %}{{ b }}{% elif c %}{{ d }}{% else %}{{ e }}{% endif %}`, []string{"a", "b", "c", "d", "e"}},
+	{"for", `{% for x in a if b %}{{ c }}{% else %}{{ d }}{% endfor %}`, []string{"a", "b", "c", "d"}},
+	{"set and with", `{% set a = b %}{% with c = d %}{{ e }}{% endwith %}`, []string{"a", "b", "d", "e"}},
+	{"macro", `{% macro m(x=a) %}{{ b }}{% endmacro %}`, []string{"a", "b"}},
+	{"filter and autoescape", `{% filter replace(a, "b") %}{% autoescape true %}{{ c }}{% endautoescape %}{% endfilter %}`, []string{"a", "c"}},
+	{"block and include", `{% block content %}{{ a }}{% endblock %}{% include b ignore missing %}`, []string{"a", "b"}},
+}
+
+func TestInspect(t *testing.T) {
+	for _, tc := range inspectCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			tpl, err := gonja.FromString(test.source)
+			if !assert.NoError(err) {
+				return
+			}
+			names := []string{}
+			nodes.Inspect(tpl.Root, func(node nodes.Node) bool {
+				if name, ok := node.(*nodes.Name); ok {
+					names = append(names, name.Name.Val)
+				}
+				return true
+			})
+			assert.Equal(test.names, names)
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	assert := assert.New(t)
+	tpl, err := gonja.FromString(`{% for x in items %}{{ name }}{% endfor %}{% block b %}{{ name | upper }}{% endblock %}`)
+	if !assert.NoError(err) {
+		return
+	}
+	nodes.Rewrite(tpl.Root, func(node nodes.Node) nodes.Node {
+		if name, ok := node.(*nodes.Name); ok && name.Name.Val == "name" {
+			return &nodes.String{
+				Location: &tokens.Token{Type: tokens.String, Val: "gonja"},
+				Val:      "gonja",
+			}
+		}
+		return node
+	})
+	out, err := tpl.Execute(map[string]any{"items": []int{1, 2}, "name": "world"})
+	assert.NoError(err)
+	assert.Equal("gonjagonjaGONJA", out)
+}
+
+func TestRewriteWrongType(t *testing.T) {
+	tpl, err := gonja.FromString(`{% if a %}b{% endif %}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Panics(t, func() {
+		nodes.Rewrite(tpl.Root, func(node nodes.Node) nodes.Node {
+			if _, ok := node.(*nodes.Wrapper); ok {
+				return &nodes.None{}
+			}
+			return node
+		})
+	})
+}
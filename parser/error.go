@@ -2,20 +2,177 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
-	"github.com/MarioJim/gonja/tokens"
 	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/tokens"
 )
 
+// TemplateError is an error located in a template. Parser and renderer
+// errors hold one, use errors.As to retrieve it.
+type TemplateError struct {
+	Template string // Name of the template
+	Line     int    // Line number, starting at 1, or 0 if unknown
+	Col      int    // Column number, starting at 1
+	Source   string // Source line holding the error
+	Message  string
+	Err      error // Underlying error, if any
+
+	// Frames are the includes, extends and macro calls which led to the
+	// error, innermost first
+	Frames []*Frame
+}
+
+// Frame locates an include, extends, import or macro call
+type Frame struct {
+	Kind     string // "include", "extends", "import" or "macro"
+	Name     string // Name of the loaded template or of the called macro
+	Template string // Name of the template holding the statement or the call
+	Line     int
+	Col      int
+}
+
+func (f *Frame) String() string {
+	return fmt.Sprintf("%s '%s' at %s", f.Kind, f.Name, position(f.Template, f.Line, f.Col))
+}
+
+// NewTemplateError creates an error located at token in the template
+// named name. The token is optional.
+func NewTemplateError(name, source string, token *tokens.Token, msg string, err error) *TemplateError {
+	terr := &TemplateError{
+		Template: name,
+		Message:  msg,
+		Err:      err,
+	}
+	if token != nil && token.Line > 0 {
+		terr.Line = token.Line
+		terr.Col = token.Col
+		terr.Source = sourceLine(source, token.Line)
+	}
+	return terr
+}
+
+// AsTemplateError returns the TemplateError held by err, if any
+func AsTemplateError(err error) (*TemplateError, bool) {
+	var terr *TemplateError
+	if errors.As(err, &terr) {
+		return terr, true
+	}
+	return nil, false
+}
+
+func (e *TemplateError) Error() string {
+	var b strings.Builder
+	b.WriteString(position(e.Template, e.Line, e.Col))
+	b.WriteString(": ")
+	b.WriteString(e.Message)
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	for _, frame := range e.Frames {
+		b.WriteString(", from ")
+		b.WriteString(frame.String())
+	}
+	return b.String()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet returns the source line holding the error followed by a line
+// with a caret under the column
+func (e *TemplateError) Snippet() string {
+	if e.Source == "" {
+		return ""
+	}
+	var caret strings.Builder
+	for idx, char := range e.Source {
+		if idx >= e.Col-1 {
+			break
+		}
+		if char == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return fmt.Sprintf("%s\n%s", e.Source, caret.String())
+}
+
+// AddFrame appends a frame, its location being unknown if token is nil
+func (e *TemplateError) AddFrame(kind, name, template string, token *tokens.Token) {
+	frame := &Frame{Kind: kind, Name: name, Template: template}
+	if token != nil {
+		frame.Line = token.Line
+		frame.Col = token.Col
+	}
+	e.Frames = append(e.Frames, frame)
+}
+
+func position(name string, line, col int) string {
+	if line <= 0 {
+		return name
+	}
+	return fmt.Sprintf("%s:%d:%d", name, line, col)
+}
+
+// sourceLine returns the line of the source, starting at 1
+func sourceLine(source string, line int) string {
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line-1], "\r")
+}
+
 // Error produces a nice error message and returns an error-object.
-// The 'token'-argument is optional. If provided, it will take
-// the token's position information. If not provided, it will
-// automatically use the CURRENT token's position information.
+// The 'token'-argument is optional. If not provided, the error is located
+// at the statement whose arguments are being parsed, if any. Lexing errors
+// take precedence over msg.
 func (p *Parser) Error(msg string, token *tokens.Token) error {
-	if token == nil {
-		return errors.New(msg)
-	} else {
-		return fmt.Errorf("%s, line: %d, col: %d, near: %q, token: %q", msg,
-			token.Line, token.Col, token.Val, token)
+	if token != nil && token.Type == tokens.Error {
+		msg = token.Val
+	}
+	return NewTemplateError(p.templateName(), p.Source, p.locate(token), msg, nil)
+}
+
+// Wrap returns err located at token. An error already located in this or
+// another template is returned unchanged.
+func (p *Parser) Wrap(err error, msg string, token *tokens.Token) error {
+	if terr, ok := AsTemplateError(err); ok {
+		return terr
+	}
+	return NewTemplateError(p.templateName(), p.Source, p.locate(token), msg, err)
+}
+
+// LoadError returns the error of loading the template name for the include,
+// extends or import statement located at token, or at the statement whose
+// arguments are parsed if token is nil. Errors from the loaded template get
+// a frame for this statement.
+func (p *Parser) LoadError(err error, kind, name string, token *tokens.Token) error {
+	if terr, ok := AsTemplateError(err); ok {
+		terr.AddFrame(kind, name, p.templateName(), p.locate(token))
+		return terr
+	}
+	return p.Wrap(err, fmt.Sprintf("Unable to load template '%s'", name), token)
+}
+
+// locate returns token, or the statement whose arguments are parsed if the
+// token has no position
+func (p *Parser) locate(token *tokens.Token) *tokens.Token {
+	if token == nil || token.Line == 0 {
+		return p.location
+	}
+	return token
+}
+
+func (p *Parser) templateName() string {
+	if p.Template != nil {
+		return p.Template.Name
 	}
+	return p.Name
 }
@@ -36,11 +36,38 @@ func (p *Parser) ParseFilterExpression(expr nodes.Expression) (nodes.Expression,
 }
 
 // ParseExpression parses an expression with optional filters
+// and an optional trailing conditional
 // Nested expression should call this method
 func (p *Parser) ParseExpression() (nodes.Expression, error) {
 	log.WithFields(log.Fields{
 		"current": p.Current(),
 	}).Trace("ParseExpression")
+
+	expr, err := p.ParseSimpleExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if expr != nil && p.CurrentName("if") != nil {
+		expr, err = p.parseConditional(expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"expr": expr,
+	}).Trace("ParseExpression return")
+	return expr, nil
+}
+
+// ParseSimpleExpression parses an expression with optional filters
+// but without conditional. Statements giving their own meaning
+// to a trailing 'if' (like 'for') should call this method
+func (p *Parser) ParseSimpleExpression() (nodes.Expression, error) {
+	log.WithFields(log.Fields{
+		"current": p.Current(),
+	}).Trace("ParseSimpleExpression")
 	var expr nodes.Expression
 
 	expr, err := p.ParseLogicalExpression()
@@ -55,10 +82,48 @@ func (p *Parser) ParseExpression() (nodes.Expression, error) {
 
 	log.WithFields(log.Fields{
 		"expr": expr,
-	}).Trace("ParseExpression return")
+	}).Trace("ParseSimpleExpression return")
 	return expr, nil
 }
 
+// parseConditional parses the `if condition else alternative` part
+// of a conditional expression
+func (p *Parser) parseConditional(expr nodes.Expression) (nodes.Expression, error) {
+	log.WithFields(log.Fields{
+		"current": p.Current(),
+	}).Trace("parseConditional")
+
+	cond := &nodes.Conditional{
+		Location:   p.MatchName("if"),
+		Expression: expr,
+	}
+
+	condition, err := p.ParseSimpleExpression()
+	if err != nil {
+		return nil, err
+	}
+	if condition == nil {
+		return nil, p.Error("Expected a condition", p.Current())
+	}
+	cond.Condition = condition
+
+	if p.MatchName("else") != nil {
+		alternative, err := p.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if alternative == nil {
+			return nil, p.Error("Expected an expression after 'else'", p.Current())
+		}
+		cond.Alternative = alternative
+	}
+
+	log.WithFields(log.Fields{
+		"expr": cond,
+	}).Trace("parseConditional return")
+	return cond, nil
+}
+
 func (p *Parser) ParseExpressionNode() (nodes.Node, error) {
 	log.WithFields(log.Fields{
 		"current": p.Current(),
@@ -82,25 +147,6 @@ func (p *Parser) ParseExpressionNode() (nodes.Node, error) {
 	}
 	node.Expression = expr
 
-	if p.MatchName("if") != nil {
-		condition, err := p.ParseExpression()
-		if err != nil {
-			return nil, err
-		}
-		if condition == nil {
-			return nil, p.Error("Expected a condition", p.Current())
-		}
-		node.Condition = condition
-
-		if p.MatchName("else") != nil {
-			alternative, err := p.ParseExpression()
-			if err != nil {
-				return nil, err
-			}
-			node.Alternative = alternative
-		}
-	}
-
 	tok = p.Match(tokens.VariableEnd)
 	if tok == nil {
 		return nil, p.Error("'}}' expected here", p.Current())
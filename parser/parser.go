@@ -20,6 +20,7 @@ import (
 // (See Token's documentation for more about tokens)
 type Parser struct {
 	Name   string
+	Source string // Template source, used to locate errors
 	Stream *tokens.Stream
 	Config *config.Config
 
@@ -27,6 +28,13 @@ type Parser struct {
 	Statements     map[string]StatementParser
 	Level          int8
 	TemplateParser TemplateParser
+
+	location *tokens.Token // Statement whose arguments are parsed, if any
+
+	// Error recovery state, see ParseRecovering
+	recovering bool
+	errors     []*TemplateError
+	failed     []string // Statements which failed to parse
 }
 
 // Creates a new parser to parse tokens.
@@ -43,9 +51,34 @@ func NewParser(name string, cfg *config.Config, stream *tokens.Stream) *Parser {
 func Parse(input string) (*nodes.Template, error) {
 	stream := tokens.Lex(input)
 	p := NewParser("parser", config.DefaultConfig, stream)
+	p.Source = input
 	return p.Parse()
 }
 
+// ParseExpression parses a standalone expression, as found between variable
+// delimiters, failing if it is followed by anything else
+func ParseExpression(name, source string, cfg *config.Config) (nodes.Expression, error) {
+	p := NewParser(name, cfg, tokens.LexExpression(source, cfg))
+	p.Source = source
+	expr, err := p.ParseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.Stream.EOF() {
+		return nil, p.Error("Unexpected token after the expression", p.Current())
+	}
+	return expr, nil
+}
+
+// argsParser creates a parser for the arguments of the statement at location
+func (p *Parser) argsParser(name string, location *tokens.Token, args []*tokens.Token) *Parser {
+	sub := NewParser(name, p.Config, tokens.NewStream(args))
+	sub.Source = p.Source
+	sub.Template = p.Template
+	sub.location = location
+	return sub
+}
+
 func (p *Parser) Parse() (*nodes.Template, error) {
 	return p.ParseTemplate()
 }
@@ -160,8 +193,7 @@ func (p *Parser) WrapUntil(names ...string) (*nodes.Wrapper, *Parser, error) {
 						if data := p.Current(tokens.Data); data != nil {
 							data.Trim = data.Trim || len(end.Val) > 0 && end.Val[0] == '-'
 						}
-						stream := tokens.NewStream(args)
-						return wrapper, NewParser(p.Name, p.Config, stream), nil
+						return wrapper, p.argsParser(p.Name, begin, args), nil
 					}
 					if p.End() || p.Current(tokens.EOF) != nil {
 						return nil, nil, p.Error("Unexpected EOF.", p.Current())
@@ -177,7 +209,9 @@ func (p *Parser) WrapUntil(names ...string) (*nodes.Wrapper, *Parser, error) {
 		if err != nil {
 			return nil, nil, err
 		}
-		wrapper.Nodes = append(wrapper.Nodes, node)
+		if node != nil {
+			wrapper.Nodes = append(wrapper.Nodes, node)
+		}
 	}
 
 	return nil, nil, p.Error(fmt.Sprintf("Unexpected EOF, expected tag %s.", strings.Join(names, " or ")),
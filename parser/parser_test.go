@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/MarioJim/gonja/config"
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/parser"
 	"github.com/MarioJim/gonja/tokens"
@@ -358,6 +359,39 @@ var testCases = []struct {
 			"Arg": _literal(nodes.String{}, "item"),
 		}},
 	}}},
+	{"variable slice", "{{ a_var[1:-1] }}", specs{nodes.Output{}, attrs{
+		"Expression": specs{nodes.Getitem{}, attrs{
+			"Node": specs{nodes.Name{}, attrs{
+				"Name": _token("a_var"),
+			}},
+			"Arg": specs{nodes.Slice{}, attrs{
+				"Start": _literal(nodes.Integer{}, int64(1)),
+				"Stop": specs{nodes.UnaryExpression{}, attrs{
+					"Negative": val{true},
+					"Term":     _literal(nodes.Integer{}, int64(1)),
+				}},
+			}},
+		}},
+	}}},
+	{"variable slice with step", "{{ a_var[::2] }}", specs{nodes.Output{}, attrs{
+		"Expression": specs{nodes.Getitem{}, attrs{
+			"Node": specs{nodes.Name{}, attrs{
+				"Name": _token("a_var"),
+			}},
+			"Arg": specs{nodes.Slice{}, attrs{
+				"Step": _literal(nodes.Integer{}, int64(2)),
+			}},
+		}},
+	}}},
+	{"method call on literal", "{{ '-'.join(a_var) }}", specs{nodes.Output{}, attrs{
+		"Expression": specs{nodes.Call{}, attrs{
+			"Func": specs{nodes.Getattr{}, attrs{
+				"Node": _literal(nodes.String{}, "-"),
+				"Attr": val{"join"},
+			}},
+			"Args": slice{specs{nodes.Name{}, attrs{"Name": _token("a_var")}}},
+		}},
+	}}},
 	{"variable and filter", "{{ a_var|safe }}", specs{nodes.Output{}, attrs{
 		"Expression": specs{nodes.FilteredExpression{}, attrs{
 			"Expression": specs{nodes.Name{}, attrs{
@@ -546,23 +580,50 @@ var testCases = []struct {
 		}},
 	}}},
 	{"inlined if condition", "{{ 'foo' if 2 is odd }}", specs{nodes.Output{}, attrs{
-		"Expression": _literal(nodes.String{}, "foo"),
-		"Condition": specs{nodes.TestExpression{}, attrs{
-			"Expression": _literal(nodes.Integer{}, int64(2)),
-			"Test": specs{nodes.TestCall{}, attrs{
-				"Name": val{"odd"},
+		"Expression": specs{nodes.Conditional{}, attrs{
+			"Expression": _literal(nodes.String{}, "foo"),
+			"Condition": specs{nodes.TestExpression{}, attrs{
+				"Expression": _literal(nodes.Integer{}, int64(2)),
+				"Test": specs{nodes.TestCall{}, attrs{
+					"Name": val{"odd"},
+				}},
 			}},
 		}},
 	}}},
 	{"inlined if else condition", "{{ 'foo' if 2 is odd else 'bar' }}", specs{nodes.Output{}, attrs{
-		"Expression": _literal(nodes.String{}, "foo"),
-		"Condition": specs{nodes.TestExpression{}, attrs{
-			"Expression": _literal(nodes.Integer{}, int64(2)),
-			"Test": specs{nodes.TestCall{}, attrs{
-				"Name": val{"odd"},
+		"Expression": specs{nodes.Conditional{}, attrs{
+			"Expression": _literal(nodes.String{}, "foo"),
+			"Condition": specs{nodes.TestExpression{}, attrs{
+				"Expression": _literal(nodes.Integer{}, int64(2)),
+				"Test": specs{nodes.TestCall{}, attrs{
+					"Name": val{"odd"},
+				}},
+			}},
+			"Alternative": _literal(nodes.String{}, "bar"),
+		}},
+	}}},
+	{"chained if else condition", "{{ 'foo' if a else 'bar' if b else 'baz' }}", specs{nodes.Output{}, attrs{
+		"Expression": specs{nodes.Conditional{}, attrs{
+			"Expression": _literal(nodes.String{}, "foo"),
+			"Condition":  specs{nodes.Name{}, attrs{"Name": _token("a")}},
+			"Alternative": specs{nodes.Conditional{}, attrs{
+				"Expression":  _literal(nodes.String{}, "bar"),
+				"Condition":   specs{nodes.Name{}, attrs{"Name": _token("b")}},
+				"Alternative": _literal(nodes.String{}, "baz"),
 			}},
 		}},
-		"Alternative": _literal(nodes.String{}, "bar"),
+	}}},
+	{"if condition in list", "{{ [1 if a else 2, 3] }}", specs{nodes.Output{}, attrs{
+		"Expression": specs{nodes.List{}, attrs{
+			"Val": slice{
+				specs{nodes.Conditional{}, attrs{
+					"Expression":  _literal(nodes.Integer{}, int64(1)),
+					"Condition":   specs{nodes.Name{}, attrs{"Name": _token("a")}},
+					"Alternative": _literal(nodes.Integer{}, int64(2)),
+				}},
+				_literal(nodes.Integer{}, int64(3)),
+			},
+		}},
 	}}},
 }
 
@@ -717,3 +778,31 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+var parseExpressionCases = []struct {
+	name   string
+	source string
+	err    string
+}{
+	{"literal", `[1, 'a', {'b': none}]`, ""},
+	{"filtered", `items | map('int') | list`, ""},
+	{"conditional", `a if b else c`, ""},
+	{"empty", ``, "Expected either a number, string, keyword or identifier."},
+	{"unterminated", `(1 + 2`, "Unbalanced parenthesis"},
+	{"trailing tokens", `1 2`, "Unexpected token after the expression"},
+}
+
+func TestParseExpression(t *testing.T) {
+	for _, tc := range parseExpressionCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := parser.ParseExpression("expression", test.source, config.DefaultConfig)
+			if test.err == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, expr)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.err)
+			}
+		})
+	}
+}
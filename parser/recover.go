@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/tokens"
+)
+
+// errOrphanTag is returned for the end tag of a statement which failed to parse
+var errOrphanTag = errors.New("orphan tag")
+
+// ParseRecovering parses the template without stopping at the first syntax
+// error. The Source is lexed again, lexing errors are reported and skipped.
+// An element failing to parse is replaced by a nodes.Error and parsing
+// resumes at the next tag boundary. It returns the partial template along
+// with every error, in source order.
+func (p *Parser) ParseRecovering() (*nodes.Template, []*TemplateError) {
+	stream, lexErrors := tokens.LexRecovering(p.Source, p.Config)
+	p.Stream = stream
+	p.recovering = true
+	p.errors = []*TemplateError{}
+	p.failed = []string{}
+	defer func() {
+		p.recovering = false
+	}()
+
+	tpl, err := p.ParseTemplate()
+	if err != nil {
+		p.errors = append(p.errors, p.locatedError(err, nil))
+	}
+
+	errs := []*TemplateError{}
+	for _, tok := range lexErrors {
+		errs = append(errs, p.locatedError(p.Error(tok.Val, tok), nil))
+	}
+	for _, terr := range p.errors {
+		// The parser fails where the lexer stopped
+		if !atLexError(terr, lexErrors) {
+			errs = append(errs, terr)
+		}
+	}
+	sortErrors(errs)
+	return tpl, errs
+}
+
+// locatedError returns the TemplateError held by err, or err located at token
+func (p *Parser) locatedError(err error, token *tokens.Token) *TemplateError {
+	if terr, ok := AsTemplateError(err); ok {
+		return terr
+	}
+	return NewTemplateError(p.templateName(), p.Source, p.locate(token), err.Error(), nil)
+}
+
+func atLexError(terr *TemplateError, lexErrors []*tokens.Token) bool {
+	for _, tok := range lexErrors {
+		if tok.Line == terr.Line && tok.Col == terr.Col {
+			return true
+		}
+	}
+	return false
+}
+
+func sortErrors(errs []*TemplateError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Col < errs[j].Col
+	})
+}
+
+// resync records err and skips the tokens of the element which started at
+// start, up to the next tag boundary. It returns the node replacing the
+// element, if any.
+func (p *Parser) resync(start *tokens.Token, err error) nodes.Node {
+	var node nodes.Node
+	if err != errOrphanTag {
+		p.errors = append(p.errors, p.locatedError(err, start))
+		node = &nodes.Error{Location: start, Error: err}
+	}
+	for !p.End() {
+		tok := p.Current()
+		switch tok.Type {
+		case tokens.VariableEnd, tokens.BlockEnd, tokens.CommentEnd:
+			p.Consume()
+			return node
+		case tokens.Data, tokens.VariableBegin, tokens.BlockBegin, tokens.CommentBegin:
+			if tok != start {
+				return node
+			}
+		}
+		p.Consume()
+	}
+	return node
+}
+
+// orphanTag returns true if the statement name closes or continues a
+// statement which failed to parse, so that it doesn't report another error
+func (p *Parser) orphanTag(name string) bool {
+	if !p.recovering || len(p.failed) == 0 {
+		return false
+	}
+	last := len(p.failed) - 1
+	switch {
+	case name == "end"+p.failed[last]:
+		p.failed = p.failed[:last]
+		return true
+	case name == "else" || name == "elif":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/MarioJim/gonja/builtins"
+	"github.com/MarioJim/gonja/config"
+	"github.com/MarioJim/gonja/nodes"
+	"github.com/MarioJim/gonja/parser"
+)
+
+var recoverCases = []struct {
+	name   string
+	source string
+	errors []string
+	names  []string // Names still held by the partial template
+	nodes  int      // Error nodes in the partial template
+}{
+	{"valid", "{{ a }}{% if b %}{{ c }}{% endif %}", []string{}, []string{"a", "b", "c"}, 0},
+	{"several errors", "{{ a ) }}\n{% for %}x{% endfor %}\n{% if b %}{{ c | }}{% else %}{{ d }}{% endif %}{% foo %}{{ e }}", []string{
+		`tpl:1:6: Unexpected delimiter ")"`,
+		`tpl:2:4: Expected an key identifier as first argument for 'for'-tag`,
+		`tpl:3:18: Filter name must be an identifier.`,
+		`tpl:3:51: Statement 'foo' not found (or beginning not provided)`,
+	}, []string{"a", "b", "d", "e"}, 3},
+	{"orphan tags of failed statements", "{% if a %}{% for x in %}{{ x }}{% else %}y{% endfor %}{% endif %}{{ z }}", []string{
+		`tpl:1:14: Expected either a number, string, keyword or identifier.`,
+	}, []string{"a", "x", "z"}, 1},
+	{"unclosed comment", "{{ a }}{# b", []string{
+		`tpl:1:10: unclosed comment`,
+	}, []string{"a"}, 1},
+	{"unexpected EOF", "{{ a }}{% if b %}{{ c }}", []string{
+		`tpl:1:25: Unexpected EOF, expected tag elif or else or endif.`,
+	}, []string{"a"}, 1},
+}
+
+func TestParseRecovering(t *testing.T) {
+	for _, tc := range recoverCases {
+		test := tc
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			p := parser.NewParser("tpl", config.DefaultConfig, nil)
+			p.Source = test.source
+			p.Statements = builtins.Statements
+			tpl, errs := p.ParseRecovering()
+
+			messages := []string{}
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			assert.Equal(test.errors, messages)
+
+			names := []string{}
+			errorNodes := 0
+			nodes.Inspect(tpl, func(node nodes.Node) bool {
+				switch n := node.(type) {
+				case *nodes.Name:
+					names = append(names, n.Name.Val)
+				case *nodes.Error:
+					errorNodes++
+				}
+				return true
+			})
+			assert.Equal(test.names, names)
+			assert.Equal(test.nodes, errorNodes)
+		})
+	}
+}
@@ -5,8 +5,6 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/pkg/errors"
-
 	"github.com/MarioJim/gonja/nodes"
 	"github.com/MarioJim/gonja/tokens"
 )
@@ -20,7 +18,7 @@ func (p *Parser) ParseStatementBlock() (*nodes.StatementBlock, error) {
 
 	begin := p.Match(tokens.BlockBegin)
 	if begin == nil {
-		return nil, errors.Errorf(`Expected "%s" got "%s"`, p.Config.BlockStartString, p.Current())
+		return nil, p.Error(fmt.Sprintf(`Expected "%s" got "%s"`, p.Config.BlockStartString, p.Current()), p.Current())
 	}
 
 	name := p.Match(tokens.Name)
@@ -30,6 +28,9 @@ func (p *Parser) ParseStatementBlock() (*nodes.StatementBlock, error) {
 
 	stmtParser, exists := p.Statements[name.Val]
 	if !exists {
+		if p.orphanTag(name.Val) {
+			return nil, errOrphanTag
+		}
 		return nil, p.Error(fmt.Sprintf("Statement '%s' not found (or beginning not provided)", name.Val), name)
 	}
 
@@ -53,16 +54,15 @@ func (p *Parser) ParseStatementBlock() (*nodes.StatementBlock, error) {
 		"args": args,
 	}).Trace("Matched end block")
 
-	stream := tokens.NewStream(args)
-	log.WithFields(log.Fields{
-		"stream": stream,
-	}).Trace("Got stream")
-	argParser := NewParser(fmt.Sprintf("%s:args", name.Val), p.Config, stream)
+	argParser := p.argsParser(fmt.Sprintf("%s:args", name.Val), name, args)
 	log.Trace("argparser")
 
 	stmt, err := stmtParser(p, argParser)
 	if err != nil {
-		return nil, errors.Wrapf(err, `Unable to parse statement "%s"`, name.Val)
+		if p.recovering {
+			p.failed = append(p.failed, name.Val)
+		}
+		return nil, p.Wrap(err, fmt.Sprintf(`Unable to parse statement "%s"`, name.Val), name)
 	}
 	log.Trace("got stmt and return")
 	return &nodes.StatementBlock{
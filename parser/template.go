@@ -8,6 +8,15 @@ import (
 type TemplateParser func(string) (*nodes.Template, error)
 
 func (p *Parser) parseDocElement() (nodes.Node, error) {
+	start := p.Current()
+	node, err := p.parseElement()
+	if err != nil && p.recovering {
+		return p.resync(start, err), nil
+	}
+	return node, err
+}
+
+func (p *Parser) parseElement() (nodes.Node, error) {
 	t := p.Current()
 	switch t.Type {
 	case tokens.Data:
@@ -40,6 +49,7 @@ func (p *Parser) parseDocElement() (nodes.Node, error) {
 func (p *Parser) ParseTemplate() (*nodes.Template, error) {
 	tpl := &nodes.Template{
 		Name:   p.Name,
+		Source: p.Source,
 		Blocks: nodes.BlockSet{},
 		Macros: map[string]*nodes.Macro{},
 	}
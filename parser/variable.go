@@ -249,8 +249,12 @@ func (p *Parser) ParseVariable() (nodes.Expression, error) {
 		return br, nil
 	}
 
-	var variable nodes.Node = &nodes.Name{Name: t}
+	return p.parsePostfix(&nodes.Name{Name: t})
+}
 
+// parsePostfix parses the attribute accesses, subscripts and calls
+// following a variable or a literal
+func (p *Parser) parsePostfix(variable nodes.Node) (nodes.Expression, error) {
 	for !p.Stream.EOF() {
 		if dot := p.Match(tokens.Dot); dot != nil {
 			getattr := &nodes.Getattr{
@@ -273,7 +277,10 @@ func (p *Parser) ParseVariable() (nodes.Expression, error) {
 			variable = getattr
 			continue
 		} else if bracket := p.Match(tokens.Lbracket); bracket != nil {
-			tok := p.Match(tokens.String, tokens.Integer)
+			var tok *tokens.Token
+			if p.Peek(tokens.Rbracket) != nil {
+				tok = p.Match(tokens.String, tokens.Integer)
+			}
 			getitem := &nodes.Getitem{
 				Location: bracket,
 				Node:     variable,
@@ -298,9 +305,9 @@ func (p *Parser) ParseVariable() (nodes.Expression, error) {
 					return nil, p.Error("This token is not allowed within a variable name.", p.Current())
 				}
 			} else {
-				expression, err := p.ParseExpression()
+				expression, err := p.parseSubscript()
 				if err != nil {
-					return nil, p.Error("Invalid expression", p.Current())
+					return nil, err
 				}
 				getitem.Arg = expression
 			}
@@ -316,6 +323,7 @@ func (p *Parser) ParseVariable() (nodes.Expression, error) {
 				Func:     variable,
 				Args:     []nodes.Expression{},
 				Kwargs:   map[string]nodes.Expression{},
+				Keywords: map[string]*tokens.Token{},
 			}
 
 			for p.Match(tokens.Comma) != nil || p.Match(tokens.Rparen) == nil {
@@ -332,6 +340,7 @@ func (p *Parser) ParseVariable() (nodes.Expression, error) {
 						return nil, errValue
 					}
 					call.Kwargs[key] = value
+					call.Keywords[key] = v.Position()
 				} else {
 					call.Args = append(call.Args, v)
 				}
@@ -348,6 +357,49 @@ func (p *Parser) ParseVariable() (nodes.Expression, error) {
 	return variable, nil
 }
 
+// parseSubscript parses the content of a subscript,
+// either an expression or a `start:stop:step` slice
+func (p *Parser) parseSubscript() (nodes.Expression, error) {
+	log.WithFields(log.Fields{
+		"current": p.Current(),
+	}).Trace("parseSubscript")
+
+	var start nodes.Expression
+	if p.Current(tokens.Colon) == nil {
+		expr, err := p.ParseExpression()
+		if err != nil || expr == nil {
+			return nil, p.Error("Invalid expression", p.Current())
+		}
+		if p.Current(tokens.Colon) == nil {
+			return expr, nil
+		}
+		start = expr
+	}
+
+	slice := &nodes.Slice{
+		Location: p.Match(tokens.Colon),
+		Start:    start,
+	}
+	parts := []*nodes.Expression{&slice.Stop, &slice.Step}
+	for idx, part := range parts {
+		if p.Current(tokens.Colon, tokens.Rbracket) == nil {
+			expr, err := p.ParseExpression()
+			if err != nil || expr == nil {
+				return nil, p.Error("Invalid slice expression", p.Current())
+			}
+			*part = expr
+		}
+		if idx == 0 && p.Match(tokens.Colon) == nil {
+			break
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"slice": slice,
+	}).Trace("parseSubscript return")
+	return slice, nil
+}
+
 // IDENT | IDENT.(IDENT|NUMBER)...
 func (p *Parser) ParseVariableOrLiteral() (nodes.Expression, error) {
 	log.WithFields(log.Fields{
@@ -365,10 +417,18 @@ func (p *Parser) ParseVariableOrLiteral() (nodes.Expression, error) {
 		return p.parseNumber()
 
 	case tokens.String:
-		return p.parseString()
+		str, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return p.parsePostfix(str)
 
 	case tokens.Lparen, tokens.Lbrace, tokens.Lbracket:
-		return p.parseCollection()
+		collection, err := p.parseCollection()
+		if err != nil {
+			return nil, err
+		}
+		return p.parsePostfix(collection)
 
 	case tokens.Name:
 		return p.ParseVariable()
@@ -13,6 +13,8 @@ import (
 // EOF is an arbitraty value for End Of File
 const rEOF = -1
 
+var newlinesRegexp = regexp.MustCompile(`\r\n|\r|\n`)
+
 var escapedStrings = map[string]string{
 	`\"`: `"`,
 	`\'`: `'`,
@@ -22,7 +24,8 @@ var escapedStrings = map[string]string{
 // as a function that returns the next state.
 type lexFn func() lexFn
 
-// Lexer holds the state of the scanner.
+// Lexer holds the state of the scanner. It is pulled synchronously: each
+// call to Next runs the state functions until a token is scanned.
 type Lexer struct {
 	Input         string         // the string being scanned.
 	Start         int            // start position of this item.
@@ -31,10 +34,17 @@ type Lexer struct {
 	Line          int            // Current line in the input
 	Col           int            // Current position in the line
 	Config        *config.Config // The lexer configuration
-	Tokens        chan *Token    // channel of scanned tokens.
+	state         lexFn          // the next state, nil once the scan is over.
+	pending       []*Token       // tokens scanned but not returned yet.
+	head          int            // index of the next pending token.
+	counted       int            // offset up to which lines are counted.
+	lines         int            // lines counted up to this offset.
+	lineStart     int            // offset of the last line counted.
 	delimiters    []rune
 	RawStatements rawStmt
 	rawEnd        *regexp.Regexp
+	Recovering    bool // Go on lexing after unbalanced delimiters
+	expression    bool // Lexing a standalone expression, ended by the input
 }
 
 // TODO: set from env
@@ -48,36 +58,120 @@ func escape_chars_clashing_regexp(s string) string {
 
 // NewLexer creates a new scanner for the input string.
 func NewLexer(input string) *Lexer {
-	cfg := config.DefaultConfig
-	return &Lexer{
+	return NewLexerWithConfig(input, config.DefaultConfig)
+}
+
+// NewLexerWithConfig creates a new scanner for the input string
+// using the delimiters and whitespace options of cfg.
+func NewLexerWithConfig(input string, cfg *config.Config) *Lexer {
+	if !cfg.KeepTrailingNewline {
+		input = trimTrailingNewline(input)
+	}
+	l := &Lexer{
 		Input:  input,
-		Tokens: make(chan *Token),
 		Config: cfg,
 		RawStatements: rawStmt{
-			"raw":     regexp.MustCompile(fmt.Sprintf(`%s-?\s*endraw`, escape_chars_clashing_regexp(cfg.BlockStartString))),
-			"comment": regexp.MustCompile(fmt.Sprintf(`%s-?\s*endcomment`, escape_chars_clashing_regexp(cfg.BlockStartString))),
+			"raw":     regexp.MustCompile(fmt.Sprintf(`%s[-+]?\s*endraw`, escape_chars_clashing_regexp(cfg.BlockStartString))),
+			"comment": regexp.MustCompile(fmt.Sprintf(`%s[-+]?\s*endcomment`, escape_chars_clashing_regexp(cfg.BlockStartString))),
 		},
 	}
+	l.state = l.lexData
+	l.lines = 1
+	return l
+}
+
+// NewExpressionLexer creates a new scanner for a standalone expression, as
+// found between variable delimiters
+func NewExpressionLexer(input string, cfg *config.Config) *Lexer {
+	l := NewLexerWithConfig(input, cfg)
+	l.state = l.lexExpression
+	l.expression = true
+	return l
+}
+
+// LexExpression lexes a standalone expression, see NewExpressionLexer
+func LexExpression(input string, cfg *config.Config) *Stream {
+	return NewStream(NewExpressionLexer(input, cfg))
 }
 
 func Lex(input string) *Stream {
-	l := NewLexer(input)
-	go l.Run()
-	return NewStream(l.Tokens)
+	return LexWithConfig(input, config.DefaultConfig)
+}
+
+func LexWithConfig(input string, cfg *config.Config) *Stream {
+	return NewStream(NewLexerWithConfig(input, cfg))
+}
+
+// LexRecovering lexes the whole input and returns a stream of its tokens
+// along with the error tokens, which are left out of the stream. The lexer
+// goes on after unbalanced delimiters, so that parsing can resume after them. If it
+// stops on an error, the stream ends with an EOF located at this error.
+func LexRecovering(input string, cfg *config.Config) (*Stream, []*Token) {
+	l := NewLexerWithConfig(input, cfg)
+	l.Recovering = true
+	toks, errs := []*Token{}, []*Token{}
+	var last *Token
+	for tok := l.Next(); tok != nil; tok = l.Next() {
+		if tok.Type == Error {
+			errs = append(errs, tok)
+		} else {
+			toks = append(toks, tok)
+		}
+		last = tok
+	}
+	if last != nil && last.Type == Error {
+		toks = append(toks, &Token{Type: EOF, Pos: last.Pos, Line: last.Line, Col: last.Col})
+	}
+	return NewStream(toks), errs
+}
+
+func trimTrailingNewline(input string) string {
+	if strings.HasSuffix(input, "\r\n") {
+		return input[:len(input)-2]
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(input, "\n"), "\r")
 }
 
 // errorf returns an error token and terminates the scan
 // by passing back a nil pointer that will be the next
 // state, terminating Lexer.Run.
 func (l *Lexer) errorf(format string, args ...any) lexFn {
-	l.Tokens <- &Token{
+	line, col := l.position(l.Start)
+	l.pending = append(l.pending, &Token{
 		Type: Error,
 		Val:  fmt.Sprintf(format, args...),
 		Pos:  l.Pos,
-	}
+		Line: line,
+		Col:  col,
+	})
 	return nil
 }
 
+// recover drops the erroneous input and goes on lexing the expression if
+// recovering, or terminates the scan
+func (l *Lexer) recover() lexFn {
+	if !l.Recovering {
+		return nil
+	}
+	l.Start = l.Pos
+	return l.lexExpression
+}
+
+// position returns the line and the column of an offset, as ReadablePosition
+// does, counting lines from the previous offset as tokens come in order
+func (l *Lexer) position(offset int) (int, int) {
+	if offset < l.counted {
+		l.counted, l.lines, l.lineStart = 0, 1, 0
+	}
+	counted := l.Input[l.counted:offset]
+	if n := strings.Count(counted, "\n"); n > 0 {
+		l.lines += n
+		l.lineStart = l.counted + strings.LastIndexByte(counted, '\n') + 1
+	}
+	l.counted = offset
+	return l.lines, offset - l.lineStart + 1
+}
+
 // Position return the current position in the input
 func (l *Lexer) Position() *Position {
 	return &Position{
@@ -91,13 +185,28 @@ func (l *Lexer) Current() string {
 	return l.Input[l.Start:l.Pos]
 }
 
-// Run lexes the input by executing state functions until
-// the state is nil.
-func (l *Lexer) Run() {
-	for state := l.lexData; state != nil; {
-		state = state()
+// Next returns the next token, executing state functions until one is
+// scanned, or nil once the scan is over.
+func (l *Lexer) Next() *Token {
+	for l.head == len(l.pending) {
+		if l.state == nil {
+			return nil
+		}
+		l.pending, l.head = l.pending[:0], 0
+		l.state = l.state()
 	}
-	close(l.Tokens) // No more tokens will be delivered.
+	tok := l.pending[l.head]
+	l.head++
+	return tok
+}
+
+// Tokens lexes the rest of the input and returns its tokens
+func (l *Lexer) Tokens() []*Token {
+	toks := []*Token{}
+	for tok := l.Next(); tok != nil; tok = l.Next() {
+		toks = append(toks, tok)
+	}
+	return toks
 }
 
 // next returns the next rune in the input.
@@ -121,17 +230,60 @@ func (l *Lexer) emit(t Type) {
 }
 
 func (l *Lexer) processAndEmit(t Type, fn func(string) string) {
-	line, col := ReadablePosition(l.Start, l.Input)
+	line, col := l.position(l.Start)
 	val := l.Input[l.Start:l.Pos]
 	if fn != nil {
 		val = fn(val)
 	}
-	l.Tokens <- &Token{
+	l.pending = append(l.pending, &Token{
 		Type: t,
 		Val:  val,
 		Pos:  l.Start,
 		Line: line,
 		Col:  col,
+	})
+	l.Start = l.Pos
+}
+
+// emitData emits a Data token, normalizing its newlines
+func (l *Lexer) emitData() {
+	l.processAndEmit(Data, func(val string) string {
+		if l.Config.NewlineSequence == "" {
+			return val
+		}
+		return newlinesRegexp.ReplaceAllString(val, l.Config.NewlineSequence)
+	})
+}
+
+// emitTagData emits the data preceding a block or a comment starting with
+// begin. With LstripBlocks, the spaces and tabs between the start of the line
+// and the tag are left out unless the tag opens with a '+'.
+func (l *Lexer) emitTagData(begin string) {
+	end := l.Pos
+	if l.Config.LstripBlocks && !strings.HasPrefix(l.Input[end+len(begin):], "+") {
+		lineStart := l.Start + strings.LastIndexAny(l.Input[l.Start:end], "\r\n") + 1
+		isLineStart := lineStart == 0 || l.Input[lineStart-1] == '\n' || l.Input[lineStart-1] == '\r'
+		if isLineStart && strings.Trim(l.Input[lineStart:end], " \t") == "" {
+			l.Pos = lineStart
+		}
+	}
+	if l.Pos > l.Start {
+		l.emitData()
+	}
+	l.Pos = end
+	l.Start = end
+}
+
+// skipNewline drops the newline following a block or a comment
+// when TrimBlocks is enabled, unless the tag closes with a '+'.
+func (l *Lexer) skipNewline(keep bool) {
+	if !l.Config.TrimBlocks || keep {
+		return
+	}
+	if l.hasPrefix("\r\n") {
+		l.Pos += 2
+	} else if l.hasPrefix("\n") || l.hasPrefix("\r") {
+		l.Pos++
 	}
 	l.Start = l.Pos
 }
@@ -195,23 +347,19 @@ func (l *Lexer) expectDelimiter(r rune) bool {
 func (l *Lexer) lexData() lexFn {
 	for {
 		if l.hasPrefix(l.Config.CommentStartString) {
-			if l.Pos > l.Start {
-				l.emit(Data)
-			}
+			l.emitTagData(l.Config.CommentStartString)
 			return l.lexComment
 		}
 
 		if l.hasPrefix(l.Config.VariableStartString) {
 			if l.Pos > l.Start {
-				l.emit(Data)
+				l.emitData()
 			}
 			return l.lexVariable
 		}
 
 		if l.hasPrefix(l.Config.BlockStartString) {
-			if l.Pos > l.Start {
-				l.emit(Data)
-			}
+			l.emitTagData(l.Config.BlockStartString)
 			return l.lexBlock
 		}
 
@@ -221,7 +369,7 @@ func (l *Lexer) lexData() lexFn {
 	}
 	// Correctly reached EOF.
 	if l.Pos > l.Start {
-		l.emit(Data)
+		l.emitData()
 	}
 	l.emit(EOF) // Useful to make EOF a token.
 	return nil  // Stop the run loop.
@@ -237,27 +385,30 @@ func (l *Lexer) lexRaw() lexFn {
 		return l.errorf(`Unable to find raw closing statement`)
 	}
 	l.Pos += loc[0]
-	l.emit(Data)
+	l.emitData()
 	l.rawEnd = nil
 	return l.lexBlock
 }
 
 func (l *Lexer) lexComment() lexFn {
 	l.Pos += len(l.Config.CommentStartString)
-	l.accept("-")
+	l.accept("-+")
 	l.emit(CommentBegin)
 	i := strings.Index(l.Input[l.Pos:], l.Config.CommentEndString)
 	if i < 0 {
 		return l.errorf("unclosed comment")
 	}
 	l.Pos += i
-	if l.Input[l.Pos-1] == '-' {
+	keep := false
+	if l.Input[l.Pos-1] == '-' || l.Input[l.Pos-1] == '+' {
+		keep = l.Input[l.Pos-1] == '+'
 		l.Pos -= 1
 	}
 	l.emit(Data)
-	l.accept("-")
+	l.accept("-+")
 	l.Pos += len(l.Config.CommentEndString)
 	l.emit(CommentEnd)
+	l.skipNewline(keep)
 	return l.lexData
 }
 
@@ -277,7 +428,7 @@ func (l *Lexer) lexVariableEnd() lexFn {
 
 func (l *Lexer) lexBlock() lexFn {
 	l.Pos += len(l.Config.BlockStartString)
-	l.accept("-")
+	l.accept("-+")
 	l.emit(BlockBegin)
 	for isSpace(l.peek()) {
 		l.next()
@@ -295,9 +446,11 @@ func (l *Lexer) lexBlock() lexFn {
 }
 
 func (l *Lexer) lexBlockEnd() lexFn {
-	l.accept("-")
+	keep := l.peek() == '+'
+	l.accept("-+")
 	l.Pos += len(l.Config.BlockEndString)
 	l.emit(BlockEnd)
+	l.skipNewline(keep)
 	if l.rawEnd != nil {
 		return l.lexRaw
 	} else {
@@ -319,6 +472,12 @@ func (l *Lexer) lexExpression() lexFn {
 
 		r := l.next()
 		switch {
+		case r == rEOF:
+			if !l.expression || len(l.delimiters) > 0 {
+				return l.errorf("Unexpected end of expression")
+			}
+			l.emit(EOF)
+			return nil
 		case isSpace(r):
 			return l.lexSpace
 		case isNumeric(r):
@@ -331,6 +490,10 @@ func (l *Lexer) lexExpression() lexFn {
 		case r == '|':
 			l.emit(Pipe)
 		case r == '+':
+			if l.hasPrefix(l.Config.BlockEndString) {
+				l.backup()
+				return l.lexBlockEnd
+			}
 			l.emit(Add)
 		case r == '-':
 			if l.hasPrefix(l.Config.BlockEndString) {
@@ -398,17 +561,17 @@ func (l *Lexer) lexExpression() lexFn {
 			l.pushDelimiter(']')
 		case r == ')':
 			if !l.popDelimiter(')') {
-				return nil
+				return l.recover()
 			}
 			l.emit(Rparen)
 		case r == '}':
 			if !l.popDelimiter('}') {
-				return nil
+				return l.recover()
 			}
 			l.emit(Rbrace)
 		case r == ']':
 			if !l.popDelimiter(']') {
-				return nil
+				return l.recover()
 			}
 			l.emit(Rbracket)
 		// in
@@ -520,9 +683,10 @@ func (l *Lexer) lexString() lexFn {
 	return l.lexExpression
 }
 
-// isSpace reports whether r is a space character.
+// isSpace reports whether r is a space character. Newlines are spaces too
+// within tags, they are kept as Whitespace tokens.
 func isSpace(r rune) bool {
-	return r == ' ' || r == '\t'
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
 }
 
 // isAlphaNumeric reports whether r is an alphabetic, digit, or underscore.
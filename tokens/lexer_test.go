@@ -1,6 +1,7 @@
 package tokens_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/MarioJim/gonja/config"
@@ -74,6 +75,14 @@ var lexerCases = []struct {
 		data("World"),
 		EOF,
 	}},
+	{"multiline variable", "{{\n  foo\n}}", []tok{
+		varBegin,
+		{tokens.Whitespace, "\n  "},
+		name("foo"),
+		{tokens.Whitespace, "\n"},
+		varEnd,
+		EOF,
+	}},
 	{"simple variable", "{{ foo }}", []tok{
 		varBegin,
 		space,
@@ -107,6 +116,13 @@ var lexerCases = []struct {
 		blockBeginTrim, space, name("endif"), space, blockEndTrim,
 		EOF,
 	}},
+	{"blocks with plus markers", "Hello.  {%+ if true +%}World{%+ endif +%}", []tok{
+		data("Hello.  "),
+		{tokens.BlockBegin, "{%+"}, space, name("if"), space, name("true"), space, {tokens.BlockEnd, "+%}"},
+		data("World"),
+		{tokens.BlockBegin, "{%+"}, space, name("endif"), space, {tokens.BlockEnd, "+%}"},
+		EOF,
+	}},
 	{"Ignore tags in comment", "<html>{# ignore {% tags %} in comments ##}</html>", []tok{
 		data("<html>"),
 		{tokens.CommentBegin, "{#"},
@@ -174,6 +190,11 @@ var lexerCases = []struct {
 		space, varEnd,
 		EOF,
 	}},
+	{"Unterminated expression", "{{ (a", []tok{
+		varBegin, space,
+		lParen, name("a"),
+		error(`Unexpected end of expression`),
+	}},
 	{"string with double quote", `{{ "Hello, " + "World" }}`, []tok{
 		varBegin, space,
 		str("Hello, "),
@@ -238,21 +259,12 @@ var lexerCases = []struct {
 	}},
 }
 
-func tokenSlice(c chan *tokens.Token) []*tokens.Token {
-	toks := []*tokens.Token{}
-	for token := range c {
-		toks = append(toks, token)
-	}
-	return toks
-}
-
 func TestLexer(t *testing.T) {
 	for _, lc := range lexerCases {
 		test := lc
 		t.Run(test.name, func(t *testing.T) {
 			lexer := tokens.NewLexer(test.input)
-			go lexer.Run()
-			toks := tokenSlice(lexer.Tokens)
+			toks := lexer.Tokens()
 
 			assert := assert.New(t)
 			assert.Equal(len(test.expected), len(toks))
@@ -319,8 +331,7 @@ func TestRegexpClashingDelimiters(t *testing.T) {
 		}()
 
 		lexer := tokens.NewLexer("[[ variable ]][% block %][# comment #]")
-		go lexer.Run()
-		toks := tokenSlice(lexer.Tokens)
+		toks := lexer.Tokens()
 
 		stream := tokens.NewStream(toks)
 		expected, _ := asStreamResult([]tok{
@@ -337,13 +348,69 @@ func TestRegexpClashingDelimiters(t *testing.T) {
 		assert.Equal(expected, actual)
 	})
 }
+
+var lexerConfigCases = []struct {
+	name     string
+	input    string
+	setup    func(*config.Config)
+	expected []tok
+}{
+	{"trim blocks", "{% if true %}\nyes\n{% endif +%}\n", func(cfg *config.Config) {
+		cfg.TrimBlocks = true
+	}, []tok{
+		blockBegin, space, name("if"), space, name("true"), space, blockEnd,
+		data("yes\n"),
+		blockBegin, space, name("endif"), space, {tokens.BlockEnd, "+%}"},
+		data("\n"),
+		EOF,
+	}},
+	{"lstrip blocks", "a\n  {% if true %} b\n\t{%+ endif %}", func(cfg *config.Config) {
+		cfg.LstripBlocks = true
+	}, []tok{
+		data("a\n"),
+		blockBegin, space, name("if"), space, name("true"), space, blockEnd,
+		data(" b\n\t"),
+		{tokens.BlockBegin, "{%+"}, space, name("endif"), space, blockEnd,
+		EOF,
+	}},
+	{"trailing newline", "Hello\n", func(cfg *config.Config) {
+		cfg.KeepTrailingNewline = false
+	}, []tok{
+		data("Hello"),
+		EOF,
+	}},
+	{"newline sequence", "a\r\nb\rc\n", func(cfg *config.Config) {
+		cfg.NewlineSequence = "\n"
+	}, []tok{
+		data("a\nb\nc\n"),
+		EOF,
+	}},
+}
+
+func TestLexerWithConfig(t *testing.T) {
+	for _, lc := range lexerConfigCases {
+		test := lc
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.NewConfig()
+			test.setup(cfg)
+			lexer := tokens.NewLexerWithConfig(test.input, cfg)
+			toks := lexer.Tokens()
+
+			actual := []tok{}
+			for _, token := range toks {
+				actual = append(actual, tok{token.Type, token.Val})
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
 func TestStreamSlice(t *testing.T) {
 	for _, lc := range lexerCases {
 		test := lc
 		t.Run(test.name, func(t *testing.T) {
 			lexer := tokens.NewLexer(test.input)
-			go lexer.Run()
-			toks := tokenSlice(lexer.Tokens)
+			toks := lexer.Tokens()
 
 			stream := tokens.NewStream(toks)
 			expected, _ := asStreamResult(test.expected)
@@ -368,8 +435,7 @@ func TestLexerPosition(t *testing.T) {
 	assert := assert.New(t)
 
 	lexer := tokens.NewLexer(positionsCase)
-	go lexer.Run()
-	toks := tokenSlice(lexer.Tokens)
+	toks := lexer.Tokens()
 	assert.Equal([]*tokens.Token{
 		{tokens.Data, "Hello\n", 0, 1, 1, false},
 		{tokens.CommentBegin, "{#", 6, 2, 1, false},
@@ -379,3 +445,65 @@ func TestLexerPosition(t *testing.T) {
 		{tokens.EOF, "", 40, 6, 1, false},
 	}, toks)
 }
+
+func TestLexerPull(t *testing.T) {
+	assert := assert.New(t)
+
+	lexer := tokens.NewLexer("Hello {{ name }} and {{ other }}")
+	assert.Equal(&tokens.Token{tokens.Data, "Hello ", 0, 1, 1, false}, lexer.Next())
+	assert.Equal(&tokens.Token{tokens.VariableBegin, "{{", 6, 1, 7, false}, lexer.Next())
+	assert.Less(lexer.Pos, len(lexer.Input), "the lexer only scans the pulled tokens")
+
+	toks := lexer.Tokens()
+	assert.Len(toks, 11)
+	assert.Equal(tokens.EOF, toks[len(toks)-1].Type)
+	assert.Nil(lexer.Next())
+}
+
+func TestLexExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	toks := tokens.NewExpressionLexer("[1, 'a'] | length", config.DefaultConfig).Tokens()
+	actual := []tok{}
+	for _, token := range toks {
+		actual = append(actual, tok{token.Type, token.Val})
+	}
+	assert.Equal([]tok{
+		lBracket, {tokens.Integer, "1"}, {tokens.Comma, ","}, space, str("a"), rBracket,
+		space, {tokens.Pipe, "|"}, space, name("length"),
+		EOF,
+	}, actual)
+
+	toks = tokens.NewExpressionLexer("{'a': (1", config.DefaultConfig).Tokens()
+	assert.Equal(tokens.Error, toks[len(toks)-1].Type)
+}
+
+var benchmarkInput = strings.Repeat(`<ul>
+{%- for user in users | sort(attribute="name") if user.active %}
+	<li class="{{ loop.cycle('odd', 'even') }}">{{ user.name | title }} ({{ user.age + 1 }})</li>
+{%- else %}
+	{# nobody #}
+	<li>{{ "No user" | upper }}</li>
+{%- endfor %}
+</ul>
+{% if page and page.title is defined %}{{ page.title[0:10] ~ "..." }}{% endif %}
+`, 20)
+
+func BenchmarkLexer(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkInput)))
+	for i := 0; i < b.N; i++ {
+		tokens.NewLexer(benchmarkInput).Tokens()
+	}
+}
+
+func BenchmarkStream(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkInput)))
+	for i := 0; i < b.N; i++ {
+		stream := tokens.Lex(benchmarkInput)
+		for !stream.End() {
+			stream.Next()
+		}
+	}
+}
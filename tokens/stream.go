@@ -59,6 +59,8 @@ func NewStream(input any) *Stream {
 	var it TokenIterator
 
 	switch t := input.(type) {
+	case TokenIterator:
+		it = t
 	case chan *Token:
 		it = ChanIterator(t)
 	case []*Token: